@@ -0,0 +1,81 @@
+package apply
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Apply runs the edits of one file, in order, against its current
+// content. exists is false when the file isn't in the working tree.
+// remove is true when the edits delete the file.
+func Apply(current string, exists bool, edits []Edit) (content string, remove bool, err error) {
+	// Work on LF lines and restore CRLF afterwards, so the edits don't
+	// need to match the file's line endings
+	crlf := strings.Contains(current, "\r\n")
+	content = strings.ReplaceAll(current, "\r\n", "\n")
+
+	for _, edit := range edits {
+		if remove {
+			return "", false, fmt.Errorf("line %d: %s was already deleted by an earlier edit", edit.Line, edit.Path)
+		}
+
+		switch {
+		case edit.Kind == KindFile:
+			// Blocks don't show whether the file ends with a newline; keep
+			// what the file has
+			next := edit.Content
+			if exists && content != "" && !strings.HasSuffix(content, "\n") {
+				next = strings.TrimSuffix(next, "\n")
+			}
+			content = next
+
+		case edit.Create && exists:
+			return "", false, fmt.Errorf("line %d: the diff creates %s, which already exists", edit.Line, edit.Path)
+
+		case !edit.Create && !exists:
+			return "", false, fmt.Errorf("line %d: %s doesn't exist", edit.Line, edit.Path)
+
+		default:
+			lines, eol := splitLines(content)
+			patched, err := applyHunks(lines, edit.Hunks)
+			if err != nil {
+				return "", false, fmt.Errorf("line %d: %w", edit.Line, err)
+			}
+			if edit.Delete {
+				if len(patched) > 0 {
+					return "", false, fmt.Errorf("line %d: the diff deletes %s but leaves lines in it", edit.Line, edit.Path)
+				}
+				content, remove = "", true
+				continue
+			}
+			content = joinLines(patched, (eol || edit.Create || edit.AddNewline) && !edit.NoNewline)
+		}
+		exists = true
+	}
+
+	if crlf {
+		content = strings.ReplaceAll(content, "\n", "\r\n")
+	}
+	return content, remove, nil
+}
+
+// splitLines splits content into lines, reporting whether it ended with
+// a newline
+func splitLines(content string) ([]string, bool) {
+	if content == "" {
+		return nil, true
+	}
+	eol := strings.HasSuffix(content, "\n")
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n"), eol
+}
+
+func joinLines(lines []string, eol bool) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	content := strings.Join(lines, "\n")
+	if eol {
+		content += "\n"
+	}
+	return content
+}
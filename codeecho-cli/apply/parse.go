@@ -0,0 +1,279 @@
+package apply
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/opskraken/codeecho-cli/output"
+	"github.com/opskraken/codeecho-cli/utils"
+)
+
+// Kinds of edits a model response can carry
+const (
+	KindFile = "file" // The whole new content of a file
+	KindDiff = "diff" // A unified diff against the current content
+)
+
+// Edit is one change to one file, in response order
+type Edit struct {
+	Path string // Clean, slash-separated and relative
+	Kind string
+	Line int // Line of the response the edit starts on
+
+	Content string // KindFile: the new content
+
+	Hunks      []Hunk // KindDiff
+	Create     bool   // KindDiff: the diff is against /dev/null
+	Delete     bool   // KindDiff: the diff is to /dev/null
+	NoNewline  bool   // KindDiff: the new content doesn't end with a newline
+	AddNewline bool   // KindDiff: the old content has no final newline and the new one does
+
+	// Hash is the ContentHash of the file the edit was made for, when the
+	// response repeats the hash attribute of a pack's <file> element
+	Hash string
+
+	// Compression and BudgetAction repeat the compression and budget
+	// attributes of a pack's <file> element: the content the edit was
+	// made from wasn't the whole file
+	Compression  string
+	BudgetAction string
+}
+
+var (
+	fileTagPattern   = regexp.MustCompile(`^\s*<file\s+path="([^"]*)"[^>]*>\s*$`)
+	fileAttrPattern  = regexp.MustCompile(`(\w+)="([^"]*)"`)
+	fenceOpenPattern = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})\\s*(.*)$")
+)
+
+// Parse finds the edits in a model response: <file path="..."> elements
+// shaped like the XML pack, fenced code blocks headed by a path, and
+// unified diffs, fenced or not. Code blocks without a path are taken as
+// explanation rather than edits; Parse returns how many it skipped.
+func Parse(response string) ([]Edit, int, error) {
+	lines := strings.Split(strings.ReplaceAll(response, "\r\n", "\n"), "\n")
+	var edits []Edit
+	skipped := 0
+
+	for i := 0; i < len(lines); {
+		line := lines[i]
+
+		if m := fileTagPattern.FindStringSubmatch(line); m != nil {
+			end := fileElementEnd(lines, i+1)
+			if end < 0 {
+				return nil, 0, fmt.Errorf("line %d: <file> element for %s is not closed", i+1, m[1])
+			}
+			body := lines[i+1 : end]
+			content, isCDATA := output.UnwrapCDATA(strings.TrimSpace(strings.Join(body, "\n")))
+			if isCDATA {
+				body = strings.Split(content, "\n")
+			}
+			edit, err := fileEdit(m[1], i+1, body)
+			if err != nil {
+				return nil, 0, err
+			}
+			for _, attr := range fileAttrPattern.FindAllStringSubmatch(line, -1) {
+				switch attr[1] {
+				case "hash":
+					edit.Hash = attr[2]
+				case "compression":
+					edit.Compression = attr[2]
+				case "budget":
+					edit.BudgetAction = attr[2]
+				}
+			}
+			if !isCDATA && !strings.Contains(edit.Content, "<") {
+				// Copied from an older pack with its escaping
+				edit.Content = output.UnescapeXML(edit.Content)
+			}
+			edits = append(edits, edit)
+			i = end + 1
+			continue
+		}
+
+		if m := fenceOpenPattern.FindStringSubmatch(line); m != nil {
+			indent, fence, info := len(m[1]), m[2], strings.TrimSpace(m[3])
+			end := closingFence(lines, i+1, fence)
+			if end < 0 {
+				return nil, 0, fmt.Errorf("line %d: code block is not closed; was the response cut off?", i+1)
+			}
+			body := make([]string, 0, end-i-1)
+			for _, l := range lines[i+1 : end] {
+				body = append(body, trimIndent(l, indent))
+			}
+
+			if isDiffBlock(info, body) {
+				diffs, err := parseDiffs(body, i+2, false)
+				if err != nil {
+					return nil, 0, err
+				}
+				edits = append(edits, diffs...)
+			} else if path := blockPath(info, lines, i); path != "" {
+				edit, err := fileEdit(path, i+1, body)
+				if err != nil {
+					return nil, 0, err
+				}
+				edits = append(edits, edit)
+			} else {
+				skipped++
+			}
+			i = end + 1
+			continue
+		}
+
+		if isDiffStart(lines, i) {
+			end := diffEnd(lines, i)
+			diffs, err := parseDiffs(lines[i:end], i+1, true)
+			if err != nil {
+				return nil, 0, err
+			}
+			edits = append(edits, diffs...)
+			i = end
+			continue
+		}
+
+		i++
+	}
+	return edits, skipped, nil
+}
+
+// fileEdit makes a full-file edit from the lines of a block. Blocks
+// rarely end with the file's final newline, so one is added.
+func fileEdit(path string, line int, body []string) (Edit, error) {
+	rel, err := utils.SafeRelativePath(strings.TrimSpace(path))
+	if err != nil {
+		return Edit{}, fmt.Errorf("line %d: %w", line, err)
+	}
+
+	content := output.RemoveLineNumbers(strings.Join(body, "\n"))
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return Edit{Path: rel, Kind: KindFile, Line: line, Content: content}, nil
+}
+
+// indexLine returns the first line at or after from that is want, ignoring
+// surrounding whitespace, or -1
+func indexLine(lines []string, from int, want string) int {
+	for i := from; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == want {
+			return i
+		}
+	}
+	return -1
+}
+
+// fileElementEnd returns the </file> line closing an element whose body
+// starts at from, or -1. A </file> line inside a CDATA section is content.
+func fileElementEnd(lines []string, from int) int {
+	if from < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[from]), "<![CDATA[") {
+		for i := from; i < len(lines); i++ {
+			if strings.HasSuffix(strings.TrimSpace(lines[i]), "]]>") {
+				return indexLine(lines, i+1, "</file>")
+			}
+		}
+		return -1
+	}
+	return indexLine(lines, from, "</file>")
+}
+
+// closingFence returns the line closing a code block opened with fence:
+// the same character, at least as many times, and nothing else. Models
+// often nest blocks with the same fence, as when writing a Markdown file,
+// so a fence with an info string opens a block that the next bare fence
+// closes. When the fences don't pair up that way, the first bare fence
+// closes the block.
+func closingFence(lines []string, from int, fence string) int {
+	depth, first := 0, -1
+	for i := from; i < len(lines); i++ {
+		l := strings.TrimSpace(lines[i])
+		if len(l) >= len(fence) && strings.Trim(l, fence[:1]) == "" {
+			if depth == 0 {
+				return i
+			}
+			if first < 0 {
+				first = i
+			}
+			depth--
+			continue
+		}
+		if m := fenceOpenPattern.FindStringSubmatch(lines[i]); m != nil && m[2][0] == fence[0] &&
+			len(m[2]) >= len(fence) && strings.TrimSpace(m[3]) != "" {
+			depth++
+		}
+	}
+	return first
+}
+
+// trimIndent removes up to n leading spaces, the indentation of the fence
+func trimIndent(line string, n int) string {
+	for i := 0; i < n && strings.HasPrefix(line, " "); i++ {
+		line = line[1:]
+	}
+	return line
+}
+
+// blockPath finds the path of a fenced block: in the info string
+// ("```go path=cmd/scan.go", "```cmd/scan.go") or on the line above it
+// ("### cmd/scan.go", "**File:** `cmd/scan.go`"). A blank line may
+// separate the heading from the block.
+func blockPath(info string, lines []string, fenceLine int) string {
+	for _, field := range strings.Fields(info) {
+		if key, value, ok := strings.Cut(field, "="); ok {
+			switch strings.ToLower(key) {
+			case "path", "file", "filename", "title":
+				return strings.Trim(value, `"'`)
+			}
+			continue
+		}
+		if _, after, ok := strings.Cut(field, ":"); ok && looksLikePath(after) {
+			return after
+		}
+		if looksLikePath(field) {
+			return field
+		}
+	}
+
+	for i, blank := fenceLine-1, 0; i >= 0 && blank <= 1; i-- {
+		if strings.TrimSpace(lines[i]) == "" {
+			blank++
+			continue
+		}
+		return pathFromHeading(lines[i])
+	}
+	return ""
+}
+
+// pathFromHeading reads a path from a heading, list item or label line;
+// anything that reads like a sentence gives ""
+func pathFromHeading(line string) string {
+	s := strings.TrimLeft(strings.TrimSpace(line), "#>*- ")
+	for _, label := range []string{"File:", "file:", "Path:", "path:", "Filename:", "filename:"} {
+		s = strings.TrimPrefix(s, label)
+	}
+	s = strings.Trim(s, "*`_ :")
+
+	// "cmd/scan.go (new file)"
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return ""
+	}
+	if len(fields) > 1 && !strings.HasPrefix(fields[1], "(") {
+		return ""
+	}
+	s = strings.Trim(fields[0], "*`_:")
+	if !looksLikePath(s) {
+		return ""
+	}
+	return s
+}
+
+// looksLikePath accepts file names and paths, not languages or prose
+func looksLikePath(s string) bool {
+	switch {
+	case s == "", len(s) > 255, strings.ContainsAny(s, " \t\"'<>|"),
+		strings.HasSuffix(s, "."), strings.Contains(s, "://"):
+		return false
+	}
+	return strings.ContainsAny(s, "./")
+}
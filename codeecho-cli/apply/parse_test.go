@@ -0,0 +1,160 @@
+package apply
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseOne parses a response that must hold exactly one edit
+func parseOne(t *testing.T, response string) Edit {
+	t.Helper()
+	edits, _, err := Parse(response)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(edits) != 1 {
+		t.Fatalf("got %d edits, want 1: %+v", len(edits), edits)
+	}
+	return edits[0]
+}
+
+func TestParseBlockPaths(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		path     string // "" when the block must be skipped
+	}{
+		{"info path attribute", "```go path=cmd/scan.go\npackage cmd\n```\n", "cmd/scan.go"},
+		{"info path", "```cmd/scan.go\npackage cmd\n```\n", "cmd/scan.go"},
+		{"info language and path", "```go:cmd/scan.go\npackage cmd\n```\n", "cmd/scan.go"},
+		{"heading", "### cmd/scan.go\n\n```go\npackage cmd\n```\n", "cmd/scan.go"},
+		{"label", "**File:** `cmd/scan.go`\n```go\npackage cmd\n```\n", "cmd/scan.go"},
+		{"new file note", "`cmd/new.go` (new file)\n```go\npackage cmd\n```\n", "cmd/new.go"},
+		{"file name with colon", "main.go:\n```go\npackage main\n```\n", "main.go"},
+		{"prose naming a file", "Update main.go:\n```go\npackage main\n```\n", ""},
+		{"bold prose naming a file", "**Update `main.go`:**\n```go\npackage main\n```\n", ""},
+		{"numbered step", "1. Edit main.go\n```go\npackage main\n```\n", ""},
+		{"sentence ending in a period", "Done.\n```go\npackage main\n```\n", ""},
+		{"label without a path", "Output:\n```\nok\n```\n", ""},
+		{"language only", "```python\nprint(1)\n```\n", ""},
+		{"heading too far above", "main.go\n\n\n```go\npackage main\n```\n", ""},
+		{"url", "https://example.com/a.go\n```go\npackage main\n```\n", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edits, skipped, err := Parse(tt.response)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if tt.path == "" {
+				if len(edits) != 0 || skipped != 1 {
+					t.Fatalf("got %d edits and %d skipped, want the block skipped: %+v", len(edits), skipped, edits)
+				}
+				return
+			}
+			if len(edits) != 1 || edits[0].Path != tt.path {
+				t.Fatalf("got %+v, want one edit of %s", edits, tt.path)
+			}
+		})
+	}
+}
+
+func TestParseNestedFences(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		content  string
+	}{
+		{
+			name:     "longer outer fence",
+			response: "### README.md\n````markdown\n# Title\n```go\nfmt.Println()\n```\n````\n",
+			content:  "# Title\n```go\nfmt.Println()\n```\n",
+		},
+		{
+			name:     "same outer fence",
+			response: "### README.md\n```markdown\n# Title\n\n```sh\nmake\n```\n\nMore text.\n```\n\nThat's all.\n",
+			content:  "# Title\n\n```sh\nmake\n```\n\nMore text.\n",
+		},
+		{
+			name:     "tilde outer fence",
+			response: "### docs/use.md\n~~~\n```\ncode\n```\n~~~\n",
+			content:  "```\ncode\n```\n",
+		},
+		{
+			name:     "unpaired inner fence",
+			response: "### notes.md\n```\nsee ```go below\n```\n",
+			content:  "see ```go below\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edit := parseOne(t, tt.response)
+			if edit.Kind != KindFile || edit.Content != tt.content {
+				t.Errorf("got %s edit with content %q, want %q", edit.Kind, edit.Content, tt.content)
+			}
+		})
+	}
+}
+
+func TestParseFencesAfterNestedBlock(t *testing.T) {
+	response := "### README.md\n```markdown\n```sh\nmake\n```\n```\n\n### main.go\n```go\npackage main\n```\n"
+	edits, _, err := Parse(response)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	var paths []string
+	for _, edit := range edits {
+		paths = append(paths, edit.Path)
+	}
+	if want := []string{"README.md", "main.go"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("got paths %v, want %v", paths, want)
+	}
+}
+
+func TestParseCRLFResponse(t *testing.T) {
+	response := strings.ReplaceAll("### main.go\n```go\npackage main\n\nfunc main() {}\n```\n", "\n", "\r\n")
+	edit := parseOne(t, response)
+	if want := "package main\n\nfunc main() {}\n"; edit.Content != want {
+		t.Errorf("got content %q, want %q", edit.Content, want)
+	}
+}
+
+func TestParseFileElement(t *testing.T) {
+	response := "<file path=\"a/b.go\" hash=\"abc123\" compression=\"signatures\" budget=\"truncated\">\n<![CDATA[package b\n</file>\n]]>\n</file>\n"
+	edit := parseOne(t, response)
+	if edit.Path != "a/b.go" || edit.Hash != "abc123" {
+		t.Errorf("got path %s and hash %s, want a/b.go and abc123", edit.Path, edit.Hash)
+	}
+	if edit.Compression != "signatures" || edit.BudgetAction != "truncated" {
+		t.Errorf("got compression %q and budget %q, want signatures and truncated", edit.Compression, edit.BudgetAction)
+	}
+	if want := "package b\n</file>\n"; edit.Content != want {
+		t.Errorf("got content %q, want %q", edit.Content, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+	}{
+		{"unclosed block", "### main.go\n```go\npackage main\n", "not closed"},
+		{"unclosed element", "<file path=\"main.go\">\npackage main\n", "not closed"},
+		{"escaping path", "### ../etc/passwd\n```\nroot\n```\n", "line 2"},
+		{"rename", "--- a/old.go\n+++ b/new.go\n@@ -1 +1 @@\n-a\n+b\n", "renames"},
+		{"no hunks", "```diff\n--- a/main.go\n+++ b/main.go\n```\n", "no hunks"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Parse(tt.response)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package apply
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/opskraken/codeecho-cli/utils"
+)
+
+// Hunk is one @@ section of a unified diff
+type Hunk struct {
+	OldStart int      // 1-based, as the header says; only a hint for where to look
+	Lines    []string // Each starts with ' ', '-' or '+'
+}
+
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+\d+(?:,(\d+))? @@`)
+
+// isDiffBlock reports whether a fenced block holds a unified diff
+func isDiffBlock(info string, body []string) bool {
+	if fields := strings.Fields(info); len(fields) > 0 && (fields[0] == "diff" || fields[0] == "patch") {
+		return true
+	}
+	for i := range body {
+		if isDiffStart(body, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDiffStart reports whether a file header ("--- a/x" then "+++ b/x")
+// starts at line i
+func isDiffStart(lines []string, i int) bool {
+	return strings.HasPrefix(lines[i], "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ")
+}
+
+// diffEnd returns the line after an unfenced diff starting at i
+func diffEnd(lines []string, i int) int {
+	for i < len(lines) {
+		switch line := lines[i]; {
+		case isDiffStart(lines, i):
+			i += 2
+		case isHunkLine(line), strings.HasPrefix(line, "@@"), isGitHeader(line):
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// isHunkLine accepts the lines a hunk body may hold. An empty line is a
+// blank context line whose leading space was lost.
+func isHunkLine(line string) bool {
+	return line == "" || strings.ContainsAny(line[:1], " +-\\")
+}
+
+// isGitHeader matches the extended header lines of git diff output
+func isGitHeader(line string) bool {
+	for _, prefix := range []string{"diff --git ", "index ", "new file mode ", "deleted file mode ",
+		"old mode ", "new mode ", "similarity index ", "rename from ", "rename to "} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDiffs reads the files of a unified diff. first is the response
+// line lines[0] came from. Models often get the line counts in hunk
+// headers wrong, so inside a code block, whose end is known, they are
+// ignored; counted is false there.
+func parseDiffs(lines []string, first int, counted bool) ([]Edit, error) {
+	var edits []Edit
+
+	for i := 0; i < len(lines); {
+		if !isDiffStart(lines, i) {
+			i++
+			continue
+		}
+
+		oldPath, newPath := diffPath(lines[i][4:]), diffPath(lines[i+1][4:])
+		edit := Edit{Kind: KindDiff, Line: first + i, Create: oldPath == "/dev/null", Delete: newPath == "/dev/null"}
+		path := newPath
+		switch {
+		case edit.Create && edit.Delete:
+			return nil, fmt.Errorf("line %d: diff has no file name", edit.Line)
+		case edit.Delete:
+			path = oldPath
+		case !edit.Create && strings.TrimPrefix(oldPath, "a/") != strings.TrimPrefix(newPath, "b/"):
+			return nil, fmt.Errorf("line %d: diff renames %s to %s; renames aren't supported", edit.Line, oldPath, newPath)
+		}
+		if edit.Delete {
+			path = strings.TrimPrefix(path, "a/")
+		} else {
+			path = strings.TrimPrefix(path, "b/")
+		}
+
+		rel, err := utils.SafeRelativePath(path)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", edit.Line, err)
+		}
+		edit.Path = rel
+		i += 2
+
+		for i < len(lines) && strings.HasPrefix(lines[i], "@@") {
+			hunk, oldNoNewline, noNewline, next := readHunk(lines, i, counted)
+			edit.Hunks = append(edit.Hunks, hunk)
+			edit.NoNewline = edit.NoNewline || noNewline
+			edit.AddNewline = edit.AddNewline || oldNoNewline && !noNewline
+			i = next
+			for i < len(lines) && lines[i] == "" {
+				i++
+			}
+		}
+
+		if len(edit.Hunks) == 0 && !edit.Create {
+			return nil, fmt.Errorf("line %d: diff for %s has no hunks", edit.Line, edit.Path)
+		}
+		edits = append(edits, edit)
+	}
+	return edits, nil
+}
+
+// readHunk reads the hunk whose header is lines[i] and returns the line
+// after it, and whether "\ No newline at end of file" follows the last
+// line of the old file and of the new one. When counted, the header's
+// line counts say where the hunk ends. Otherwise, or when the header has
+// no counts ("@@ ... @@"), it runs to the first line that can't be part
+// of a hunk, less any trailing blank lines.
+func readHunk(lines []string, i int, counted bool) (hunk Hunk, oldNoNewline, noNewline bool, next int) {
+	oldCount, newCount := 1, 1
+	if m := hunkHeaderPattern.FindStringSubmatch(lines[i]); m != nil {
+		hunk.OldStart, _ = strconv.Atoi(m[1])
+		if m[2] != "" {
+			oldCount, _ = strconv.Atoi(m[2])
+		}
+		if m[3] != "" {
+			newCount, _ = strconv.Atoi(m[3])
+		}
+	} else {
+		counted = false
+	}
+	i++
+
+	blank := 0
+	for i < len(lines) && isHunkLine(lines[i]) && !isDiffStart(lines, i) {
+		line := lines[i]
+		if counted && oldCount <= 0 && newCount <= 0 && !strings.HasPrefix(line, "\\") {
+			break
+		}
+		i++
+
+		switch {
+		case line == "" && !counted:
+			blank++
+			continue
+		case line == "":
+			line = " "
+		case line[0] == '\\':
+			// "\ No newline at end of file" after the last line of the old
+			// file, the new one, or both for a context line
+			if n := len(hunk.Lines); n > 0 {
+				oldNoNewline = oldNoNewline || hunk.Lines[n-1][0] != '+'
+				noNewline = noNewline || hunk.Lines[n-1][0] != '-'
+			}
+			continue
+		}
+
+		for ; blank > 0; blank-- {
+			hunk.Lines = append(hunk.Lines, " ")
+		}
+		hunk.Lines = append(hunk.Lines, line)
+		switch line[0] {
+		case ' ':
+			oldCount--
+			newCount--
+		case '-':
+			oldCount--
+		case '+':
+			newCount--
+		}
+	}
+	return hunk, oldNoNewline, noNewline, i
+}
+
+// diffPath reads the path of a ---/+++ line, dropping any timestamp
+func diffPath(s string) string {
+	s, _, _ = strings.Cut(s, "\t")
+	return strings.TrimSpace(s)
+}
+
+// applyHunks applies hunks in order. Each must match the current lines
+// exactly, or failing that up to trailing whitespace; the header's line
+// number only says where to start looking.
+func applyHunks(lines []string, hunks []Hunk) ([]string, error) {
+	var out []string
+	pos := 0
+
+	for n, h := range hunks {
+		var old []string
+		for _, line := range h.Lines {
+			if line[0] != '+' {
+				old = append(old, line[1:])
+			}
+		}
+
+		at := findBlock(lines, old, pos, h.OldStart-1)
+		if at < 0 {
+			return nil, fmt.Errorf("hunk %d (@@ -%d) doesn't match the current file", n+1, h.OldStart)
+		}
+		out = append(out, lines[pos:at]...)
+
+		// Context lines keep the file's text, which may differ from the
+		// hunk's in trailing whitespace
+		pos = at
+		for _, line := range h.Lines {
+			switch line[0] {
+			case ' ':
+				out = append(out, lines[pos])
+				pos++
+			case '-':
+				pos++
+			case '+':
+				out = append(out, line[1:])
+			}
+		}
+	}
+	return append(out, lines[pos:]...), nil
+}
+
+// findBlock returns where block occurs in lines at or after from,
+// preferring the occurrence closest to hint, or -1
+func findBlock(lines, block []string, from, hint int) int {
+	last := len(lines) - len(block)
+	if last < from {
+		return -1
+	}
+	hint = min(max(hint, from), last)
+	if len(block) == 0 {
+		return hint
+	}
+
+	for _, equal := range []func(a, b string) bool{
+		func(a, b string) bool { return a == b },
+		func(a, b string) bool { return strings.TrimRight(a, " \t") == strings.TrimRight(b, " \t") },
+	} {
+		for d := 0; hint-d >= from || hint+d <= last; d++ {
+			for _, at := range []int{hint - d, hint + d} {
+				if at >= from && at <= last && blockAt(lines, block, at, equal) {
+					return at
+				}
+			}
+		}
+	}
+	return -1
+}
+
+func blockAt(lines, block []string, at int, equal func(a, b string) bool) bool {
+	for i, line := range block {
+		if !equal(lines[at+i], line) {
+			return false
+		}
+	}
+	return true
+}
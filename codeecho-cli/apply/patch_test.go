@@ -0,0 +1,245 @@
+package apply
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDiffs(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     Edit
+	}{
+		{
+			name:     "fenced",
+			response: "```diff\n--- a/main.go\n+++ b/main.go\n@@ -1,2 +1,2 @@\n package main\n-var x = 1\n+var x = 2\n```\n",
+			want: Edit{Path: "main.go", Kind: KindDiff, Line: 2, Hunks: []Hunk{
+				{OldStart: 1, Lines: []string{" package main", "-var x = 1", "+var x = 2"}},
+			}},
+		},
+		{
+			name:     "unfenced with git headers",
+			response: "Here you go:\ndiff --git a/main.go b/main.go\nindex 1..2 100644\n--- a/main.go\n+++ b/main.go\n@@ -3 +3 @@\n-a\n+b\nThat's it.\n",
+			want: Edit{Path: "main.go", Kind: KindDiff, Line: 4, Hunks: []Hunk{
+				{OldStart: 3, Lines: []string{"-a", "+b"}},
+			}},
+		},
+		{
+			name:     "wrong counts in a block",
+			response: "```diff\n--- a/main.go\n+++ b/main.go\n@@ -1,1 +1,1 @@\n a\n-b\n+c\n d\n```\n",
+			want: Edit{Path: "main.go", Kind: KindDiff, Line: 2, Hunks: []Hunk{
+				{OldStart: 1, Lines: []string{" a", "-b", "+c", " d"}},
+			}},
+		},
+		{
+			name:     "create",
+			response: "```diff\n--- /dev/null\n+++ b/cmd/new.go\n@@ -0,0 +1,2 @@\n+package cmd\n+\n```\n",
+			want: Edit{Path: "cmd/new.go", Kind: KindDiff, Line: 2, Create: true, Hunks: []Hunk{
+				{Lines: []string{"+package cmd", "+"}},
+			}},
+		},
+		{
+			name:     "delete",
+			response: "--- a/old.go\n+++ /dev/null\n@@ -1,2 +0,0 @@\n-package old\n-\n",
+			want: Edit{Path: "old.go", Kind: KindDiff, Line: 1, Delete: true, Hunks: []Hunk{
+				{OldStart: 1, Lines: []string{"-package old", "-"}},
+			}},
+		},
+		{
+			name:     "no newline in the new file",
+			response: "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-x\n+y\n\\ No newline at end of file\n",
+			want: Edit{Path: "a.txt", Kind: KindDiff, Line: 1, NoNewline: true, Hunks: []Hunk{
+				{OldStart: 1, Lines: []string{"-x", "+y"}},
+			}},
+		},
+		{
+			name:     "newline added",
+			response: "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-x\n\\ No newline at end of file\n+x\n",
+			want: Edit{Path: "a.txt", Kind: KindDiff, Line: 1, AddNewline: true, Hunks: []Hunk{
+				{OldStart: 1, Lines: []string{"-x", "+x"}},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edit := parseOne(t, tt.response)
+			if !reflect.DeepEqual(edit, tt.want) {
+				t.Errorf("got  %+v\nwant %+v", edit, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDiffFencedWithNestedFences(t *testing.T) {
+	response := "```diff\n--- a/README.md\n+++ b/README.md\n@@ -1,4 +1,4 @@\n ```sh\n-make\n+make test\n ```\n```\n"
+	edit := parseOne(t, response)
+	want := []string{" ```sh", "-make", "+make test", " ```"}
+	if len(edit.Hunks) != 1 || !reflect.DeepEqual(edit.Hunks[0].Lines, want) {
+		t.Errorf("got hunks %+v, want one with lines %q", edit.Hunks, want)
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name       string
+		current    string
+		exists     bool
+		response   string
+		want       string
+		wantRemove bool
+	}{
+		{
+			name:     "modify",
+			current:  "package main\n\nvar x = 1\n",
+			exists:   true,
+			response: "--- a/main.go\n+++ b/main.go\n@@ -3 +3 @@\n-var x = 1\n+var x = 2\n",
+			want:     "package main\n\nvar x = 2\n",
+		},
+		{
+			name:     "hunk line number off",
+			current:  "a\nb\nc\nd\ne\n",
+			exists:   true,
+			response: "--- a/main.go\n+++ b/main.go\n@@ -1,2 +1,2 @@\n d\n-e\n+f\n",
+			want:     "a\nb\nc\nd\nf\n",
+		},
+		{
+			name:     "trailing whitespace differs",
+			current:  "a  \nb\n",
+			exists:   true,
+			response: "--- a/main.go\n+++ b/main.go\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n",
+			want:     "a  \nc\n",
+		},
+		{
+			name:     "CRLF file and diff",
+			current:  "one\r\ntwo\r\nthree\r\n",
+			exists:   true,
+			response: "--- a/main.go\r\n+++ b/main.go\r\n@@ -2 +2 @@\r\n-two\r\n+2\r\n",
+			want:     "one\r\n2\r\nthree\r\n",
+		},
+		{
+			name:     "CRLF file and LF block",
+			current:  "one\r\ntwo\r\n",
+			exists:   true,
+			response: "### main.go\n```\none\n2\n```\n",
+			want:     "one\r\n2\r\n",
+		},
+		{
+			name:     "block keeps missing final newline",
+			current:  "one",
+			exists:   true,
+			response: "### main.go\n```\ntwo\n```\n",
+			want:     "two",
+		},
+		{
+			name:     "no newline at end of new file",
+			current:  "x\n",
+			exists:   true,
+			response: "--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-x\n+y\n\\ No newline at end of file\n",
+			want:     "y",
+		},
+		{
+			name:     "no newline at end of either file",
+			current:  "a\nx",
+			exists:   true,
+			response: "--- a/main.go\n+++ b/main.go\n@@ -1,2 +1,2 @@\n-a\n+b\n x\n\\ No newline at end of file\n",
+			want:     "b\nx",
+		},
+		{
+			name:     "newline added at end of file",
+			current:  "a\nx",
+			exists:   true,
+			response: "--- a/main.go\n+++ b/main.go\n@@ -2 +2 @@\n-x\n\\ No newline at end of file\n+x\n",
+			want:     "a\nx\n",
+		},
+		{
+			name:     "create",
+			response: "```diff\n--- /dev/null\n+++ b/main.go\n@@ -0,0 +1,2 @@\n+package main\n+\n```\n",
+			want:     "package main\n\n",
+		},
+		{
+			name:       "delete",
+			current:    "package main\n\nfunc main() {}\n",
+			exists:     true,
+			response:   "--- a/main.go\n+++ /dev/null\n@@ -1,3 +0,0 @@\n-package main\n-\n-func main() {}\n",
+			wantRemove: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, remove, err := Apply(tt.current, tt.exists, []Edit{parseOne(t, tt.response)})
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			if got != tt.want || remove != tt.wantRemove {
+				t.Errorf("got %q (remove %t), want %q (remove %t)", got, remove, tt.want, tt.wantRemove)
+			}
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  string
+		exists   bool
+		response string
+		want     string
+	}{
+		{
+			name:     "conflict",
+			current:  "a\nb\nc\n",
+			exists:   true,
+			response: "--- a/main.go\n+++ b/main.go\n@@ -2 +2 @@\n-B\n+b2\n",
+			want:     "hunk 1 (@@ -2) doesn't match the current file",
+		},
+		{
+			name:     "hunks out of order",
+			current:  "a\nb\nc\n",
+			exists:   true,
+			response: "--- a/main.go\n+++ b/main.go\n@@ -3 +3 @@\n-c\n+C\n@@ -1 +1 @@\n-a\n+A\n",
+			want:     "hunk 2 (@@ -1) doesn't match",
+		},
+		{
+			name:     "create over an existing file",
+			current:  "x\n",
+			exists:   true,
+			response: "--- /dev/null\n+++ b/main.go\n@@ -0,0 +1 @@\n+y\n",
+			want:     "already exists",
+		},
+		{
+			name:     "modify a missing file",
+			response: "--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-x\n+y\n",
+			want:     "doesn't exist",
+		},
+		{
+			name:     "delete leaves lines",
+			current:  "a\nb\n",
+			exists:   true,
+			response: "--- a/main.go\n+++ /dev/null\n@@ -1 +0,0 @@\n-a\n",
+			want:     "leaves lines",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Apply(tt.current, tt.exists, []Edit{parseOne(t, tt.response)})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyAfterDelete(t *testing.T) {
+	edits, _, err := Parse("--- a/x.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-a\n### x.txt\n```\nb\n```\n")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if _, _, err := Apply("a\n", true, edits); err == nil || !strings.Contains(err.Error(), "already deleted") {
+		t.Errorf("got error %v, want one saying x.txt was already deleted", err)
+	}
+}
@@ -0,0 +1,191 @@
+package apply
+
+import (
+	"fmt"
+	"strings"
+)
+
+// previewContext is the number of unchanged lines shown around a change
+const previewContext = 3
+
+// maxDiffCells bounds the line comparison table. Past it the changed
+// middle of the file is shown as removed and re-added in one piece.
+const maxDiffCells = 4_000_000
+
+// diffOp is one line of an edit script: ' ', '-' or '+' and the line
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// Diff renders a unified diff from before to after for previews, with the
+// number of added and removed lines. created and removed switch the
+// file headers to /dev/null.
+func Diff(path, before, after string, created, removed bool) (text string, added, deleted int) {
+	oldLines, _ := splitLines(strings.ReplaceAll(before, "\r\n", "\n"))
+	newLines, _ := splitLines(strings.ReplaceAll(after, "\r\n", "\n"))
+	ops := diffLines(oldLines, newLines)
+
+	for _, op := range ops {
+		switch op.kind {
+		case '+':
+			added++
+		case '-':
+			deleted++
+		}
+	}
+	if added == 0 && deleted == 0 {
+		return "", 0, 0
+	}
+
+	var b strings.Builder
+	from, to := "a/"+path, "b/"+path
+	if created {
+		from = "/dev/null"
+	}
+	if removed {
+		to = "/dev/null"
+	}
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", from, to)
+
+	// Group changes that are close together into hunks
+	for start := 0; start < len(ops); {
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+
+		begin := max(first-previewContext, start)
+		end := first
+		for i := first; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				end = i + 1
+			} else if i-end >= 2*previewContext {
+				break
+			}
+		}
+		end = min(end+previewContext, len(ops))
+
+		oldStart, newStart := lineNumbers(ops, begin)
+		oldCount, newCount := 0, 0
+		for _, op := range ops[begin:end] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		for _, op := range ops[begin:end] {
+			fmt.Fprintf(&b, "%c%s\n", op.kind, op.line)
+		}
+		start = end
+	}
+	return b.String(), added, deleted
+}
+
+// lineNumbers returns the 1-based old and new line numbers of ops[i]
+func lineNumbers(ops []diffOp, i int) (int, int) {
+	oldLine, newLine := 1, 1
+	for _, op := range ops[:i] {
+		if op.kind != '+' {
+			oldLine++
+		}
+		if op.kind != '-' {
+			newLine++
+		}
+	}
+	return oldLine, newLine
+}
+
+// hunkRange formats a @@ range; an empty range names the line before it
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// diffLines finds a shortest edit script from a to b via the longest
+// common subsequence of the lines between their common prefix and suffix
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(midA)*len(midB) > maxDiffCells {
+		for _, line := range midA {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range midB {
+			ops = append(ops, diffOp{'+', line})
+		}
+	} else {
+		ops = append(ops, lcsDiff(midA, midB)...)
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// lcsDiff builds the edit script from a table of common subsequence
+// lengths of every pair of suffixes
+func lcsDiff(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	table := make([]int32, (n+1)*(m+1))
+	at := func(i, j int) *int32 { return &table[i*(m+1)+j] }
+
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				*at(i, j) = *at(i+1, j+1) + 1
+			} else {
+				*at(i, j) = max(*at(i+1, j), *at(i, j+1))
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case *at(i+1, j) >= *at(i, j+1):
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
@@ -0,0 +1,367 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/opskraken/codeecho-cli/apply"
+	"github.com/opskraken/codeecho-cli/output"
+	"github.com/opskraken/codeecho-cli/scanner"
+	"github.com/opskraken/codeecho-cli/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	applyDryRun bool
+	applyPacks  []string
+	applyRoot   string
+	applyForce  bool
+)
+
+// applyCmd writes the file edits of a model response to the working tree
+var applyCmd = &cobra.Command{
+	Use:   "apply <response>",
+	Short: "Apply file edits from a model response to the working tree",
+	Long: `Apply the file edits in a model response to the working tree.
+
+Three shapes of edit are recognized:
+• <file path="..."> elements, as in the XML pack
+• fenced code blocks headed by a path (a "### cmd/scan.go" line above the
+  block, or "` + "```go path=cmd/scan.go" + `")
+• unified diffs, fenced or not
+
+Pass the pack the model was given with --pack to detect files that changed
+since it was made; their edits are conflicts and nothing is written. Diffs
+whose context no longer matches are conflicts too. So are whole-file edits
+of files the pack only held in part (compressed, trimmed to the token
+budget or with secrets redacted), which would write the loss back, and
+edits that add [REDACTED:...] placeholders. Use --dry-run to preview the
+changes as a diff first.
+
+Examples:
+  codeecho apply response.md --pack repo.xml --dry-run
+  codeecho apply response.md --pack repo.xml
+  pbpaste | codeecho apply - --pack repo.xml`,
+	Args: cobra.ExactArgs(1),
+	RunE: runApply,
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+
+	applyCmd.Flags().BoolVar(&applyDryRun, "dry-run", false, "Show a diff of every change without writing anything")
+	applyCmd.Flags().StringArrayVar(&applyPacks, "pack", nil, "Pack the response was made from, to detect files changed since (repeatable for split packs)")
+	applyCmd.Flags().StringVar(&applyRoot, "root", ".", "Directory the packed paths are relative to")
+	applyCmd.Flags().BoolVar(&applyForce, "force", false, "Apply edits to files that changed since the pack was made, or that it held in part")
+}
+
+// fileChange is the combined outcome of the edits to one file
+type fileChange struct {
+	path     string
+	target   string
+	edits    []apply.Edit
+	before   string
+	after    string
+	exists   bool
+	remove   bool
+	changed  string // Why the file differs from the packed one; forceable
+	lossy    string // Why a whole-file edit would lose content the pack left out; forceable
+	conflict string // Why the edits can't be applied
+	checked  bool   // A hash was there to compare with
+}
+
+func runApply(cmd *cobra.Command, args []string) error {
+	response, err := readResponse(args[0])
+	if err != nil {
+		return err
+	}
+	edits, skipped, err := apply.Parse(response)
+	if err != nil {
+		return err
+	}
+	if len(edits) == 0 {
+		return fmt.Errorf("no file edits found in %s", args[0])
+	}
+
+	packed, err := packFiles(applyPacks)
+	if err != nil {
+		return err
+	}
+	root, err := filepath.Abs(applyRoot)
+	if err != nil {
+		return fmt.Errorf("failed to resolve root directory: %w", err)
+	}
+
+	// Edits to the same file apply in response order
+	var changes []*fileChange
+	byPath := make(map[string]*fileChange)
+	for _, edit := range edits {
+		change, ok := byPath[edit.Path]
+		if !ok {
+			change = &fileChange{path: edit.Path, target: filepath.Join(root, filepath.FromSlash(edit.Path))}
+			byPath[edit.Path] = change
+			changes = append(changes, change)
+		}
+		change.edits = append(change.edits, edit)
+	}
+
+	conflicts, changedFiles, lossyFiles, unchecked := 0, 0, 0, 0
+	for _, change := range changes {
+		if err := prepareChange(change, packed); err != nil {
+			return err
+		}
+		switch {
+		case change.conflict != "":
+			conflicts++
+		case change.changed != "":
+			changedFiles++
+		case change.lossy != "":
+			lossyFiles++
+		}
+		if change.exists && !change.checked {
+			unchecked++
+		}
+	}
+
+	// Diffs go to stdout so they can be piped; the status goes to stderr
+	if applyDryRun {
+		for _, change := range changes {
+			if change.conflict != "" {
+				continue
+			}
+			if diff, _, _ := apply.Diff(change.path, change.before, change.after, !change.exists, change.remove); diff != "" {
+				fmt.Print(diff)
+			}
+		}
+	}
+	if err := printApplyStatus(changes); err != nil {
+		return err
+	}
+
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "\n%d code block(s) without a file path were ignored\n", skipped)
+	}
+	if unchecked > 0 && len(applyPacks) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d file(s) have no hash in the pack; changes since it was made can't be detected\n", unchecked)
+	} else if unchecked > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: no --pack given; changes made since the pack can't be detected\n")
+	}
+
+	if conflicts > 0 {
+		return fmt.Errorf("%d file(s) have conflicts; nothing was written", conflicts)
+	}
+	if changedFiles > 0 && !applyForce {
+		return fmt.Errorf("%d file(s) changed since the pack was made; nothing was written (use --force to apply anyway)", changedFiles)
+	}
+	if lossyFiles > 0 && !applyForce {
+		return fmt.Errorf("%d file(s) would be replaced with content the pack only held in part; nothing was written (use --force to apply anyway)", lossyFiles)
+	}
+	if applyDryRun {
+		fmt.Fprintln(os.Stderr, "\nDry run: no files were changed")
+		return nil
+	}
+
+	written := 0
+	for _, change := range changes {
+		if change.exists && !change.remove && change.after == change.before {
+			continue
+		}
+		if err := writeChange(root, change); err != nil {
+			return err
+		}
+		written++
+	}
+	fmt.Fprintf(os.Stderr, "\nApplied %d edit(s) to %d file(s)\n", len(edits), written)
+	return nil
+}
+
+// readResponse reads a response file, or stdin for "-"
+func readResponse(name string) (string, error) {
+	var data []byte
+	var err error
+	if name == stdoutPath {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	return string(data), nil
+}
+
+// packedFile is what a pack says about a file an edit was made from
+type packedFile struct {
+	hash  string
+	lossy string // Why the packed content isn't the whole file; empty when it is
+}
+
+// packFiles maps the paths of the given packs to their content hashes and
+// to how unpacking them would fall short of the original
+func packFiles(names []string) (map[string]packedFile, error) {
+	var packs []*output.Pack
+	for _, name := range names {
+		pack, err := readPackFile(name, "")
+		if err != nil {
+			return nil, err
+		}
+		packs = append(packs, pack)
+	}
+	entries, err := output.PlanUnpack(packs)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]packedFile)
+	for _, entry := range entries {
+		switch entry.Issue {
+		case output.UnpackCompressed, output.UnpackTruncated, output.UnpackStructureOnly, output.UnpackRedacted:
+			files[entry.Path] = packedFile{lossy: lossyNote(entry.Issue, entry.Detail)}
+		}
+	}
+	for _, pack := range packs {
+		for _, file := range pack.Files {
+			rel, err := utils.SafeRelativePath(file.RelativePath)
+			if err == nil && file.Hash != "" {
+				f := files[rel]
+				f.hash = file.Hash
+				files[rel] = f
+			}
+		}
+	}
+	return files, nil
+}
+
+func lossyNote(issue, detail string) string {
+	return fmt.Sprintf("%s in the pack (%s); a whole-file edit would write that back", issue, detail)
+}
+
+// prepareChange reads the current file, checks it against the hash it
+// was packed with and runs the edits
+func prepareChange(change *fileChange, packed map[string]packedFile) error {
+	data, err := os.ReadFile(change.target)
+	switch {
+	case err == nil:
+		change.exists = true
+		change.before = string(data)
+	case !errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("failed to read %s: %w", change.path, err)
+	}
+
+	// A hash repeated in the response wins over the pack's
+	want := packed[change.path].hash
+	if hash := change.edits[0].Hash; hash != "" {
+		want = hash
+	}
+	if want != "" {
+		change.checked = true
+		switch {
+		case !change.exists:
+			change.changed = "deleted since the pack was made"
+		case scanner.ContentHash(change.before) != want:
+			change.changed = "changed since the pack was made"
+		}
+	}
+
+	// Whole-file edits start from the packed content, so they would write
+	// back anything the pack left out. The response's <file> attributes
+	// say so too when no pack is given.
+	for _, edit := range change.edits {
+		if edit.Kind != apply.KindFile || !change.exists {
+			continue
+		}
+		switch {
+		case edit.BudgetAction == scanner.BudgetActionTruncated || edit.BudgetAction == scanner.BudgetActionStructureOnly:
+			change.lossy = lossyNote(edit.BudgetAction, "trimmed to fit the token budget")
+		case edit.Compression != "":
+			change.lossy = lossyNote(output.UnpackCompressed, edit.Compression)
+		default:
+			change.lossy = packed[change.path].lossy
+		}
+		if change.lossy != "" {
+			break
+		}
+	}
+
+	change.after, change.remove, err = apply.Apply(change.before, change.exists, change.edits)
+	if err != nil {
+		change.conflict = err.Error()
+	} else if placeholder := addedPlaceholder(change.before, change.after); placeholder != "" {
+		change.conflict = fmt.Sprintf("the edit writes %s, a placeholder for a secret the pack redacted", placeholder)
+	}
+	return nil
+}
+
+// addedPlaceholder returns a [REDACTED:rule] placeholder that after holds
+// more often than before, or ""
+func addedPlaceholder(before, after string) string {
+	for _, placeholder := range scanner.RedactedPattern.FindAllString(after, -1) {
+		if strings.Count(after, placeholder) > strings.Count(before, placeholder) {
+			return placeholder
+		}
+	}
+	return ""
+}
+
+// printApplyStatus lists every file with what happens to it on stderr
+func printApplyStatus(changes []*fileChange) error {
+	tw := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tPATH\tLINES\tNOTE")
+	for _, change := range changes {
+		_, added, deleted := apply.Diff(change.path, change.before, change.after, !change.exists, change.remove)
+		status, lines, note := "modify", fmt.Sprintf("+%d -%d", added, deleted), change.changed
+		if note == "" {
+			note = change.lossy
+		}
+
+		switch {
+		case change.conflict != "":
+			status, lines, note = "conflict", "-", change.conflict
+		case change.remove:
+			status = "delete"
+		case !change.exists:
+			status = "create"
+		case added == 0 && deleted == 0:
+			status = "unchanged"
+		}
+		if change.conflict == "" && (change.changed != "" || change.lossy != "") && !applyForce {
+			status = "conflict"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", status, change.path, lines, note)
+	}
+	return tw.Flush()
+}
+
+// writeChange writes or deletes one file, keeping its permissions
+func writeChange(root string, change *fileChange) error {
+	if change.remove {
+		if err := checkInsideRoot(root, change.path); err != nil {
+			return err
+		}
+		if err := os.Remove(change.target); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", change.path, err)
+		}
+		return nil
+	}
+
+	mode := fs.FileMode(0644)
+	if info, err := os.Stat(change.target); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := makeDirInsideRoot(root, change.path); err != nil {
+		return err
+	}
+	if err := checkInsideRoot(root, change.path); err != nil {
+		return err
+	}
+	if err := os.WriteFile(change.target, []byte(change.after), mode); err != nil {
+		return fmt.Errorf("failed to write %s: %w", change.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/opskraken/codeecho-cli/config"
+	"github.com/spf13/cobra"
+)
+
+// configCmd groups configuration helpers
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect CodeEcho configuration",
+	Long: `Inspect the configuration CodeEcho resolves for a directory.
+
+Settings are read, lowest precedence first, from:
+  1. Built-in defaults
+  2. $XDG_CONFIG_HOME/codeecho/config.yaml (or ~/.config/codeecho/config.yaml)
+  3. .codeecho.yaml in the scanned directory or its nearest parent (or --config)
+  4. The profile selected with --profile or CODEECHO_PROFILE
+  5. CODEECHO_* environment variables (e.g. CODEECHO_REMOVE_COMMENTS=true)
+  6. Command-line flags`,
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show [path]",
+	Short: "Print the effective configuration and where each value came from",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runConfigShow,
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configShowCmd)
+}
+
+// flagBinding ties a config setting to the flag variable that overrides it
+type flagBinding struct {
+	key    string
+	flag   string
+	target interface{} // *bool, *string, *int or *[]string
+	invert bool        // Flag is the negation of the setting (e.g. --no-gitignore)
+}
+
+// loadConfig resolves the configuration for a scanned directory using the
+// global --config and --profile flags
+func loadConfig(projectDir string) (*config.Config, error) {
+	return config.Load(config.LoadOptions{
+		ConfigFile: cfgFile,
+		ProjectDir: projectDir,
+		Profile:    profileName,
+	})
+}
+
+// applyConfig merges flags and configuration. Flags set on the command line
+// are recorded in cfg (so it reflects the effective values); every other
+// bound variable is filled from cfg.
+func applyConfig(cmd *cobra.Command, cfg *config.Config, bindings []flagBinding) error {
+	for _, b := range bindings {
+		f := cmd.Flags().Lookup(b.flag)
+		if f == nil || !f.Changed {
+			continue
+		}
+
+		var value interface{}
+		switch target := b.target.(type) {
+		case *bool:
+			value = *target != b.invert
+		case *string:
+			value = *target
+		case *int:
+			value = *target
+		case *[]string:
+			value = *target
+		}
+		if err := cfg.Set(b.key, value, "flag --"+b.flag); err != nil {
+			return err
+		}
+	}
+
+	for _, b := range bindings {
+		switch target := b.target.(type) {
+		case *bool:
+			*target = cfg.Bool(b.key) != b.invert
+		case *string:
+			*target = cfg.String(b.key)
+		case *int:
+			*target = cfg.Int(b.key)
+		case *[]string:
+			*target = cfg.Strings(b.key)
+		}
+	}
+
+	return nil
+}
+
+func runConfigShow(cmd *cobra.Command, args []string) error {
+	targetPath := "."
+	if len(args) > 0 {
+		targetPath = args[0]
+	}
+
+	absPath, err := filepath.Abs(targetPath)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	cfg, err := loadConfig(absPath)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Profile != "" {
+		fmt.Printf("Profile: %s\n", cfg.Profile)
+	}
+	if len(cfg.Files) > 0 {
+		fmt.Println("Config files:")
+		for _, file := range cfg.Files {
+			fmt.Printf("  %s\n", file)
+		}
+	} else {
+		fmt.Println("Config files: none found")
+	}
+	fmt.Println()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SETTING\tVALUE\tSOURCE")
+	for _, key := range config.Keys() {
+		value := cfg.Get(key)
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", key, config.FormatValue(value.Value), value.Source)
+	}
+	return tw.Flush()
+}
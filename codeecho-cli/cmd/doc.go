@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/opskraken/codeecho-cli/config"
 	"github.com/opskraken/codeecho-cli/output"
 	"github.com/opskraken/codeecho-cli/scanner"
 	"github.com/opskraken/codeecho-cli/utils"
@@ -16,6 +17,10 @@ import (
 var (
 	docOutputFile string
 	docType       string
+
+	docIncludePatterns []string
+	docIgnorePatterns  []string
+	docNoGitignore     bool
 )
 
 // ScanResult is an alias for scanner.ScanResult for backward compatibility
@@ -42,23 +47,42 @@ func init() {
 	rootCmd.AddCommand(docCmd)
 
 	// Add flags
-	docCmd.Flags().StringVarP(&docOutputFile, "output", "o", "", "Output file (default: README.md)")
+	docCmd.Flags().StringVarP(&docOutputFile, "output", "o", "", "Output file, or - for stdout (default: README.md)")
 	docCmd.Flags().StringVarP(&docType, "type", "t", "readme", "Documentation type: readme, api, overview")
+	docCmd.Flags().StringArrayVar(&docIncludePatterns, "include", nil, "Only analyze paths matching this glob (repeatable)")
+	docCmd.Flags().StringArrayVar(&docIgnorePatterns, "ignore", nil, "Skip paths matching this glob (repeatable)")
+	docCmd.Flags().BoolVar(&docNoGitignore, "no-gitignore", false, "Don't apply .gitignore rules (.codeechoignore still applies)")
+}
+
+// docBindings lets doc's filter flags override the shared configuration
+var docBindings = []flagBinding{
+	{key: config.KeyInclude, flag: "include", target: &docIncludePatterns},
+	{key: config.KeyIgnore, flag: "ignore", target: &docIgnorePatterns},
+	{key: config.KeyGitignore, flag: "no-gitignore", target: &docNoGitignore, invert: true},
 }
 
 // scanRepository uses AnalysisScanner for full repository analysis
-func scanRepository(path string) (*ScanResult, error) {
+func scanRepository(path string, cfg *config.Config) (*ScanResult, error) {
+	compress, err := scanner.ParseCompressMode(cfg.CompressMode())
+	if err != nil {
+		return nil, err
+	}
+
 	opts := scanner.ScanOptions{
-		IncludeSummary:       true,
-		IncludeDirectoryTree: true,
-		ShowLineNumbers:      false,
-		OutputParsableFormat: true,
-		CompressCode:         false,
-		RemoveComments:       false,
-		RemoveEmptyLines:     false,
-		ExcludeDirs:          []string{".git", "node_modules", "vendor", ".vscode", ".idea", "target", "build", "dist"},
-		IncludeExts:          []string{".go", ".js", ".ts", ".jsx", ".tsx", ".json", ".md", ".html", ".css", ".py", ".java", ".cpp", ".c", ".h", ".rs", ".rb", ".php", ".yml", ".yaml", ".toml", ".xml"},
+		IncludeSummary:       cfg.Bool(config.KeyIncludeSummary),
+		IncludeDirectoryTree: cfg.Bool(config.KeyIncludeTree),
+		ShowLineNumbers:      cfg.Bool(config.KeyLineNumbers),
+		OutputParsableFormat: cfg.Bool(config.KeyParsable),
+		Compress:             compress,
+		RemoveComments:       cfg.Bool(config.KeyRemoveComments) || cfg.Bool(config.KeyKeepDocComments),
+		RemoveEmptyLines:     cfg.Bool(config.KeyRemoveEmptyLines),
+		KeepDocComments:      cfg.Bool(config.KeyKeepDocComments),
+		ExcludeDirs:          cfg.Strings(config.KeyExcludeDirs),
+		IncludeExts:          cfg.Strings(config.KeyIncludeExts),
 		IncludeContent:       true, // Doc needs content for analysis
+		IncludePatterns:      cfg.Strings(config.KeyInclude),
+		IgnorePatterns:       cfg.Strings(config.KeyIgnore),
+		UseGitignore:         cfg.Bool(config.KeyGitignore),
 	}
 
 	// Use analysis scanner (not streaming) for full in-memory analysis
@@ -92,10 +116,25 @@ func runDoc(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
-	fmt.Printf("Generating %s documentation for %s...\n", docType, absPath)
+	cfg, err := loadConfig(absPath)
+	if err != nil {
+		return err
+	}
+	if err := applyConfig(cmd, cfg, docBindings); err != nil {
+		return err
+	}
+
+	if err := scanner.ValidatePatterns(docIncludePatterns); err != nil {
+		return err
+	}
+	if err := scanner.ValidatePatterns(docIgnorePatterns); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Generating %s documentation for %s...\n", docType, absPath)
 
 	// First, scan the repository using AnalysisScanner
-	result, err := scanRepository(absPath)
+	result, err := scanRepository(absPath, cfg)
 	if err != nil {
 		return fmt.Errorf("scan failed: %w", err)
 	}
@@ -131,13 +170,18 @@ func runDoc(cmd *cobra.Command, args []string) error {
 	}
 
 	// Write documentation
-	err = os.WriteFile(outputFile, []byte(doc), 0644)
-	if err != nil {
+	if writesToStdout(docOutputFile) {
+		if _, err := os.Stdout.WriteString(doc); err != nil {
+			return fmt.Errorf("failed to write documentation: %w", err)
+		}
+		outputFile = "stdout"
+	} else if err := os.WriteFile(outputFile, []byte(doc), 0644); err != nil {
 		return fmt.Errorf("failed to write documentation file: %w", err)
 	}
 
-	fmt.Printf("Documentation written to %s\n", outputFile)
-	fmt.Printf("Documentation Summary: %d files analyzed\n", result.TotalFiles)
+	fmt.Fprintf(os.Stderr, "Documentation written to %s\n", outputFile)
+	stdoutHint(os.Stderr, docOutputFile)
+	fmt.Fprintf(os.Stderr, "Documentation Summary: %d files analyzed\n", result.TotalFiles)
 
 	return nil
 }
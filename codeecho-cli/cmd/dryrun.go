@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/opskraken/codeecho-cli/scanner"
+	"github.com/opskraken/codeecho-cli/utils"
+)
+
+// dryRunReport is the --dry-run --format json output
+type dryRunReport struct {
+	Root          string                 `json:"root"`
+	Tokenizer     string                 `json:"tokenizer"`
+	IncludedFiles int                    `json:"included_files"`
+	ExcludedPaths int                    `json:"excluded_paths"`
+	TotalSize     int64                  `json:"total_size"`   // Of the included files
+	TotalTokens   int                    `json:"total_tokens"` // Of the included files
+	Paths         []scanner.PathDecision `json:"paths"`
+}
+
+// runDryRun runs the writing pass with a scanner that discards files and
+// reports every include and exclude decision instead. Because it is the
+// same scanner, the explanation can't drift from what a real scan packs.
+func runDryRun(src packSource, opts scanner.ScanOptions, plan *scanner.BudgetPlan) error {
+	report := dryRunReport{Root: src.absPath, Paths: []scanner.PathDecision{}}
+
+	opts.IncludeDirectoryTree = false
+	dryRunner, err := src.newScanner(opts, func(*scanner.FileInfo) error { return nil })
+	if err != nil {
+		return err
+	}
+	if plan != nil {
+		dryRunner.SetBudgetPlan(plan)
+	}
+	dryRunner.SetDecisionHandler(func(d scanner.PathDecision) {
+		if d.Included {
+			report.IncludedFiles++
+			report.TotalSize += d.Size
+			report.TotalTokens += d.Tokens
+		} else {
+			report.ExcludedPaths++
+		}
+		report.Paths = append(report.Paths, d)
+	})
+
+	stats, err := src.scan(dryRunner, "dry-run")
+	if err != nil {
+		return fmt.Errorf("dry run failed: %w", err)
+	}
+	report.Tokenizer = stats.Tokenizer
+
+	if outputFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tPATH\tREASON\tSIZE\tTOKENS\tDETAIL")
+	for _, d := range report.Paths {
+		state, path := "exclude", filepath.ToSlash(d.Path)
+		if d.Included {
+			state = "include"
+		}
+		if d.Dir {
+			path += "/"
+		}
+
+		// Excluded files are never read, so only included ones have tokens
+		size, tokens := utils.FormatBytes(d.Size), fmt.Sprint(d.Tokens)
+		if !d.Included {
+			tokens = "-"
+		}
+		if d.Dir || (!d.Included && d.Size == 0) {
+			size = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", state, path, d.Reason, size, tokens, d.Detail)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%d file(s) included (%s, %d tokens, %s), %d path(s) excluded\n",
+		report.IncludedFiles, utils.FormatBytes(report.TotalSize), report.TotalTokens, report.Tokenizer, report.ExcludedPaths)
+	return nil
+}
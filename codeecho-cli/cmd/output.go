@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// stdoutPath is the --output value that writes to standard output
+const stdoutPath = "-"
+
+// writesToStdout reports whether output goes to stdout, asked for with "-o -"
+func writesToStdout(outputPath string) bool {
+	return outputPath == stdoutPath
+}
+
+// stdoutHint points at "-o -" when no file was named but stdout is piped,
+// as if the output was expected there. The default file is written anyway.
+func stdoutHint(w io.Writer, outputPath string) {
+	if outputPath == "" && !isTerminal(os.Stdout) {
+		fmt.Fprintln(w, "Hint: stdout is not a terminal; use -o - to write the output there instead")
+	}
+}
+
+// isTerminal reports whether f is a character device such as a TTY
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
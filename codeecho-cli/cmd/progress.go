@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/opskraken/codeecho-cli/scanner"
+	"github.com/opskraken/codeecho-cli/utils"
+)
+
+// Progress display modes for --progress
+const (
+	progressAuto = "auto" // Bar when stderr is a terminal, nothing otherwise
+	progressBar  = "bar"
+	progressJSON = "json" // One JSON event per line, for editors and CI
+	progressNone = "none"
+)
+
+// progressInterval throttles redraws and events; phase changes and the
+// end of a pass are always shown
+const progressInterval = 100 * time.Millisecond
+
+// Event types of --progress=json output
+const (
+	eventProgress = "progress"
+	eventMessage  = "message" // A status line, warning or the summary
+	eventError    = "error"   // The error the command failed with
+)
+
+// progressEvent is one line of --progress=json output
+type progressEvent struct {
+	Type string `json:"type"` // eventProgress
+	Pass string `json:"pass"` // "secrets", "budget", "split", "pack" or "dry-run"
+	scanner.ScanProgress
+	ElapsedMs      int64   `json:"elapsed_ms"`
+	BytesPerSecond float64 `json:"bytes_per_second"`
+	EtaMs          int64   `json:"eta_ms,omitempty"` // Only when the total is known
+	Done           bool    `json:"done,omitempty"`   // Last event of the pass
+}
+
+// messageEvent carries a line that would otherwise be printed to stderr,
+// so in JSON mode stderr holds nothing but events
+type messageEvent struct {
+	Type    string `json:"type"` // eventMessage or eventError
+	Message string `json:"message"`
+}
+
+// progressReporter renders scanner progress on stderr. A nil reporter
+// shows nothing, so passes can use it unconditionally.
+type progressReporter struct {
+	mode string
+	out  io.Writer
+
+	pass      string
+	start     time.Time
+	lastDraw  time.Time
+	lastPhase string
+	last      scanner.ScanProgress
+	drawn     bool // A bar line is on screen and needs ending
+}
+
+// newProgressReporter returns the reporter for a --progress mode, or nil
+// when progress is off (or auto and stderr is not a terminal)
+func newProgressReporter(mode string, quiet bool) (*progressReporter, error) {
+	switch mode {
+	case progressAuto, progressBar, progressJSON, progressNone:
+	default:
+		return nil, fmt.Errorf("unknown progress mode %q (supported: auto, bar, json, none)", mode)
+	}
+
+	if quiet || mode == progressNone || (mode == progressAuto && !isTerminal(os.Stderr)) {
+		return nil, nil
+	}
+	if mode == progressAuto {
+		mode = progressBar
+	}
+	return &progressReporter{mode: mode, out: os.Stderr}, nil
+}
+
+// track starts a pass and returns the callback for its scanner
+func (p *progressReporter) track(pass string) scanner.ProgressCallback {
+	if p == nil {
+		return nil
+	}
+	p.pass = pass
+	p.start = time.Now()
+	p.lastDraw = time.Time{}
+	p.lastPhase = ""
+	p.last = scanner.ScanProgress{}
+	return p.update
+}
+
+func (p *progressReporter) update(progress scanner.ScanProgress) {
+	p.last = progress
+	now := time.Now()
+	if progress.Phase == p.lastPhase && now.Sub(p.lastDraw) < progressInterval {
+		return
+	}
+	p.lastPhase = progress.Phase
+	p.lastDraw = now
+	p.render(false)
+}
+
+// finish shows the final state of the pass and ends the bar line.
+// stats, when the pass returned them, give the exact final counts.
+func (p *progressReporter) finish(stats *scanner.StreamingStats) {
+	if p == nil || p.pass == "" {
+		return
+	}
+	if stats != nil {
+		p.last.ProcessedFiles = stats.TotalFiles
+		p.last.BytesProcessed = stats.TotalSize
+	}
+	p.render(true)
+	if p.drawn {
+		fmt.Fprintln(p.out)
+		p.drawn = false
+	}
+	p.pass = ""
+}
+
+func (p *progressReporter) render(done bool) {
+	progress := p.last
+	if done {
+		progress.Phase = "done"
+		progress.CurrentFile = ""
+		if progress.TotalFiles > 0 {
+			progress.Percentage = 100
+		}
+	}
+
+	elapsed := time.Since(p.start)
+	var rate float64
+	if elapsed > 0 {
+		rate = float64(progress.BytesProcessed) / elapsed.Seconds()
+	}
+
+	if p.mode == progressJSON {
+		event := progressEvent{
+			Type:           eventProgress,
+			Pass:           p.pass,
+			ScanProgress:   progress,
+			ElapsedMs:      elapsed.Milliseconds(),
+			BytesPerSecond: rate,
+			Done:           done,
+		}
+		if !done && progress.TotalFiles > 0 && progress.ProcessedFiles > 0 {
+			fraction := float64(progress.ProcessedFiles) / float64(progress.TotalFiles)
+			event.EtaMs = (time.Duration(float64(elapsed)/fraction) - elapsed).Milliseconds()
+		}
+		p.emit(event)
+		return
+	}
+
+	var line strings.Builder
+	fmt.Fprintf(&line, "%-8s ", p.pass)
+	switch {
+	case progress.Phase == "collecting" || progress.Phase == "tree":
+		fmt.Fprintf(&line, "%s", progress.CurrentFile)
+	case progress.TotalFiles > 0:
+		fmt.Fprintf(&line, "%s %d/%d files", utils.CreateProgressBar(progress.ProcessedFiles, progress.TotalFiles, 20),
+			progress.ProcessedFiles, progress.TotalFiles)
+	default:
+		fmt.Fprintf(&line, "%d files", progress.ProcessedFiles)
+	}
+	if progress.BytesProcessed > 0 {
+		fmt.Fprintf(&line, "  %s/s", utils.FormatBytes(int64(rate)))
+	}
+	if done {
+		fmt.Fprintf(&line, "  done in %s", utils.FormatDuration(elapsed))
+	} else if progress.Phase == "scanning" && progress.TotalFiles > 0 {
+		fmt.Fprintf(&line, "  ETA %s", utils.EstimateTimeRemaining(progress.ProcessedFiles, progress.TotalFiles, elapsed))
+	}
+	if progress.Phase == "scanning" && !done {
+		fmt.Fprintf(&line, "  %s", shortenPath(progress.CurrentFile, 40))
+	}
+
+	// Return to the start of the line and clear what was there
+	fmt.Fprintf(p.out, "\r\x1b[K%s", line.String())
+	p.drawn = true
+}
+
+// emit writes one JSON event line
+func (p *progressReporter) emit(event any) {
+	line, _ := json.Marshal(event)
+	fmt.Fprintf(p.out, "%s\n", line)
+}
+
+// jsonEvents reports whether stderr is reserved for JSON events
+func (p *progressReporter) jsonEvents() bool {
+	return p != nil && p.mode == progressJSON
+}
+
+// stderr returns where status lines and warnings go: stderr itself, or
+// in JSON mode a writer that turns each line into a message event
+func (p *progressReporter) stderr() io.Writer {
+	if !p.jsonEvents() {
+		return os.Stderr
+	}
+	return &messageWriter{p: p}
+}
+
+// fail reports err as an error event in JSON mode and returns an error
+// that Execute exits with without printing it again
+func (p *progressReporter) fail(err error) error {
+	if err == nil || !p.jsonEvents() {
+		return err
+	}
+	p.emit(messageEvent{Type: eventError, Message: err.Error()})
+
+	code := 1
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.code
+	}
+	return &exitError{code: code, err: err, reported: true}
+}
+
+// messageWriter turns each line written to it into a message event.
+// Blank lines, which only space out the human output, are dropped.
+type messageWriter struct {
+	p       *progressReporter
+	pending []byte
+}
+
+func (w *messageWriter) Write(b []byte) (int, error) {
+	w.pending = append(w.pending, b...)
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		if line := strings.TrimRight(string(w.pending[:i]), " \r"); strings.TrimSpace(line) != "" {
+			w.p.emit(messageEvent{Type: eventMessage, Message: line})
+		}
+		w.pending = w.pending[i+1:]
+	}
+}
+
+// shortenPath keeps the end of a long path, which names the file
+func shortenPath(path string, width int) string {
+	runes := []rune(path)
+	if len(runes) <= width {
+		return path
+	}
+	return "…" + string(runes[len(runes)-width+1:])
+}
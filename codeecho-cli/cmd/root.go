@@ -2,6 +2,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -29,14 +30,41 @@ Perfect for:
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		var exitErr *exitError
+		if !errors.As(err, &exitErr) || !exitErr.reported {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+
+		if exitErr != nil {
+			os.Exit(exitErr.code)
+		}
 		os.Exit(1)
 	}
 }
 
+// exitIncomplete is the exit code of a --strict scan that skipped files;
+// every other failure exits with 1
+const exitIncomplete = 3
+
+// exitError fails a command with a specific exit code
+type exitError struct {
+	code     int
+	err      error
+	reported bool // Already shown, as a --progress=json error event
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+var (
+	cfgFile     string
+	profileName string
+)
+
 func init() {
 	// Global flags can be added here
-	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.codeecho.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is .codeecho.yaml in the scanned directory or a parent)")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "named profile from the config file to apply")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -1,14 +1,20 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/opskraken/codeecho-cli/config"
+	"github.com/opskraken/codeecho-cli/gitrepo"
 	"github.com/opskraken/codeecho-cli/output"
 	"github.com/opskraken/codeecho-cli/scanner"
+	"github.com/opskraken/codeecho-cli/tokens"
 	"github.com/opskraken/codeecho-cli/utils"
 	"github.com/spf13/cobra"
 )
@@ -17,21 +23,68 @@ var (
 	// Output format flags
 	outputFormat         string
 	outputFile           string
+	templatePath         string
 	includeSummary       bool
 	includeDirectoryTree bool
 	showLineNumbers      bool
+	tabWidth             int
+	lineEndings          string
 	outputParsableFormat bool
 
 	// File processing flags
 	compressCode     bool
+	compressMode     string
 	removeComments   bool
 	removeEmptyLines bool
+	keepDocComments  bool
 
 	// File filtering flags
 	excludeDirs    []string
 	includeExts    []string
 	includeContent bool
 	excludeContent bool
+	noGitignore    bool
+
+	includePatterns []string
+	ignorePatterns  []string
+
+	// Change set flags
+	sinceRef        string
+	stagedOnly      bool
+	workingTreeOnly bool
+	revision        string
+
+	tokenizerName string
+
+	// Token budget flags
+	maxTokens      int
+	budgetStrategy string
+	failOverBudget bool
+
+	// Split flags
+	splitSize   string
+	splitTokens int
+	splitBy     string
+
+	// Secret redaction flags
+	noRedact       bool
+	redactPatterns []string
+	failOnSecrets  bool
+
+	// Concurrency flags
+	jobs        int
+	maxInFlight string
+
+	dryRun bool
+
+	// Progress flags
+	progressMode string
+	quiet        bool
+
+	// Error reporting flags
+	includeErrors bool
+	reportFile    string
+	strict        bool
 )
 
 var scanCmd = &cobra.Command{
@@ -44,15 +97,39 @@ codebase in a format optimized for AI tools.
 Output Formats:
   xml        - Structured XML format (recommended for AI)
   json       - JSON format for programmatic use
+  jsonl      - JSON Lines: header, tree, file and stats records, one per line
   markdown   - Human-readable markdown format
+  plain      - Plain text with separator lines, for tools that handle neither
+  html       - Self-contained HTML report with a file tree, filter and highlighting
+  sqlite     - SQLite database with a files table and full-text search, to query with SQL
+
+Use --template to render the pack with your own Go text/template layout
+instead; the built-in layouts are in templates/ as examples.
 
 Examples:
   codeecho scan .                              # Basic XML scan
   codeecho scan . --format json               # JSON output
+  codeecho scan . -f jsonl -o - | jq -c 'select(.type == "file")'
+  codeecho scan . -f html -o report.html      # Report to browse offline
+  codeecho scan . -f sqlite -o scan.sqlite    # Query files with SQL
   codeecho scan . --remove-comments           # Strip comments
   codeecho scan . --compress-code             # Minify code
+  codeecho scan . --compress signatures       # Declarations only, no function bodies
   codeecho scan . --no-summary                # Skip file summary
-  codeecho scan . --output packed-repo.xml    # Save to file`,
+  codeecho scan . --no-gitignore              # Include files ignored by git
+  codeecho scan . --include 'internal/**/*.go' --ignore '**/*_test.go'
+  codeecho scan . --profile review            # Apply a profile from .codeecho.yaml
+  codeecho scan . --since main                # Only files changed since main
+  codeecho scan . --ref v1.4.0                # Pack a tagged release
+  codeecho scan . --max-tokens 180000         # Fit the pack into a model window
+  codeecho scan . --split-size 400KB          # Write repo-part-001.xml, repo-part-002.xml, ...
+  codeecho scan . --split-by directory        # One pack per top-level directory
+  codeecho scan . --fail-on-secrets           # Refuse to pack credentials
+  codeecho scan . --dry-run                   # List what would be packed, and why
+  codeecho scan . --progress json             # Progress events on stderr for editors and CI
+  codeecho scan . --template team.md.tmpl      # Your own layout
+  codeecho scan . --output packed-repo.xml    # Save to file
+  codeecho scan . -o - | pbcopy               # Stream the pack to another program`,
 	Args: cobra.MaximumNArgs(1),
 	RunE: runScan,
 }
@@ -61,106 +138,548 @@ func init() {
 	rootCmd.AddCommand(scanCmd)
 
 	// Output format flags
-	scanCmd.Flags().StringVarP(&outputFormat, "format", "f", "xml", "Output format: xml, json, markdown")
-	scanCmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output file (default: auto-generated)")
+	scanCmd.Flags().StringVarP(&outputFormat, "format", "f", "xml", "Output format: xml, json, jsonl, markdown, plain, html, sqlite")
+	scanCmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output file, or - for stdout (default: auto-generated)")
+	scanCmd.Flags().StringVar(&templatePath, "template", "", "Render the pack with this Go text/template file instead of a built-in format")
+	scanCmd.MarkFlagsMutuallyExclusive("format", "template")
 	scanCmd.Flags().BoolVar(&includeSummary, "include-summary", true, "Include file summary section")
 	scanCmd.Flags().BoolVar(&includeDirectoryTree, "include-tree", true, "Include directory structure")
 	scanCmd.Flags().BoolVar(&showLineNumbers, "line-numbers", false, "Show line numbers in code blocks")
+	scanCmd.Flags().IntVar(&tabWidth, "tab-width", 0, "Expand tabs to spaces with tab stops this many columns apart (0 = keep tabs)")
+	scanCmd.Flags().StringVar(&lineEndings, "line-endings", "", "Convert line endings in file contents: lf, crlf (default: keep them)")
 	scanCmd.Flags().BoolVar(&outputParsableFormat, "parsable", true, "Use parsable format tags")
 
 	// File processing flags
-	scanCmd.Flags().BoolVar(&compressCode, "compress-code", false, "Remove unnecessary whitespace from code")
+	scanCmd.Flags().BoolVar(&compressCode, "compress-code", false, "Remove unnecessary whitespace from code (same as --compress whitespace)")
+	scanCmd.Flags().StringVar(&compressMode, "compress", "", "Compression mode: whitespace, signatures (declarations and doc comments, no function bodies)")
+	scanCmd.MarkFlagsMutuallyExclusive("compress", "compress-code")
 	scanCmd.Flags().BoolVar(&removeComments, "remove-comments", false, "Strip comments from source files")
 	scanCmd.Flags().BoolVar(&removeEmptyLines, "remove-empty-lines", false, "Remove empty lines from files")
+	scanCmd.Flags().BoolVar(&keepDocComments, "keep-doc-comments", false, "Strip only implementation comments, keeping godoc, JSDoc and docstrings (implies --remove-comments)")
 
 	// File filtering flags
 	scanCmd.Flags().BoolVar(&includeContent, "content", true, "Include file contents")
 	scanCmd.Flags().BoolVar(&excludeContent, "no-content", false, "Exclude file contents (structure only)")
-	scanCmd.Flags().StringSliceVar(&excludeDirs, "exclude-dirs",
-		[]string{".git", "node_modules", "vendor", ".vscode", ".idea", "target", "build", "dist"},
-		"Directories to exclude")
-	scanCmd.Flags().StringSliceVar(&includeExts, "include-exts",
-		[]string{".go", ".js", ".ts", ".jsx", ".tsx", ".json", ".md", ".html", ".css", ".py", ".java", ".cpp", ".c", ".h", ".rs", ".rb", ".php", ".yml", ".yaml", ".toml", ".xml"},
-		"File extensions to include")
+	scanCmd.Flags().StringSliceVar(&excludeDirs, "exclude-dirs", config.DefaultExcludeDirs, "Directories to exclude")
+	scanCmd.Flags().StringSliceVar(&includeExts, "include-exts", config.DefaultIncludeExts, "File extensions to include")
+	scanCmd.Flags().StringArrayVar(&includePatterns, "include", nil, "Only include paths matching this glob (repeatable, e.g. 'internal/**/*.go')")
+	scanCmd.Flags().StringArrayVar(&ignorePatterns, "ignore", nil, "Exclude paths matching this glob (repeatable, e.g. '**/*_test.go')")
+	scanCmd.Flags().BoolVar(&noGitignore, "no-gitignore", false, "Don't apply .gitignore rules (.codeechoignore still applies)")
+
+	scanCmd.Flags().StringVar(&tokenizerName, "tokenizer", tokens.DefaultTokenizer,
+		"Token counter: "+strings.Join(tokens.Names(), ", ")+" (estimate = chars/4)")
+
+	// Token budget flags
+	scanCmd.Flags().IntVar(&maxTokens, "max-tokens", 0, "Fit the pack into this many tokens (0 = no limit)")
+	scanCmd.Flags().StringVar(&budgetStrategy, "budget-strategy", string(scanner.BudgetDrop),
+		"How to fit --max-tokens: drop (omit low-priority files), truncate (keep head and tail), structure (metadata only)")
+	scanCmd.Flags().BoolVar(&failOverBudget, "fail-over-budget", false, "Exit with an error instead of trimming when over --max-tokens")
+
+	// Split flags
+	scanCmd.Flags().StringVar(&splitSize, "split-size", "", "Split the pack into parts of at most this size (e.g. 400KB, 2MB)")
+	scanCmd.Flags().IntVar(&splitTokens, "split-tokens", 0, "Split the pack into parts of at most this many tokens")
+	scanCmd.Flags().StringVar(&splitBy, "split-by", "", "Write one pack per top-level directory or language: directory, language")
+	scanCmd.MarkFlagsMutuallyExclusive("split-size", "split-tokens")
+
+	// Secret redaction flags
+	scanCmd.Flags().BoolVar(&noRedact, "no-redact", false, "Don't redact API keys, private keys and other secrets from file contents")
+	scanCmd.Flags().StringArrayVar(&redactPatterns, "redact-regex", nil, "Also redact matches of this regular expression, or of its first group (repeatable)")
+	scanCmd.Flags().BoolVar(&failOnSecrets, "fail-on-secrets", false, "Exit with an error instead of writing a pack that contains secrets")
+
+	// Concurrency flags
+	scanCmd.Flags().IntVarP(&jobs, "jobs", "j", 0, "Files to read and process in parallel (0 = GOMAXPROCS); output order is unaffected")
+	scanCmd.Flags().StringVar(&maxInFlight, "max-in-flight", "", "Limit on file bytes held in memory by parallel workers (default 256MB)")
+
+	scanCmd.Flags().StringVar(&progressMode, "progress", "auto", "Progress display on stderr: auto (bar on a terminal), bar, json (one event per line), none")
+	scanCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Print nothing but errors and the output itself (overrides --progress)")
+	scanCmd.Flags().BoolVar(&includeErrors, "include-errors", true, "List read errors and skipped files at the end of the output")
+	scanCmd.Flags().StringVar(&reportFile, "report", "", "Write a JSON report of errors, skipped files and phase timings to this file")
+	scanCmd.Flags().BoolVar(&strict, "strict", false, "Fail with exit code 3 if any file was skipped")
+	scanCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Explain which paths would be packed and why, without writing output (table, or JSON with --format json)")
+
+	// Change set flags
+	scanCmd.Flags().StringVar(&sinceRef, "since", "", "Only scan files changed since this git ref")
+	scanCmd.Flags().BoolVar(&stagedOnly, "staged", false, "Only scan files with staged changes")
+	scanCmd.Flags().BoolVar(&workingTreeOnly, "working-tree", false, "Only scan files with unstaged changes (and untracked files)")
+	scanCmd.Flags().StringVar(&revision, "ref", "", "Pack a git revision (commit, tag or branch) from the object store instead of the working tree")
+	scanCmd.MarkFlagsMutuallyExclusive("since", "staged", "working-tree", "ref")
+}
+
+// scanBindings maps config settings to scan flags. Values from config
+// files, profiles and CODEECHO_* variables fill any flag left unset.
+var scanBindings = []flagBinding{
+	{key: config.KeyFormat, flag: "format", target: &outputFormat},
+	{key: config.KeyOutput, flag: "output", target: &outputFile},
+	{key: config.KeyTemplate, flag: "template", target: &templatePath},
+	{key: config.KeyIncludeSummary, flag: "include-summary", target: &includeSummary},
+	{key: config.KeyIncludeTree, flag: "include-tree", target: &includeDirectoryTree},
+	{key: config.KeyLineNumbers, flag: "line-numbers", target: &showLineNumbers},
+	{key: config.KeyTabWidth, flag: "tab-width", target: &tabWidth},
+	{key: config.KeyLineEndings, flag: "line-endings", target: &lineEndings},
+	{key: config.KeyParsable, flag: "parsable", target: &outputParsableFormat},
+	{key: config.KeyCompressCode, flag: "compress-code", target: &compressCode},
+	{key: config.KeyCompress, flag: "compress", target: &compressMode},
+	{key: config.KeyRemoveComments, flag: "remove-comments", target: &removeComments},
+	{key: config.KeyRemoveEmptyLines, flag: "remove-empty-lines", target: &removeEmptyLines},
+	{key: config.KeyKeepDocComments, flag: "keep-doc-comments", target: &keepDocComments},
+	{key: config.KeyContent, flag: "content", target: &includeContent},
+	{key: config.KeyContent, flag: "no-content", target: &excludeContent, invert: true},
+	{key: config.KeyExcludeDirs, flag: "exclude-dirs", target: &excludeDirs},
+	{key: config.KeyIncludeExts, flag: "include-exts", target: &includeExts},
+	{key: config.KeyInclude, flag: "include", target: &includePatterns},
+	{key: config.KeyIgnore, flag: "ignore", target: &ignorePatterns},
+	{key: config.KeyGitignore, flag: "no-gitignore", target: &noGitignore, invert: true},
+	{key: config.KeyTokenizer, flag: "tokenizer", target: &tokenizerName},
+	{key: config.KeyMaxTokens, flag: "max-tokens", target: &maxTokens},
+	{key: config.KeyBudgetStrategy, flag: "budget-strategy", target: &budgetStrategy},
+	{key: config.KeySplitSize, flag: "split-size", target: &splitSize},
+	{key: config.KeySplitTokens, flag: "split-tokens", target: &splitTokens},
+	{key: config.KeySplitBy, flag: "split-by", target: &splitBy},
+	{key: config.KeyRedactSecrets, flag: "no-redact", target: &noRedact, invert: true},
+	{key: config.KeyRedactRegex, flag: "redact-regex", target: &redactPatterns},
+	{key: config.KeyJobs, flag: "jobs", target: &jobs},
+	{key: config.KeyMaxInFlight, flag: "max-in-flight", target: &maxInFlight},
+	{key: config.KeyProgress, flag: "progress", target: &progressMode},
+	{key: config.KeyQuiet, flag: "quiet", target: &quiet},
+	{key: config.KeyIncludeErrors, flag: "include-errors", target: &includeErrors},
+	{key: config.KeyReport, flag: "report", target: &reportFile},
+	{key: config.KeyStrict, flag: "strict", target: &strict},
+}
+
+// packScanner is the part of StreamingScanner and RevisionScanner runScan needs
+type packScanner interface {
+	Scan() (*scanner.StreamingStats, error)
+	SetTreeWriter(func([]string) error)
+	SetBudgetPlan(*scanner.BudgetPlan)
+	SetDecisionHandler(scanner.DecisionHandler)
+	SetProgressCallback(scanner.ProgressCallback)
 }
 
-func runScan(cmd *cobra.Command, args []string) error {
+// packSource describes what a scan reads: the working tree (optionally
+// limited to a change set) or a git revision
+type packSource struct {
+	absPath string
+	changes []gitrepo.Change
+	repo    *gitrepo.Repository
+	commit  *gitrepo.Commit
+
+	progress *progressReporter // nil when progress isn't shown
+	warnings io.Writer         // Where files skipped during the walk are reported
+
+	// How long each pass took, for --report
+	phases *[]scanner.PhaseTiming
+}
+
+// newScanner creates the scanner for src that passes each file to fileHandler
+func (src packSource) newScanner(opts scanner.ScanOptions, fileHandler func(*scanner.FileInfo) error) (packScanner, error) {
+	if src.commit != nil {
+		return scanner.NewRevisionScanner(src.repo, src.commit, src.absPath, opts, fileHandler)
+	}
+
+	streamingScanner := scanner.NewStreamingScanner(src.absPath, opts, fileHandler)
+	streamingScanner.SetWarningWriter(src.warnings)
+	if src.changes != nil {
+		streamingScanner.SetChanges(src.changes)
+	}
+	return streamingScanner, nil
+}
+
+// scan runs one pass over src, showing its progress under the pass name
+func (src packSource) scan(sc packScanner, pass string) (*scanner.StreamingStats, error) {
+	start := time.Now()
+	sc.SetProgressCallback(src.progress.track(pass))
+	stats, err := sc.Scan()
+	src.progress.finish(stats)
+	if src.phases != nil {
+		*src.phases = append(*src.phases, scanner.NewPhaseTiming(pass, time.Since(start)))
+	}
+	return stats, err
+}
+
+// planBudget runs a counting pass over src and decides which files fit
+// into maxTokens. The pack is measured as the format renders it, except
+// for SQLite, where only file contents count. Nothing is written during
+// this pass.
+func planBudget(src packSource, opts scanner.ScanOptions, outputOpts config.OutputOptions, strategy scanner.BudgetStrategy) (*scanner.BudgetPlan, error) {
+	var meter scanner.PackMeter
+	if outputFormat != "sqlite" {
+		meter = output.NewBudgetMeter(outputFormat, outputOpts, opts.Tokenizer, src.absPath)
+	}
+	planner := scanner.NewBudgetPlanner(maxTokens, strategy, meter)
+
+	opts.IncludeDirectoryTree = false
+	counter, err := src.newScanner(opts, planner.Observe)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := src.scan(counter, "budget"); err != nil {
+		return nil, fmt.Errorf("token budget pass failed: %w", err)
+	}
+	plan, err := planner.Plan()
+	if err != nil {
+		return nil, fmt.Errorf("failed to plan token budget: %w", err)
+	}
+	return plan, nil
+}
+
+// planSplit runs a counting pass over src and assigns every file to a
+// part. The budget plan, if any, is applied so parts are measured trimmed.
+func planSplit(src packSource, opts scanner.ScanOptions, budget *scanner.BudgetPlan, splitOpts output.SplitOptions) (*output.SplitPlan, error) {
+	planner, err := output.NewSplitPlanner(splitOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	counter, err := src.newScanner(opts, planner.Observe)
+	if err != nil {
+		return nil, err
+	}
+	counter.SetTreeWriter(planner.ObserveTree)
+	if budget != nil {
+		counter.SetBudgetPlan(budget)
+	}
+	if _, err := src.scan(counter, "split"); err != nil {
+		return nil, fmt.Errorf("split pass failed: %w", err)
+	}
+	return planner.Plan()
+}
+
+// findSecrets runs a detection pass over src and returns every secret
+// that would be packed. Nothing is written during this pass.
+func findSecrets(src packSource, opts scanner.ScanOptions) ([]scanner.SecretFinding, error) {
+	opts.IncludeDirectoryTree = false
+	detector, err := src.newScanner(opts, func(*scanner.FileInfo) error { return nil })
+	if err != nil {
+		return nil, err
+	}
+	stats, err := src.scan(detector, "secrets")
+	if err != nil {
+		return nil, fmt.Errorf("secret detection pass failed: %w", err)
+	}
+	return stats.Secrets, nil
+}
+
+// openRevision opens the repository containing path and resolves rev to a commit
+func openRevision(path, rev string) (*gitrepo.Repository, *gitrepo.Commit, error) {
+	repo, err := gitrepo.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hash, err := repo.ResolveCommit(rev)
+	if err != nil {
+		repo.Close()
+		return nil, nil, fmt.Errorf("failed to resolve %s: %w", rev, err)
+	}
+
+	commit, err := repo.ReadCommit(hash)
+	if err != nil {
+		repo.Close()
+		return nil, nil, err
+	}
+	return repo, commit, nil
+}
+
+func runScan(cmd *cobra.Command, args []string) (err error) {
+	runStart := time.Now()
+
+	// Messages for people go to stderr, keeping stdout for the pack
+	var status io.Writer = os.Stderr
+
 	// Determine target path
 	targetPath := "."
 	if len(args) > 0 {
 		targetPath = args[0]
 	}
 
+	// Get absolute path for cleaner output
+	absPath, err := filepath.Abs(targetPath)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	cfg, err := loadConfig(absPath)
+	if err != nil {
+		return err
+	}
+	if err := applyConfig(cmd, cfg, scanBindings); err != nil {
+		return err
+	}
+
+	progress, err := newProgressReporter(progressMode, quiet)
+	if err != nil {
+		return err
+	}
+	if quiet {
+		status = io.Discard
+	} else if progress.jsonEvents() {
+		// Keep stderr to one JSON event per line
+		status = progress.stderr()
+		cmd.SilenceErrors, cmd.SilenceUsage = true, true
+		defer func() { err = progress.fail(err) }()
+	}
+
 	// Validate path exists
 	if _, err := os.Stat(targetPath); os.IsNotExist(err) {
 		return fmt.Errorf("path does not exist: %s", targetPath)
 	}
 
-	// Get absolute path for cleaner output
-	absPath, err := filepath.Abs(targetPath)
+	if err := scanner.ValidatePatterns(includePatterns); err != nil {
+		return err
+	}
+	if err := scanner.ValidatePatterns(ignorePatterns); err != nil {
+		return err
+	}
+
+	tokenizer, err := tokens.New(tokenizerName)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path: %w", err)
+		return err
+	}
+
+	// A template replaces the format, whichever was configured
+	var layout *template.Template
+	if templatePath != "" {
+		if layout, err = output.LoadTemplate(templatePath, tokenizer); err != nil {
+			return err
+		}
+		outputFormat = "template"
 	}
 
-	fmt.Printf("Scanning repository at %s...\n", absPath)
+	compress, err := scanner.ParseCompressMode(cfg.CompressMode())
+	if err != nil {
+		return err
+	}
+
+	strategy, err := scanner.ParseBudgetStrategy(budgetStrategy)
+	if err != nil {
+		return err
+	}
+	if maxTokens < 0 {
+		return fmt.Errorf("--max-tokens must not be negative")
+	}
+	if failOverBudget && maxTokens == 0 {
+		return fmt.Errorf("--fail-over-budget requires --max-tokens")
+	}
+
+	splitOpts := output.SplitOptions{MaxTokens: splitTokens, By: splitBy, Format: outputFormat, Tokenizer: tokenizer}
+	if splitSize != "" {
+		if splitOpts.MaxBytes, err = utils.ParseBytes(splitSize); err != nil {
+			return fmt.Errorf("--split-size: %w", err)
+		}
+	}
+	if tabWidth < 0 {
+		return fmt.Errorf("--tab-width must not be negative")
+	}
+	if err := output.ValidateLineEndings(lineEndings); err != nil {
+		return err
+	}
+
+	if splitTokens < 0 {
+		return fmt.Errorf("--split-tokens must not be negative")
+	}
+	if err := output.ValidateSplitBy(splitBy); err != nil {
+		return err
+	}
+	if splitOpts.Enabled() && outputFile == stdoutPath {
+		return fmt.Errorf("a split pack is written as several files and can't go to stdout (-o -)")
+	}
+	if splitOpts.Enabled() && outputFormat == "sqlite" {
+		return fmt.Errorf("a SQLite pack is queried as a whole and can't be split; drop --split-* or use another format")
+	}
+	if _, err := output.NewStreamingWriter(nil, outputFormat, config.OutputOptions{Template: layout}); err != nil {
+		return err
+	}
+
+	if jobs < 0 {
+		return fmt.Errorf("--jobs must not be negative")
+	}
+	var maxInFlightBytes int64
+	if maxInFlight != "" {
+		if maxInFlightBytes, err = utils.ParseBytes(maxInFlight); err != nil {
+			return fmt.Errorf("--max-in-flight: %w", err)
+		}
+	}
+
+	var secrets *scanner.SecretScanner
+	if !noRedact || failOnSecrets {
+		if secrets, err = scanner.NewSecretScanner(redactPatterns); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(status, "Scanning repository at %s...\n", absPath)
 
 	if excludeContent {
 		includeContent = false
 	}
+	if keepDocComments {
+		removeComments = true
+	}
 
-	if compressCode || removeComments || removeEmptyLines {
-		fmt.Println("File processing enabled:")
-		if compressCode {
-			fmt.Println("  - Code compression")
+	if compress != scanner.CompressNone || removeComments || removeEmptyLines {
+		fmt.Fprintln(status, "File processing enabled:")
+		switch compress {
+		case scanner.CompressWhitespace:
+			fmt.Fprintln(status, "  - Code compression")
+		case scanner.CompressSignatures:
+			fmt.Fprintln(status, "  - Signatures only (function bodies elided)")
 		}
-		if removeComments {
-			fmt.Println("  - Comment removal")
+		if keepDocComments {
+			fmt.Fprintln(status, "  - Comment removal (doc comments kept)")
+		} else if removeComments {
+			fmt.Fprintln(status, "  - Comment removal")
 		}
 		if removeEmptyLines {
-			fmt.Println("  - Empty line removal")
+			fmt.Fprintln(status, "  - Empty line removal")
 		}
 	}
 
-	// Determine output file
-	var outputFilePath string
-	if outputFile != "" {
-		outputFilePath = outputFile
-	} else {
-		// Generate auto filename
-		outputOpts := config.OutputOptions{
-			IncludeSummary:       includeSummary,
-			IncludeDirectoryTree: includeDirectoryTree,
-			ShowLineNumbers:      showLineNumbers,
-			IncludeContent:       includeContent,
-			RemoveComments:       removeComments,
-			RemoveEmptyLines:     removeEmptyLines,
-			CompressCode:         compressCode,
+	// Resolve the change set before creating any output
+	var changes []gitrepo.Change
+	if sinceRef != "" || stagedOnly || workingTreeOnly {
+		changes, err = gitrepo.ChangedFiles(absPath, gitrepo.DiffOptions{
+			Since:       sinceRef,
+			Staged:      stagedOnly,
+			WorkingTree: workingTreeOnly,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list changed files: %w", err)
 		}
-		outputFilePath = utils.GenerateAutoFilename(absPath, outputFormat, outputOpts)
+		if changes == nil {
+			changes = []gitrepo.Change{}
+		}
+		fmt.Fprintf(status, "Limiting scan to %d changed file(s)\n", len(changes))
 	}
 
-	// Create output file
-	outFile, err := os.Create(outputFilePath)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+	// Create output options
+	outputOpts := cfg.OutputOptions()
+	outputOpts.Template = layout
+
+	// Resolve the revision before creating any output
+	var repo *gitrepo.Repository
+	var commit *gitrepo.Commit
+	if revision != "" {
+		repo, commit, err = openRevision(absPath, revision)
+		if err != nil {
+			return err
+		}
+		defer repo.Close()
+
+		outputOpts.Revision = revision
+		outputOpts.CommitSHA = commit.Hash.String()
+		outputOpts.CommitDate = commit.CommitterDate.Format(time.RFC3339)
+		fmt.Fprintf(status, "Packing revision %s (commit %s)\n", revision, outputOpts.CommitSHA)
 	}
-	defer outFile.Close()
 
-	// Create output options
-	outputOpts := config.OutputOptions{
+	// Scan options shared by the budget pass and the writing pass
+	scanOpts := scanner.ScanOptions{
 		IncludeSummary:       includeSummary,
 		IncludeDirectoryTree: includeDirectoryTree,
 		ShowLineNumbers:      showLineNumbers,
-		IncludeContent:       includeContent,
+		OutputParsableFormat: outputParsableFormat,
+		Compress:             compress,
 		RemoveComments:       removeComments,
 		RemoveEmptyLines:     removeEmptyLines,
-		CompressCode:         compressCode,
+		KeepDocComments:      keepDocComments,
+		ExcludeDirs:          excludeDirs,
+		IncludeExts:          includeExts,
+		IncludeContent:       includeContent,
+		IncludePatterns:      includePatterns,
+		IgnorePatterns:       ignorePatterns,
+		UseGitignore:         !noGitignore,
+		Tokenizer:            tokenizer,
+		Jobs:                 jobs,
+		MaxInFlightBytes:     maxInFlightBytes,
+	}
+	if !noRedact {
+		scanOpts.Secrets = secrets
 	}
 
-	// Create streaming writer based on format
-	writer, err := output.NewStreamingWriter(outFile, outputFormat, outputOpts)
-	if err != nil {
-		return err
+	var phases []scanner.PhaseTiming
+	src := packSource{absPath: absPath, changes: changes, repo: repo, commit: commit, progress: progress, warnings: progress.stderr(), phases: &phases}
+
+	// Refuse to pack secrets before creating any output
+	if failOnSecrets && !dryRun {
+		checkOpts := scanOpts
+		checkOpts.Secrets = secrets
+		found, err := findSecrets(src, checkOpts)
+		if err != nil {
+			return err
+		}
+		if len(found) > 0 {
+			fmt.Fprintf(status, "Found %d secret(s):\n", len(found))
+			for _, s := range found {
+				fmt.Fprintf(status, "  %s:%d %s\n", s.Path, s.Line, s.Rule)
+			}
+			return fmt.Errorf("refusing to write a pack containing %d secret(s) (--fail-on-secrets)", len(found))
+		}
+	}
+
+	// Decide what fits before creating any output
+	var plan *scanner.BudgetPlan
+	if maxTokens > 0 {
+		fmt.Fprintf(status, "Planning token budget of %d (%s strategy)...\n", maxTokens, strategy)
+		plan, err = planBudget(src, scanOpts, outputOpts, strategy)
+		if err != nil {
+			return err
+		}
+		if failOverBudget && !dryRun && plan.Report.OverBudget() {
+			return fmt.Errorf("pack needs %d tokens, over the --max-tokens budget of %d",
+				plan.Report.OriginalTokens, maxTokens)
+		}
+		if plan.Report.PlannedTokens > maxTokens {
+			fmt.Fprintf(status, "Warning: trimmed pack still needs %d tokens, over the --max-tokens budget of %d\n",
+				plan.Report.PlannedTokens, maxTokens)
+		}
+	}
+
+	if dryRun {
+		return runDryRun(src, scanOpts, plan)
+	}
+
+	var splitPlan *output.SplitPlan
+	if splitOpts.Enabled() {
+		splitOpts.Output = outputOpts
+		if plan != nil {
+			splitOpts.Budget = plan.Report
+		}
+		fmt.Fprintln(status, "Planning split...")
+		if splitPlan, err = planSplit(src, scanOpts, plan, splitOpts); err != nil {
+			return err
+		}
+	}
+
+	// Determine output file
+	toStdout := writesToStdout(outputFile)
+	var outputFilePath string
+	if outputFile != "" {
+		outputFilePath = outputFile
+	} else {
+		// Generate auto filename
+		outputFilePath = utils.GenerateAutoFilename(absPath, outputFormat, outputOpts)
+	}
+
+	// Create streaming writer based on format; a split pack creates its
+	// part files itself as they fill up
+	var writer output.StreamingWriter
+	var splitWriter *output.SplitWriter
+	if splitPlan != nil {
+		splitWriter = output.NewSplitWriter(splitPlan, outputFilePath)
+		writer = splitWriter
+	} else if toStdout {
+		if writer, err = output.NewStreamingWriter(os.Stdout, outputFormat, outputOpts); err != nil {
+			return err
+		}
+	} else {
+		outFile, err := os.Create(outputFilePath)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer outFile.Close()
+
+		if writer, err = output.NewStreamingWriter(outFile, outputFormat, outputOpts); err != nil {
+			return err
+		}
 	}
 	defer writer.Close()
 
@@ -170,61 +689,118 @@ func runScan(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to write header: %w", err)
 	}
 
-	// Create scanner with streaming handler
-	scanOpts := scanner.ScanOptions{
-		IncludeSummary:       includeSummary,
-		IncludeDirectoryTree: includeDirectoryTree,
-		ShowLineNumbers:      showLineNumbers,
-		OutputParsableFormat: outputParsableFormat,
-		CompressCode:         compressCode,
-		RemoveComments:       removeComments,
-		RemoveEmptyLines:     removeEmptyLines,
-		ExcludeDirs:          excludeDirs,
-		IncludeExts:          includeExts,
-		IncludeContent:       includeContent,
-	}
-
 	// Each file gets written immediately, then discarded
-	streamingScanner := scanner.NewStreamingScanner(absPath, scanOpts, writer.WriteFile)
-	// Set tree writer callback
-	streamingScanner.SetTreeWriter(writer.WriteTree)
+	packer, err := src.newScanner(scanOpts, writer.WriteFile)
+	if err != nil {
+		return err
+	}
+	packer.SetTreeWriter(writer.WriteTree)
+	if plan != nil {
+		packer.SetBudgetPlan(plan)
+	}
 
 	// Perform the scan (streaming mode!)
-	fmt.Println("Streaming scan in progress...")
-	stats, err := streamingScanner.Scan()
-	if err != nil {
-		return fmt.Errorf("scan failed: %w", err)
+	fmt.Fprintln(status, "Streaming scan in progress...")
+	stats, scanErr := src.scan(packer, "pack")
+
+	report := scanner.NewScanReport(stats, scanErr)
+	report.Phases = phases
+	report.Duration = utils.FormatDuration(time.Since(runStart))
+	if reportFile != "" {
+		if err := writeReport(reportFile, report); err != nil {
+			return err
+		}
+		fmt.Fprintf(status, "Report written to %s\n", reportFile)
+	}
+	if scanErr != nil {
+		return fmt.Errorf("scan failed: %w", scanErr)
 	}
 
 	// Write footer with final statistics
 	if err := writer.WriteFooter(stats); err != nil {
 		return fmt.Errorf("failed to write footer: %w", err)
 	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
 
-	fmt.Printf("\nOutput written to %s\n", outputFilePath)
+	if splitWriter != nil {
+		fmt.Fprintf(status, "\nOutput written to %d parts:\n", splitPlan.PartCount())
+		for _, path := range splitWriter.Paths() {
+			fmt.Fprintf(status, "  %s\n", path)
+		}
+	} else if toStdout {
+		fmt.Fprintln(status, "\nOutput written to stdout")
+	} else {
+		fmt.Fprintf(status, "\nOutput written to %s\n", outputFilePath)
+		stdoutHint(status, outputFile)
+	}
 
 	// Enhanced scan summary
-	fmt.Printf("\nScan Summary:\n")
-	fmt.Printf("  Files processed: %d\n", stats.TotalFiles)
-	fmt.Printf("  Total size: %s\n", utils.FormatBytes(stats.TotalSize))
-	fmt.Printf("  Text files: %d, Binary files: %d\n", stats.TextFiles, stats.BinaryFiles)
+	fmt.Fprintf(status, "\nScan Summary:\n")
+	fmt.Fprintf(status, "  Files processed: %d\n", stats.TotalFiles)
+	fmt.Fprintf(status, "  Total size: %s\n", utils.FormatBytes(stats.TotalSize))
+	fmt.Fprintf(status, "  Total tokens: %d (%s)\n", stats.TotalTokens, stats.Tokenizer)
+	fmt.Fprintf(status, "  Text files: %d, Binary files: %d\n", stats.TextFiles, stats.BinaryFiles)
+	if stats.DeletedFiles > 0 {
+		fmt.Fprintf(status, "  Deleted files: %d\n", stats.DeletedFiles)
+	}
+	if len(stats.Secrets) > 0 {
+		fmt.Fprintf(status, "  Secrets redacted: %d (listed in the output footer)\n", len(stats.Secrets))
+	}
+	if report.WarningCount > 0 {
+		fmt.Fprintf(status, "  Warnings: %d (%d file(s) skipped or incomplete)\n", report.WarningCount, report.SkippedFiles)
+	}
+	if budget := stats.Budget; budget != nil {
+		omitted, truncated, structureOnly := 0, 0, 0
+		for _, d := range budget.Decisions {
+			switch d.Action {
+			case scanner.BudgetActionOmitted:
+				omitted++
+			case scanner.BudgetActionTruncated:
+				truncated++
+			case scanner.BudgetActionStructureOnly:
+				structureOnly++
+			}
+		}
+		fmt.Fprintf(status, "  Token budget: %d of %d used (%d before trimming)\n", budget.PlannedTokens, budget.MaxTokens, budget.OriginalTokens)
+		if len(budget.Decisions) > 0 {
+			fmt.Fprintf(status, "  Budget decisions: %d omitted, %d truncated, %d structure-only\n", omitted, truncated, structureOnly)
+		}
+	}
 
 	// Show top file types
 	if len(stats.LanguageCounts) > 0 {
-		fmt.Printf("  Languages detected: ")
+		fmt.Fprintf(status, "  Languages detected: ")
 		count := 0
 		for lang, num := range stats.LanguageCounts {
 			if count > 0 {
-				fmt.Printf(", ")
+				fmt.Fprintf(status, ", ")
 			}
-			fmt.Printf("%s (%d)", lang, num)
+			fmt.Fprintf(status, "%s (%d)", lang, num)
 			count++
 			if count >= 5 { // Show top 5
 				break
 			}
 		}
-		fmt.Printf("\n")
+		fmt.Fprintf(status, "\n")
+	}
+
+	if strict && report.SkippedFiles > 0 {
+		return &exitError{code: exitIncomplete, err: fmt.Errorf("%d file(s) were skipped or incomplete (--strict)", report.SkippedFiles)}
 	}
 
 	return nil
 }
+
+// writeReport saves the --report file
+func writeReport(path string, report *scanner.ScanReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
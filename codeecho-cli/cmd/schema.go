@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/opskraken/codeecho-cli/output"
+	"github.com/spf13/cobra"
+)
+
+// schemaCmd prints the JSON Schema of a pack format
+var schemaCmd = &cobra.Command{
+	Use:   "schema <format>",
+	Short: "Print the JSON Schema of a pack format",
+	Long: `Print the JSON Schema that packs of a format follow, to validate them
+before use. Only json has a schema.
+
+JSON packs carry a "schema_version". Minor versions only add optional
+fields; a new major version may remove or change fields.
+
+Examples:
+  codeecho schema json > codeecho-pack.schema.json
+  check-jsonschema --schemafile codeecho-pack.schema.json repo.json`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"json"},
+	RunE:      runSchema,
+}
+
+func init() {
+	rootCmd.AddCommand(schemaCmd)
+}
+
+func runSchema(cmd *cobra.Command, args []string) error {
+	schema, err := output.Schema(args[0])
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(schema)
+	return err
+}
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/opskraken/codeecho-cli/output"
+	"github.com/spf13/cobra"
+)
+
+var (
+	unpackInto   string
+	unpackFormat string
+	unpackForce  bool
+)
+
+// unpackCmd recreates a directory from packs written by scan
+var unpackCmd = &cobra.Command{
+	Use:   "unpack <pack>... --into <dir>",
+	Short: "Recreate files and directories from a pack",
+	Long: `Recreate the files and directories of a pack written by scan.
+
+XML, JSON, JSON Lines and Markdown packs are read, and line numbers added by
+--line-numbers are removed. Pass every part of a split pack to rejoin files
+that were split across parts, or - to read a pack from stdin.
+
+Packs are not always lossless: files that were compressed, truncated,
+redacted or packed without content are listed after unpacking, and binary
+and deleted files are not written. Absolute paths and paths containing ..
+are refused before anything is written.
+
+Examples:
+  codeecho unpack repo.xml --into ./out
+  codeecho unpack repo-part-*.json --into ./out
+  codeecho scan . -o - | codeecho unpack - --into ./copy`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runUnpack,
+}
+
+func init() {
+	rootCmd.AddCommand(unpackCmd)
+
+	unpackCmd.Flags().StringVar(&unpackInto, "into", "", "Directory to recreate the files in (created if missing)")
+	unpackCmd.Flags().StringVarP(&unpackFormat, "format", "f", "", "Pack format: xml, json, jsonl, markdown (default: from the file extension or contents)")
+	unpackCmd.Flags().BoolVar(&unpackForce, "force", false, "Overwrite files that already exist in the target directory")
+	unpackCmd.MarkFlagRequired("into")
+}
+
+func runUnpack(cmd *cobra.Command, args []string) error {
+	var packs []*output.Pack
+	for _, name := range args {
+		pack, err := readPackFile(name, unpackFormat)
+		if err != nil {
+			return err
+		}
+		packs = append(packs, pack)
+	}
+
+	entries, err := output.PlanUnpack(packs)
+	if err != nil {
+		return err
+	}
+
+	root, err := filepath.Abs(unpackInto)
+	if err != nil {
+		return fmt.Errorf("failed to resolve target directory: %w", err)
+	}
+	if !unpackForce {
+		for _, entry := range entries {
+			target := filepath.Join(root, filepath.FromSlash(entry.Path))
+			if _, err := os.Lstat(target); entry.Write && err == nil {
+				return fmt.Errorf("%s already exists (use --force to overwrite)", target)
+			}
+		}
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return fmt.Errorf("failed to create target directory: %w", err)
+	}
+
+	written := 0
+	for _, entry := range entries {
+		if !entry.Write {
+			continue
+		}
+		if err := writeUnpacked(root, entry); err != nil {
+			return err
+		}
+		written++
+	}
+
+	return printUnpackSummary(packs, entries, written, unpackInto)
+}
+
+// readPackFile parses one pack, or stdin for "-". An empty format is
+// detected from the file name or contents.
+func readPackFile(name, format string) (*output.Pack, error) {
+	var r io.Reader = os.Stdin
+	if name != stdoutPath {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open pack: %w", err)
+		}
+		defer file.Close()
+		r = file
+	} else {
+		name = "stdin"
+	}
+
+	reader := bufio.NewReader(r)
+	if format == "" {
+		head, _ := reader.Peek(512)
+		detected, err := output.DetectPackFormat(name, head)
+		if err != nil {
+			return nil, err
+		}
+		format = detected
+	}
+	return output.ReadPack(reader, name, format)
+}
+
+// writeUnpacked writes one file below root. Paths are already free of
+// ".." and absolute paths; resolving the parent directory also catches
+// symlinks in the target directory that point elsewhere.
+func writeUnpacked(root string, entry output.UnpackEntry) error {
+	target := filepath.Join(root, filepath.FromSlash(entry.Path))
+	if err := makeDirInsideRoot(root, entry.Path); err != nil {
+		return err
+	}
+	if err := checkInsideRoot(root, entry.Path); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(target, []byte(entry.Content), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", entry.Path, err)
+	}
+	return nil
+}
+
+// makeDirInsideRoot creates the directory of rel below root. The nearest
+// part of it that already exists must resolve inside root first, so a
+// symlink in the target can't get directories created elsewhere.
+func makeDirInsideRoot(root, rel string) error {
+	dir := filepath.Dir(filepath.Join(root, filepath.FromSlash(rel)))
+	existing := dir
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		existing = parent
+	}
+	if err := checkResolvesInside(root, existing, rel); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	return nil
+}
+
+// checkResolvesInside makes sure dir, which must exist, resolves inside
+// root; rel names the file being written in the error
+func checkResolvesInside(root, dir, rel string) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if r, err := filepath.Rel(realRoot, realDir); err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("refusing to write %s: its directory resolves outside %s", rel, root)
+	}
+	return nil
+}
+
+// checkInsideRoot makes sure the directory of rel, which must exist,
+// resolves inside root and that rel isn't a symlink or other special file
+func checkInsideRoot(root, rel string) error {
+	target := filepath.Join(root, filepath.FromSlash(rel))
+	if err := checkResolvesInside(root, filepath.Dir(target), rel); err != nil {
+		return err
+	}
+	if info, err := os.Lstat(target); err == nil && !info.Mode().IsRegular() {
+		return fmt.Errorf("refusing to write %s: it exists and is not a regular file", rel)
+	}
+	return nil
+}
+
+// printUnpackSummary lists the files that differ from the originals on
+// stderr
+func printUnpackSummary(packs []*output.Pack, entries []output.UnpackEntry, written int, into string) error {
+	fmt.Fprintf(os.Stderr, "Unpacked %d file(s) from %d pack(s) into %s\n", written, len(packs), into)
+
+	for _, pack := range packs {
+		if pack.Processing != "" {
+			fmt.Fprintf(os.Stderr, "Warning: %s was packed with processing that can't be undone: %s\n", pack.Name, pack.Processing)
+		}
+	}
+
+	var issues []output.UnpackEntry
+	for _, entry := range entries {
+		if entry.Issue != "" {
+			issues = append(issues, entry)
+		}
+	}
+	if len(issues) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "\n%d file(s) could not be restored faithfully:\n\n", len(issues))
+	tw := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tPATH\tISSUE\tDETAIL")
+	for _, entry := range issues {
+		state := "written"
+		if !entry.Write {
+			state = "skipped"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", state, entry.Path, entry.Issue, entry.Detail)
+	}
+	return tw.Flush()
+}
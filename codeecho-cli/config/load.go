@@ -0,0 +1,200 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectConfigFile is looked up in the scanned directory and its parents
+const ProjectConfigFile = ".codeecho.yaml"
+
+// EnvPrefix is prepended to setting names to form environment overrides
+const EnvPrefix = "CODEECHO_"
+
+// profilesKey holds named profiles inside a config file
+const profilesKey = "profiles"
+
+// LoadOptions controls which config sources are consulted
+type LoadOptions struct {
+	ConfigFile string // Explicit --config path; replaces the project file lookup
+	ProjectDir string // Directory the project file search starts from
+	Profile    string // Profile to apply (falls back to CODEECHO_PROFILE)
+}
+
+// configFile is one parsed YAML file
+type configFile struct {
+	path     string
+	settings map[string]interface{}
+	profiles map[string]map[string]interface{}
+}
+
+// Load resolves the effective configuration. Later layers win:
+// defaults, user config, project config, the selected profile (user
+// then project), CODEECHO_* environment variables. Flags are applied
+// on top by the caller.
+func Load(opts LoadOptions) (*Config, error) {
+	cfg := NewConfig()
+
+	var paths []string
+	if userFile := UserConfigPath(); userFile != "" {
+		if _, err := os.Stat(userFile); err == nil {
+			paths = append(paths, userFile)
+		}
+	}
+
+	if opts.ConfigFile != "" {
+		if _, err := os.Stat(opts.ConfigFile); err != nil {
+			return nil, fmt.Errorf("config file: %w", err)
+		}
+		paths = append(paths, opts.ConfigFile)
+	} else if projectFile := findProjectConfig(opts.ProjectDir); projectFile != "" {
+		paths = append(paths, projectFile)
+	}
+
+	var files []*configFile
+	for _, path := range paths {
+		file, err := readConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+		cfg.Files = append(cfg.Files, path)
+	}
+
+	for _, file := range files {
+		if err := cfg.apply(file.settings, file.path); err != nil {
+			return nil, fmt.Errorf("%s: %w", file.path, err)
+		}
+	}
+
+	profile := opts.Profile
+	if profile == "" {
+		profile = os.Getenv(EnvPrefix + "PROFILE")
+	}
+	if profile != "" {
+		found := false
+		for _, file := range files {
+			settings, ok := file.profiles[profile]
+			if !ok {
+				continue
+			}
+			found = true
+			source := fmt.Sprintf("profile %s (%s)", profile, file.path)
+			if err := cfg.apply(settings, source); err != nil {
+				return nil, fmt.Errorf("%s: profile %s: %w", file.path, profile, err)
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("profile %q is not defined in any config file", profile)
+		}
+		cfg.Profile = profile
+	}
+
+	for _, key := range Keys() {
+		name := EnvName(key)
+		if value, ok := os.LookupEnv(name); ok {
+			if err := cfg.Set(key, value, "env "+name); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+
+	return cfg, nil
+}
+
+// EnvName returns the environment variable that overrides key
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+// UserConfigPath returns $XDG_CONFIG_HOME/codeecho/config.yaml,
+// defaulting to ~/.config when XDG_CONFIG_HOME is unset
+func UserConfigPath() string {
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		base = filepath.Join(home, ".config")
+	}
+	return filepath.Join(base, "codeecho", "config.yaml")
+}
+
+// apply sets every key in settings, rejecting unknown names
+func (c *Config) apply(settings map[string]interface{}, source string) error {
+	for _, key := range sortedKeys(settings) {
+		if err := c.Set(key, settings[key], source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findProjectConfig walks up from dir looking for ProjectConfigFile
+func findProjectConfig(dir string) string {
+	if dir == "" {
+		dir = "."
+	}
+	current, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+
+	for {
+		candidate := filepath.Join(current, ProjectConfigFile)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return ""
+		}
+		current = parent
+	}
+}
+
+func readConfigFile(path string) (*configFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	raw := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	file := &configFile{
+		path:     path,
+		settings: raw,
+		profiles: make(map[string]map[string]interface{}),
+	}
+
+	if profiles, ok := raw[profilesKey]; ok {
+		delete(raw, profilesKey)
+
+		profileMap, ok := profiles.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: %q must be a mapping of profile names", path, profilesKey)
+		}
+		for name, settings := range profileMap {
+			if settings == nil {
+				file.profiles[name] = map[string]interface{}{}
+				continue
+			}
+			settingsMap, ok := settings.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: profile %q must be a mapping", path, name)
+			}
+			file.profiles[name] = settingsMap
+		}
+	}
+
+	return file, nil
+}
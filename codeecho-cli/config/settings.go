@@ -0,0 +1,328 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Setting keys. The same names are used in config files, as flag names
+// and (upper-cased, "-" replaced by "_", prefixed with CODEECHO_) as
+// environment variables.
+const (
+	KeyFormat           = "format"
+	KeyOutput           = "output"
+	KeyTemplate         = "template"
+	KeyIncludeSummary   = "include-summary"
+	KeyIncludeTree      = "include-tree"
+	KeyLineNumbers      = "line-numbers"
+	KeyTabWidth         = "tab-width"
+	KeyLineEndings      = "line-endings"
+	KeyParsable         = "parsable"
+	KeyCompressCode     = "compress-code"
+	KeyCompress         = "compress"
+	KeyRemoveComments   = "remove-comments"
+	KeyRemoveEmptyLines = "remove-empty-lines"
+	KeyKeepDocComments  = "keep-doc-comments"
+	KeyContent          = "content"
+	KeyExcludeDirs      = "exclude-dirs"
+	KeyIncludeExts      = "include-exts"
+	KeyInclude          = "include"
+	KeyIgnore           = "ignore"
+	KeyGitignore        = "gitignore"
+	KeyTokenizer        = "tokenizer"
+	KeyMaxTokens        = "max-tokens"
+	KeyBudgetStrategy   = "budget-strategy"
+	KeySplitSize        = "split-size"
+	KeySplitTokens      = "split-tokens"
+	KeySplitBy          = "split-by"
+	KeyRedactSecrets    = "redact-secrets"
+	KeyRedactRegex      = "redact-regex"
+	KeyJobs             = "jobs"
+	KeyMaxInFlight      = "max-in-flight"
+	KeyProgress         = "progress"
+	KeyQuiet            = "quiet"
+	KeyIncludeErrors    = "include-errors"
+	KeyReport           = "report"
+	KeyStrict           = "strict"
+)
+
+// Built-in defaults shared by every command
+var (
+	DefaultExcludeDirs = []string{".git", "node_modules", "vendor", ".vscode", ".idea", "target", "build", "dist"}
+	DefaultIncludeExts = []string{".go", ".js", ".ts", ".jsx", ".tsx", ".json", ".md", ".html", ".css", ".py", ".java", ".cpp", ".c", ".h", ".rs", ".rb", ".php", ".yml", ".yaml", ".toml", ".xml"}
+)
+
+type valueKind int
+
+const (
+	kindBool valueKind = iota
+	kindString
+	kindInt
+	kindList
+)
+
+type keySpec struct {
+	name string
+	kind valueKind
+	def  interface{}
+}
+
+// keySpecs lists every setting in display order
+var keySpecs = []keySpec{
+	{KeyFormat, kindString, "xml"},
+	{KeyOutput, kindString, ""},
+	{KeyTemplate, kindString, ""},
+	{KeyIncludeSummary, kindBool, true},
+	{KeyIncludeTree, kindBool, true},
+	{KeyLineNumbers, kindBool, false},
+	{KeyTabWidth, kindInt, 0},
+	{KeyLineEndings, kindString, ""},
+	{KeyParsable, kindBool, true},
+	{KeyCompressCode, kindBool, false},
+	{KeyCompress, kindString, ""},
+	{KeyRemoveComments, kindBool, false},
+	{KeyRemoveEmptyLines, kindBool, false},
+	{KeyKeepDocComments, kindBool, false},
+	{KeyContent, kindBool, true},
+	{KeyExcludeDirs, kindList, DefaultExcludeDirs},
+	{KeyIncludeExts, kindList, DefaultIncludeExts},
+	{KeyInclude, kindList, []string{}},
+	{KeyIgnore, kindList, []string{}},
+	{KeyGitignore, kindBool, true},
+	{KeyTokenizer, kindString, "cl100k"},
+	{KeyMaxTokens, kindInt, 0},
+	{KeyBudgetStrategy, kindString, "drop"},
+	{KeySplitSize, kindString, ""},
+	{KeySplitTokens, kindInt, 0},
+	{KeySplitBy, kindString, ""},
+	{KeyRedactSecrets, kindBool, true},
+	{KeyRedactRegex, kindList, []string{}},
+	{KeyJobs, kindInt, 0},
+	{KeyMaxInFlight, kindString, ""},
+	{KeyProgress, kindString, "auto"},
+	{KeyQuiet, kindBool, false},
+	{KeyIncludeErrors, kindBool, true},
+	{KeyReport, kindString, ""},
+	{KeyStrict, kindBool, false},
+}
+
+func lookupSpec(key string) (keySpec, bool) {
+	for _, spec := range keySpecs {
+		if spec.name == key {
+			return spec, true
+		}
+	}
+	return keySpec{}, false
+}
+
+// Source describes where a setting's effective value came from
+const SourceDefault = "default"
+
+// Value is a resolved setting together with its origin
+type Value struct {
+	Value  interface{}
+	Source string
+}
+
+// Config holds the effective settings after all layers were applied
+type Config struct {
+	Profile string   // Selected profile ("" when none)
+	Files   []string // Config files that were read, lowest precedence first
+
+	values map[string]Value
+}
+
+// NewConfig returns a Config populated with the built-in defaults
+func NewConfig() *Config {
+	c := &Config{values: make(map[string]Value)}
+	for _, spec := range keySpecs {
+		c.values[spec.name] = Value{Value: copyValue(spec.def), Source: SourceDefault}
+	}
+	return c
+}
+
+// Keys returns all setting names in display order
+func Keys() []string {
+	keys := make([]string, len(keySpecs))
+	for i, spec := range keySpecs {
+		keys[i] = spec.name
+	}
+	return keys
+}
+
+// Get returns the effective value of key and where it came from
+func (c *Config) Get(key string) Value {
+	return c.values[key]
+}
+
+// Set overrides a setting. The value must match the key's type.
+func (c *Config) Set(key string, value interface{}, source string) error {
+	spec, ok := lookupSpec(key)
+	if !ok {
+		return fmt.Errorf("unknown setting %q", key)
+	}
+
+	converted, err := convertValue(spec, value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	c.values[key] = Value{Value: converted, Source: source}
+	return nil
+}
+
+// Bool returns a boolean setting
+func (c *Config) Bool(key string) bool {
+	b, _ := c.values[key].Value.(bool)
+	return b
+}
+
+// String returns a string setting
+func (c *Config) String(key string) string {
+	s, _ := c.values[key].Value.(string)
+	return s
+}
+
+// Int returns an integer setting
+func (c *Config) Int(key string) int {
+	n, _ := c.values[key].Value.(int)
+	return n
+}
+
+// Strings returns a copy of a list setting
+func (c *Config) Strings(key string) []string {
+	list, _ := c.values[key].Value.([]string)
+	return append([]string(nil), list...)
+}
+
+// OutputOptions builds the writer options from the effective settings.
+// Compress is not validated; see scanner.ParseCompressMode.
+func (c *Config) OutputOptions() OutputOptions {
+	return OutputOptions{
+		IncludeSummary:       c.Bool(KeyIncludeSummary),
+		IncludeDirectoryTree: c.Bool(KeyIncludeTree),
+		ShowLineNumbers:      c.Bool(KeyLineNumbers),
+		TabWidth:             c.Int(KeyTabWidth),
+		LineEndings:          c.String(KeyLineEndings),
+		IncludeContent:       c.Bool(KeyContent),
+		RemoveComments:       c.Bool(KeyRemoveComments) || c.Bool(KeyKeepDocComments),
+		RemoveEmptyLines:     c.Bool(KeyRemoveEmptyLines),
+		KeepDocComments:      c.Bool(KeyKeepDocComments),
+		Compress:             c.CompressMode(),
+		IncludeErrors:        c.Bool(KeyIncludeErrors),
+	}
+}
+
+// CompressMode resolves the compression mode: "compress" wins, and the
+// older "compress-code" switch means whitespace compression
+func (c *Config) CompressMode() string {
+	if mode := c.String(KeyCompress); mode != "" {
+		return strings.ToLower(mode)
+	}
+	if c.Bool(KeyCompressCode) {
+		return "whitespace"
+	}
+	return ""
+}
+
+// FormatValue renders a setting value for display
+func FormatValue(value interface{}) string {
+	switch v := value.(type) {
+	case []string:
+		return "[" + strings.Join(v, ", ") + "]"
+	case string:
+		return strconv.Quote(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// convertValue coerces YAML, environment and flag values to the key's type.
+// Strings are accepted for every kind so environment variables work.
+func convertValue(spec keySpec, value interface{}) (interface{}, error) {
+	switch spec.kind {
+	case kindBool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return nil, fmt.Errorf("expected a boolean, got %q", v)
+			}
+			return b, nil
+		}
+		return nil, fmt.Errorf("expected a boolean, got %v", value)
+
+	case kindString:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case bool, int, float64:
+			return fmt.Sprint(v), nil
+		}
+		return nil, fmt.Errorf("expected a string, got %v", value)
+
+	case kindInt:
+		switch v := value.(type) {
+		case int:
+			return v, nil
+		case float64:
+			if v == float64(int(v)) {
+				return int(v), nil
+			}
+		case string:
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				return nil, fmt.Errorf("expected an integer, got %q", v)
+			}
+			return n, nil
+		}
+		return nil, fmt.Errorf("expected an integer, got %v", value)
+
+	case kindList:
+		switch v := value.(type) {
+		case []string:
+			return append([]string{}, v...), nil
+		case []interface{}:
+			list := make([]string, 0, len(v))
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("expected a list of strings, got item %v", item)
+				}
+				list = append(list, s)
+			}
+			return list, nil
+		case string:
+			// Comma-separated, matching how list flags are parsed
+			list := []string{}
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+			return list, nil
+		}
+		return nil, fmt.Errorf("expected a list of strings, got %v", value)
+	}
+	return nil, fmt.Errorf("unsupported setting type")
+}
+
+func copyValue(value interface{}) interface{} {
+	if list, ok := value.([]string); ok {
+		return append([]string{}, list...)
+	}
+	return value
+}
+
+// sortedKeys returns map keys in a stable order for error messages
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,5 +1,7 @@
 package config
 
+import "text/template"
+
 type OutputOptions struct {
 	IncludeSummary       bool
 	IncludeDirectoryTree bool
@@ -7,5 +9,22 @@ type OutputOptions struct {
 	IncludeContent       bool
 	RemoveComments       bool
 	RemoveEmptyLines     bool
-	CompressCode         bool
-}
\ No newline at end of file
+	KeepDocComments      bool
+	Compress             string // "whitespace" or "signatures"; "" when off
+	IncludeErrors        bool   // List read errors and skipped files in the footer
+	TabWidth             int    // Expand tabs to this many columns; 0 keeps tabs
+	LineEndings          string // "lf" or "crlf"; "" keeps them as read
+
+	// Set when packing a git revision (scan --ref) instead of the work tree
+	Revision   string
+	CommitSHA  string
+	CommitDate string
+
+	// Set for scan --template, with the "template" format
+	Template *template.Template
+
+	// Set when the pack is split into parts (scan --split-*)
+	Part      int
+	PartCount int
+	PartGroup string // Directory or language for --split-by
+}
@@ -0,0 +1,160 @@
+package gitrepo
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// ChangeStatus describes what happened to a path
+type ChangeStatus string
+
+const (
+	StatusAdded    ChangeStatus = "added"
+	StatusModified ChangeStatus = "modified"
+	StatusDeleted  ChangeStatus = "deleted"
+	StatusRenamed  ChangeStatus = "renamed"
+)
+
+// Change is one entry from git's name-status output.
+// Paths are slash-separated and relative to the directory that was queried.
+type Change struct {
+	Path    string
+	OldPath string // Previous path for renames
+	Status  ChangeStatus
+}
+
+// DiffOptions selects what the changes are compared against.
+// Exactly one of the fields should be set.
+type DiffOptions struct {
+	Since       string // Changes between this ref and the working tree
+	Staged      bool   // Changes in the index relative to HEAD
+	WorkingTree bool   // Unstaged changes relative to the index
+}
+
+// ChangedFiles asks git which files changed below dir.
+// Untracked files are reported as added for Since and WorkingTree, since
+// they are part of what a reviewer would see.
+func ChangedFiles(dir string, opts DiffOptions) ([]Change, error) {
+	if _, err := runGit(dir, "rev-parse", "--git-dir"); err != nil {
+		return nil, fmt.Errorf("%s is not inside a git repository", dir)
+	}
+
+	args := []string{"diff", "--relative", "--name-status", "-z", "-M"}
+	includeUntracked := true
+
+	switch {
+	case opts.Since != "":
+		if _, err := runGit(dir, "rev-parse", "--verify", "--quiet", opts.Since+"^{commit}"); err != nil {
+			return nil, fmt.Errorf("unknown git ref %q", opts.Since)
+		}
+		args = append(args, opts.Since, "--")
+	case opts.Staged:
+		args = append(args, "--cached", "--")
+		includeUntracked = false
+	case opts.WorkingTree:
+		args = append(args, "--")
+	default:
+		return nil, fmt.Errorf("no diff mode selected")
+	}
+
+	out, err := runGit(dir, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := parseNameStatus(out)
+	if err != nil {
+		return nil, err
+	}
+
+	if includeUntracked {
+		out, err := runGit(dir, "ls-files", "--others", "--exclude-standard", "-z")
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range splitNUL(out) {
+			changes = append(changes, Change{Path: path, Status: StatusAdded})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+// parseNameStatus decodes `git diff --name-status -z` output:
+// a status field followed by one path, or two for renames and copies
+func parseNameStatus(out []byte) ([]Change, error) {
+	fields := splitNUL(out)
+	var changes []Change
+
+	for i := 0; i < len(fields); i++ {
+		status := fields[i]
+		if status == "" {
+			continue
+		}
+
+		switch status[0] {
+		case 'R', 'C':
+			if i+2 >= len(fields) {
+				return nil, fmt.Errorf("malformed git diff output near %q", status)
+			}
+			oldPath, newPath := fields[i+1], fields[i+2]
+			i += 2
+			if status[0] == 'R' {
+				changes = append(changes, Change{Path: newPath, OldPath: oldPath, Status: StatusRenamed})
+			} else {
+				changes = append(changes, Change{Path: newPath, Status: StatusAdded})
+			}
+
+		default:
+			if i+1 >= len(fields) {
+				return nil, fmt.Errorf("malformed git diff output near %q", status)
+			}
+			path := fields[i+1]
+			i++
+
+			change := Change{Path: path, Status: StatusModified}
+			switch status[0] {
+			case 'A':
+				change.Status = StatusAdded
+			case 'D':
+				change.Status = StatusDeleted
+			}
+			changes = append(changes, change)
+		}
+	}
+
+	return changes, nil
+}
+
+func splitNUL(out []byte) []string {
+	var fields []string
+	for _, field := range bytes.Split(out, []byte{0}) {
+		if len(field) > 0 {
+			fields = append(fields, string(field))
+		}
+	}
+	return fields
+}
+
+// runGit runs git in dir and returns stdout, folding stderr into the error
+func runGit(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return out, nil
+}
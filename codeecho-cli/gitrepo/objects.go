@@ -0,0 +1,256 @@
+package gitrepo
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Hash is a SHA-1 object name
+type Hash [20]byte
+
+func (h Hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// ParseHash decodes a 40-character hex object name
+func ParseHash(s string) (Hash, error) {
+	var h Hash
+	if len(s) != 40 {
+		return h, fmt.Errorf("invalid object name %q", s)
+	}
+	if _, err := hex.Decode(h[:], []byte(s)); err != nil {
+		return h, fmt.Errorf("invalid object name %q", s)
+	}
+	return h, nil
+}
+
+// ObjectType is the kind of a git object
+type ObjectType string
+
+const (
+	ObjectCommit ObjectType = "commit"
+	ObjectTree   ObjectType = "tree"
+	ObjectBlob   ObjectType = "blob"
+	ObjectTag    ObjectType = "tag"
+)
+
+// Commit holds the fields of a commit object CodeEcho needs
+type Commit struct {
+	Hash          Hash
+	Tree          Hash
+	Parents       []Hash
+	CommitterDate time.Time
+}
+
+// TreeEntry is one entry of a tree object
+type TreeEntry struct {
+	Name string
+	Mode string
+	Hash Hash
+}
+
+// IsDir reports whether the entry is a subtree
+func (e TreeEntry) IsDir() bool {
+	return e.Mode == "40000"
+}
+
+// IsFile reports whether the entry is a regular (possibly executable) file.
+// Symlinks and submodules are not considered files.
+func (e TreeEntry) IsFile() bool {
+	return e.Mode == "100644" || e.Mode == "100755" || e.Mode == "100664"
+}
+
+// ReadObject returns the type and raw contents of an object,
+// looking at loose objects first and then every pack
+func (r *Repository) ReadObject(hash Hash) (ObjectType, []byte, error) {
+	objType, data, err := r.readLoose(hash)
+	if err == nil {
+		return objType, data, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", nil, err
+	}
+
+	for _, pack := range r.packs {
+		if offset, ok := pack.index.find(hash); ok {
+			return pack.readAt(r, offset)
+		}
+	}
+	return "", nil, fmt.Errorf("object %s not found", hash)
+}
+
+func (r *Repository) readLoose(hash Hash) (ObjectType, []byte, error) {
+	name := hash.String()
+	f, err := os.Open(filepath.Join(r.common, "objects", name[:2], name[2:]))
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return "", nil, fmt.Errorf("object %s: %w", name, err)
+	}
+	defer zr.Close()
+
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return "", nil, fmt.Errorf("object %s: %w", name, err)
+	}
+
+	// Loose objects start with "<type> <size>\x00"
+	header, data, found := bytes.Cut(raw, []byte{0})
+	if !found {
+		return "", nil, fmt.Errorf("object %s: missing header", name)
+	}
+	typeName, _, _ := strings.Cut(string(header), " ")
+	return ObjectType(typeName), data, nil
+}
+
+// ReadCommit parses a commit object
+func (r *Repository) ReadCommit(hash Hash) (*Commit, error) {
+	objType, data, err := r.ReadObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if objType != ObjectCommit {
+		return nil, fmt.Errorf("%s is a %s, not a commit", hash, objType)
+	}
+
+	commit := &Commit{Hash: hash}
+	headers, _, _ := bytes.Cut(data, []byte("\n\n"))
+	for _, line := range strings.Split(string(headers), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "tree":
+			if commit.Tree, err = ParseHash(value); err != nil {
+				return nil, err
+			}
+		case "parent":
+			parent, err := ParseHash(value)
+			if err != nil {
+				return nil, err
+			}
+			commit.Parents = append(commit.Parents, parent)
+		case "committer":
+			commit.CommitterDate = parseSignatureTime(value)
+		}
+	}
+	return commit, nil
+}
+
+// ReadTree parses a tree object
+func (r *Repository) ReadTree(hash Hash) ([]TreeEntry, error) {
+	objType, data, err := r.ReadObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if objType != ObjectTree {
+		return nil, fmt.Errorf("%s is a %s, not a tree", hash, objType)
+	}
+
+	// Entries are "<mode> <name>\x00<20-byte hash>"
+	var entries []TreeEntry
+	for len(data) > 0 {
+		space := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		if space < 0 || nul < space || nul+21 > len(data) {
+			return nil, fmt.Errorf("tree %s is malformed", hash)
+		}
+
+		entry := TreeEntry{
+			Mode: string(data[:space]),
+			Name: string(data[space+1 : nul]),
+		}
+		copy(entry.Hash[:], data[nul+1:nul+21])
+		entries = append(entries, entry)
+		data = data[nul+21:]
+	}
+	return entries, nil
+}
+
+// ReadBlob returns the contents of a blob
+func (r *Repository) ReadBlob(hash Hash) ([]byte, error) {
+	objType, data, err := r.ReadObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if objType != ObjectBlob {
+		return nil, fmt.Errorf("%s is a %s, not a blob", hash, objType)
+	}
+	return data, nil
+}
+
+// SubTree returns the tree at a slash-separated path below root
+func (r *Repository) SubTree(root Hash, path string) (Hash, error) {
+	current := root
+	for _, part := range strings.Split(path, "/") {
+		if part == "" || part == "." {
+			continue
+		}
+
+		entries, err := r.ReadTree(current)
+		if err != nil {
+			return Hash{}, err
+		}
+
+		found := false
+		for _, entry := range entries {
+			if entry.Name == part && entry.IsDir() {
+				current, found = entry.Hash, true
+				break
+			}
+		}
+		if !found {
+			return Hash{}, fmt.Errorf("path %q does not exist in this revision", path)
+		}
+	}
+	return current, nil
+}
+
+// parseSignatureTime reads the "<unix> <+zzzz>" suffix of a signature line
+func parseSignatureTime(signature string) time.Time {
+	fields := strings.Fields(signature)
+	if len(fields) < 2 {
+		return time.Time{}
+	}
+
+	seconds, err := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	t := time.Unix(seconds, 0)
+
+	tz := fields[len(fields)-1]
+	if len(tz) == 5 {
+		hours, err1 := strconv.Atoi(tz[1:3])
+		minutes, err2 := strconv.Atoi(tz[3:5])
+		if err1 == nil && err2 == nil {
+			offset := hours*3600 + minutes*60
+			if tz[0] == '-' {
+				offset = -offset
+			}
+			t = t.In(time.FixedZone(tz, offset))
+		}
+	}
+	return t
+}
+
+// headerField returns the value of the first "key value" header line
+func headerField(data []byte, key string) (string, bool) {
+	headers, _, _ := bytes.Cut(data, []byte("\n\n"))
+	for _, line := range strings.Split(string(headers), "\n") {
+		if value, ok := strings.CutPrefix(line, key+" "); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,195 @@
+package gitrepo
+
+import (
+	"bytes"
+	"compress/zlib"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLooseObjects(t *testing.T) {
+	dir := newFixture(t) // Never packed, so every object is loose
+	repo := checkObjects(t, dir)
+	if len(repo.packs) != 0 {
+		t.Fatalf("got %d packs, want none", len(repo.packs))
+	}
+
+	head, err := repo.ResolveCommit("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.ReadCommit(head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.TrimSpace(git(t, dir, "rev-parse", "HEAD^{tree}")); commit.Tree.String() != want {
+		t.Errorf("tree = %s, want %s", commit.Tree, want)
+	}
+	if want := strings.TrimSpace(git(t, dir, "rev-parse", "HEAD~1")); len(commit.Parents) != 1 || commit.Parents[0].String() != want {
+		t.Errorf("parents = %v, want [%s]", commit.Parents, want)
+	}
+	if want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC); !commit.CommitterDate.Equal(want) {
+		t.Errorf("committer date = %s, want %s", commit.CommitterDate, want)
+	}
+
+	sub, err := repo.SubTree(commit.Tree, "sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := repo.ReadTree(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsFile() || entry.IsDir() {
+			t.Errorf("%s has mode %s, want a file", entry.Name, entry.Mode)
+		}
+		names = append(names, entry.Name)
+	}
+	if got, want := strings.Join(names, " "), "file0.go file1.go file2.go file3.go"; got != want {
+		t.Errorf("sub entries = %s, want %s", got, want)
+	}
+
+	blob, err := repo.ReadBlob(entries[2].Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "package sub\n\nconst N = 2\n"; string(blob) != want {
+		t.Errorf("blob = %q, want %q", blob, want)
+	}
+}
+
+func TestObjectTypeMismatch(t *testing.T) {
+	dir := newFixture(t)
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	head, err := repo.ResolveCommit("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.ReadCommit(head)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.ReadBlob(commit.Tree); err == nil {
+		t.Error("ReadBlob of a tree succeeded")
+	}
+	if _, err := repo.ReadTree(head); err == nil {
+		t.Error("ReadTree of a commit succeeded")
+	}
+	if _, err := repo.ReadCommit(commit.Tree); err == nil {
+		t.Error("ReadCommit of a tree succeeded")
+	}
+	if _, err := repo.SubTree(commit.Tree, "sub/missing"); err == nil {
+		t.Error("SubTree of a missing path succeeded")
+	}
+	if _, _, err := repo.ReadObject(Hash{1, 2, 3}); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("ReadObject of a missing object: error = %v, want not found", err)
+	}
+}
+
+// writeLoose stores raw as the loose object hash, replacing what was there
+func writeLoose(t *testing.T, dir string, hash Hash, raw []byte, compress bool) {
+	t.Helper()
+	name := hash.String()
+	path := filepath.Join(dir, ".git", "objects", name[:2], name[2:])
+
+	data := raw
+	if compress {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		zw.Write(raw)
+		zw.Close()
+		data = buf.Bytes()
+	}
+
+	os.Chmod(path, 0o644) // Git writes objects read-only
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCorruptLooseObject(t *testing.T) {
+	dir := newFixture(t)
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	head, err := repo.ResolveCommit("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.ReadCommit(head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := head.String()
+	original, err := os.ReadFile(filepath.Join(dir, ".git", "objects", name[:2], name[2:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		target   Hash
+		raw      []byte
+		compress bool
+		read     func() error
+	}{
+		{
+			name:   "not zlib",
+			target: head,
+			raw:    []byte("plain text"),
+			read:   func() error { _, _, err := repo.ReadObject(head); return err },
+		},
+		{
+			name:   "truncated zlib",
+			target: head,
+			raw:    original[:len(original)/2],
+			read:   func() error { _, _, err := repo.ReadObject(head); return err },
+		},
+		{
+			name:     "no header",
+			target:   head,
+			raw:      []byte("commit 12"),
+			compress: true,
+			read:     func() error { _, _, err := repo.ReadObject(head); return err },
+		},
+		{
+			name:     "bad tree hash",
+			target:   head,
+			raw:      []byte("commit 20\x00tree 1234\n\nmessage\n"),
+			compress: true,
+			read:     func() error { _, err := repo.ReadCommit(head); return err },
+		},
+		{
+			name:     "malformed tree",
+			target:   commit.Tree,
+			raw:      []byte("tree 10\x00100644 a.go\x00short"),
+			compress: true,
+			read:     func() error { _, err := repo.ReadTree(commit.Tree); return err },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeLoose(t, dir, tt.target, tt.raw, tt.compress)
+			if err := tt.read(); err == nil {
+				t.Fatal("read succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,409 @@
+package gitrepo
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Pack entry types as stored in the pack header
+const (
+	packCommit   = 1
+	packTree     = 2
+	packBlob     = 3
+	packTag      = 4
+	packOfsDelta = 6
+	packRefDelta = 7
+)
+
+// maxCachedBases bounds the delta base cache (entries, not bytes)
+const maxCachedBases = 256
+
+// maxRefDeltaDepth bounds chains of REF deltas, whose bases can be
+// anywhere, so a corrupt pack can't send a read round in circles
+const maxRefDeltaDepth = 1000
+
+type cachedObject struct {
+	objType ObjectType
+	data    []byte
+}
+
+// packFile is an open .pack with its parsed version 2 .idx
+type packFile struct {
+	path  string
+	file  *os.File
+	index *packIndex
+	cache map[int64]cachedObject
+}
+
+// packIndex is a version 2 pack index held in memory
+type packIndex struct {
+	fanout    [256]uint32
+	hashes    []byte // count*20 sorted object names
+	offsets   []byte // count*4 offsets (MSB set: index into large)
+	largeOffs []byte // 8-byte offsets for packs over 2GB
+}
+
+// loadPacks opens every pack in objects/pack
+func (r *Repository) loadPacks() error {
+	idxFiles, err := filepath.Glob(filepath.Join(r.common, "objects", "pack", "*.idx"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(idxFiles)
+
+	for _, idxPath := range idxFiles {
+		index, err := readPackIndex(idxPath)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(idxPath), err)
+		}
+
+		packPath := strings.TrimSuffix(idxPath, ".idx") + ".pack"
+		f, err := os.Open(packPath)
+		if err != nil {
+			return err
+		}
+		r.packs = append(r.packs, &packFile{
+			path:  packPath,
+			file:  f,
+			index: index,
+			cache: make(map[int64]cachedObject),
+		})
+	}
+	return nil
+}
+
+// Close releases the open pack files
+func (r *Repository) Close() error {
+	var firstErr error
+	for _, pack := range r.packs {
+		if err := pack.file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	r.packs = nil
+	return firstErr
+}
+
+func readPackIndex(path string) (*packIndex, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8+256*4 || !bytes.Equal(data[:4], []byte{0xff, 't', 'O', 'c'}) {
+		return nil, fmt.Errorf("unsupported pack index (only version 2 is supported)")
+	}
+	if version := binary.BigEndian.Uint32(data[4:8]); version != 2 {
+		return nil, fmt.Errorf("unsupported pack index version %d", version)
+	}
+
+	idx := &packIndex{}
+	pos := 8
+	for i := range idx.fanout {
+		idx.fanout[i] = binary.BigEndian.Uint32(data[pos:])
+		pos += 4
+	}
+
+	count := int(idx.fanout[255])
+	need := pos + count*20 + count*4 + count*4
+	if len(data) < need {
+		return nil, fmt.Errorf("pack index is truncated")
+	}
+
+	idx.hashes = data[pos : pos+count*20]
+	pos += count * 20
+	pos += count * 4 // CRC32 table, not needed for reading
+	idx.offsets = data[pos : pos+count*4]
+	pos += count * 4
+	idx.largeOffs = data[pos:]
+
+	return idx, nil
+}
+
+func (idx *packIndex) hashAt(i int) []byte {
+	return idx.hashes[i*20 : i*20+20]
+}
+
+// find returns the pack offset of an object
+func (idx *packIndex) find(hash Hash) (int64, bool) {
+	lo := 0
+	if hash[0] > 0 {
+		lo = int(idx.fanout[hash[0]-1])
+	}
+	hi := int(idx.fanout[hash[0]])
+
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(idx.hashAt(lo+i), hash[:]) >= 0
+	})
+	if i >= hi || !bytes.Equal(idx.hashAt(i), hash[:]) {
+		return 0, false
+	}
+
+	offset := binary.BigEndian.Uint32(idx.offsets[i*4:])
+	if offset&0x80000000 == 0 {
+		return int64(offset), true
+	}
+	large := int(offset&0x7fffffff) * 8
+	if large+8 > len(idx.largeOffs) {
+		return 0, false
+	}
+	return int64(binary.BigEndian.Uint64(idx.largeOffs[large:])), true
+}
+
+// withPrefix returns all object names starting with a hex prefix
+func (idx *packIndex) withPrefix(prefix string) []Hash {
+	first, err := hex.DecodeString(prefix[:2])
+	if err != nil {
+		return nil
+	}
+
+	lo := 0
+	if first[0] > 0 {
+		lo = int(idx.fanout[first[0]-1])
+	}
+	hi := int(idx.fanout[first[0]])
+
+	var matches []Hash
+	for i := lo; i < hi; i++ {
+		name := hex.EncodeToString(idx.hashAt(i))
+		if strings.HasPrefix(name, prefix) {
+			var h Hash
+			copy(h[:], idx.hashAt(i))
+			matches = append(matches, h)
+		}
+	}
+	return matches
+}
+
+// readAt decodes the object stored at offset, resolving deltas
+func (p *packFile) readAt(r *Repository, offset int64) (ObjectType, []byte, error) {
+	if cached, ok := p.cache[offset]; ok {
+		return cached.objType, cached.data, nil
+	}
+
+	header := make([]byte, 32)
+	n, err := p.file.ReadAt(header, offset)
+	if err != nil && err != io.EOF {
+		return "", nil, err
+	}
+	header = header[:n]
+
+	// Type and size: 3 type bits and a little-endian base-128 size
+	pos := 0
+	if len(header) == 0 {
+		return "", nil, fmt.Errorf("pack offset %d is out of range", offset)
+	}
+	c := header[pos]
+	pos++
+	kind := (c >> 4) & 7
+	size := int64(c & 0x0f)
+	shift := uint(4)
+	for c&0x80 != 0 {
+		if pos >= len(header) || shift > 56 {
+			return "", nil, fmt.Errorf("pack entry at %d has a bad header", offset)
+		}
+		c = header[pos]
+		pos++
+		size |= int64(c&0x7f) << shift
+		shift += 7
+	}
+
+	var objType ObjectType
+	var data []byte
+
+	switch kind {
+	case packCommit, packTree, packBlob, packTag:
+		objType = [...]ObjectType{packCommit: ObjectCommit, packTree: ObjectTree, packBlob: ObjectBlob, packTag: ObjectTag}[kind]
+		if data, err = p.inflate(offset+int64(pos), size); err != nil {
+			return "", nil, err
+		}
+
+	case packOfsDelta:
+		// Base offset uses git's "offset encoding" (big-endian with +1 per byte)
+		if pos >= len(header) {
+			return "", nil, fmt.Errorf("pack entry at %d has a bad delta header", offset)
+		}
+		c = header[pos]
+		pos++
+		rel := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			if pos >= len(header) || rel > offset {
+				return "", nil, fmt.Errorf("pack entry at %d has a bad delta header", offset)
+			}
+			c = header[pos]
+			pos++
+			rel = ((rel + 1) << 7) | int64(c&0x7f)
+		}
+		// Bases come earlier in the pack, which also rules out cycles
+		if rel <= 0 || rel > offset {
+			return "", nil, fmt.Errorf("pack entry at %d has a bad delta base", offset)
+		}
+
+		baseType, base, err := p.readAt(r, offset-rel)
+		if err != nil {
+			return "", nil, err
+		}
+		delta, err := p.inflate(offset+int64(pos), size)
+		if err != nil {
+			return "", nil, err
+		}
+		objType = baseType
+		if data, err = applyDelta(base, delta); err != nil {
+			return "", nil, err
+		}
+
+	case packRefDelta:
+		if pos+20 > len(header) {
+			return "", nil, fmt.Errorf("pack entry at %d has a bad delta header", offset)
+		}
+		var baseHash Hash
+		copy(baseHash[:], header[pos:pos+20])
+		pos += 20
+
+		if r.refDeltaDepth >= maxRefDeltaDepth {
+			return "", nil, fmt.Errorf("pack entry at %d has a delta chain that is too deep", offset)
+		}
+		r.refDeltaDepth++
+		baseType, base, err := r.ReadObject(baseHash)
+		r.refDeltaDepth--
+		if err != nil {
+			return "", nil, err
+		}
+		delta, err := p.inflate(offset+int64(pos), size)
+		if err != nil {
+			return "", nil, err
+		}
+		objType = baseType
+		if data, err = applyDelta(base, delta); err != nil {
+			return "", nil, err
+		}
+
+	default:
+		return "", nil, fmt.Errorf("pack entry at %d has unknown type %d", offset, kind)
+	}
+
+	// Trees and commits are delta bases far more often than blobs
+	if objType != ObjectBlob {
+		if len(p.cache) >= maxCachedBases {
+			p.cache = make(map[int64]cachedObject)
+		}
+		p.cache[offset] = cachedObject{objType: objType, data: data}
+	}
+
+	return objType, data, nil
+}
+
+// inflate decompresses size bytes of zlib data starting at offset
+func (p *packFile) inflate(offset, size int64) ([]byte, error) {
+	zr, err := zlib.NewReader(io.NewSectionReader(p.file, offset, 1<<62))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(p.path), err)
+	}
+	defer zr.Close()
+
+	// Sizes come from the pack, so they are checked rather than trusted
+	data, err := io.ReadAll(io.LimitReader(zr, size))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(p.path), err)
+	}
+	if int64(len(data)) != size {
+		return nil, fmt.Errorf("%s: entry at %d is truncated", filepath.Base(p.path), offset)
+	}
+	return data, nil
+}
+
+// applyDelta rebuilds an object from its base and a git delta
+func applyDelta(base, delta []byte) ([]byte, error) {
+	pos := 0
+	readSize := func() (int, error) {
+		size, shift := 0, uint(0)
+		for {
+			if pos >= len(delta) {
+				return 0, fmt.Errorf("delta is truncated")
+			}
+			if shift > 56 {
+				return 0, fmt.Errorf("delta size is too large")
+			}
+			c := delta[pos]
+			pos++
+			size |= int(c&0x7f) << shift
+			shift += 7
+			if c&0x80 == 0 {
+				return size, nil
+			}
+		}
+	}
+
+	srcSize, err := readSize()
+	if err != nil {
+		return nil, err
+	}
+	if srcSize != len(base) {
+		return nil, fmt.Errorf("delta base size mismatch")
+	}
+	dstSize, err := readSize()
+	if err != nil {
+		return nil, err
+	}
+
+	// Copies can repeat the base, so dstSize is only a hint
+	out := make([]byte, 0, min(dstSize, len(base)+len(delta)))
+	for pos < len(delta) {
+		op := delta[pos]
+		pos++
+
+		switch {
+		case op&0x80 != 0:
+			// Copy from base: bits 0-3 select offset bytes, 4-6 size bytes
+			var offset, size int
+			for i := uint(0); i < 4; i++ {
+				if op&(1<<i) != 0 {
+					if pos >= len(delta) {
+						return nil, fmt.Errorf("delta is truncated")
+					}
+					offset |= int(delta[pos]) << (8 * i)
+					pos++
+				}
+			}
+			for i := uint(0); i < 3; i++ {
+				if op&(1<<(4+i)) != 0 {
+					if pos >= len(delta) {
+						return nil, fmt.Errorf("delta is truncated")
+					}
+					size |= int(delta[pos]) << (8 * i)
+					pos++
+				}
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > len(base) {
+				return nil, fmt.Errorf("delta copies past the end of its base")
+			}
+			out = append(out, base[offset:offset+size]...)
+
+		case op != 0:
+			// Insert the next op bytes literally
+			if pos+int(op) > len(delta) {
+				return nil, fmt.Errorf("delta is truncated")
+			}
+			out = append(out, delta[pos:pos+int(op)]...)
+			pos += int(op)
+
+		default:
+			return nil, fmt.Errorf("delta has a reserved opcode")
+		}
+	}
+
+	if len(out) != dstSize {
+		return nil, fmt.Errorf("delta result size mismatch")
+	}
+	return out, nil
+}
@@ -0,0 +1,433 @@
+package gitrepo
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Fixtures are real repositories built with the git binary, packed with
+// git gc and git repack, so the reader is checked against what git writes
+
+// git runs a git command in dir and returns its output
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_SYSTEM=/dev/null",
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		"GIT_AUTHOR_DATE=2024-01-02T03:04:05Z", "GIT_COMMITTER_DATE=2024-01-02T03:04:05Z",
+	)
+	out, err := cmd.Output()
+	if err != nil {
+		stderr := ""
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr = string(exitErr.Stderr)
+		}
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, stderr)
+	}
+	return string(out)
+}
+
+// newFixture creates a repository with a few commits of a file that
+// changes a little each time, which git stores as deltas once packed
+func newFixture(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	git(t, dir, "init", "-q")
+	for i := 0; i < 4; i++ {
+		commitRevision(t, dir, i)
+	}
+	return dir
+}
+
+// commitRevision commits the i-th version of the fixture files
+func commitRevision(t *testing.T, dir string, i int) {
+	t.Helper()
+	var content strings.Builder
+	for line := 0; line < 200; line++ {
+		if line%50 == i {
+			fmt.Fprintf(&content, "line %d changed in revision %d\n", line, i)
+			continue
+		}
+		fmt.Fprintf(&content, "line %d of a file long enough to be worth a delta\n", line)
+	}
+
+	writeFile(t, filepath.Join(dir, "big.txt"), content.String())
+	writeFile(t, filepath.Join(dir, "sub", fmt.Sprintf("file%d.go", i)), fmt.Sprintf("package sub\n\nconst N = %d\n", i))
+	git(t, dir, "add", "-A")
+	git(t, dir, "commit", "-q", "-m", fmt.Sprintf("revision %d", i))
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type gitObject struct {
+	objType ObjectType
+	data    []byte
+}
+
+// allObjects reads every object of the repository with git cat-file
+func allObjects(t *testing.T, dir string) map[Hash]gitObject {
+	t.Helper()
+	out := git(t, dir, "cat-file", "--batch-all-objects", "--batch")
+
+	objects := make(map[Hash]gitObject)
+	rd := bufio.NewReader(strings.NewReader(out))
+	for {
+		header, err := rd.ReadString('\n')
+		if err != nil {
+			break
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			t.Fatalf("unexpected cat-file header %q", header)
+		}
+		hash, err := ParseHash(fields[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		size, _ := strconv.Atoi(fields[2])
+		data := make([]byte, size+1) // Content is followed by a newline
+		if _, err := io.ReadFull(rd, data); err != nil {
+			t.Fatal(err)
+		}
+		objects[hash] = gitObject{objType: ObjectType(fields[1]), data: data[:size]}
+	}
+	if len(objects) == 0 {
+		t.Fatal("fixture has no objects")
+	}
+	return objects
+}
+
+// checkObjects reads every object git knows with repo and compares them
+func checkObjects(t *testing.T, dir string) *Repository {
+	t.Helper()
+	want := allObjects(t, dir)
+
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	for hash, obj := range want {
+		objType, data, err := repo.ReadObject(hash)
+		if err != nil {
+			t.Errorf("ReadObject(%s): %v", hash, err)
+			continue
+		}
+		if objType != obj.objType || !bytes.Equal(data, obj.data) {
+			t.Errorf("ReadObject(%s) = %s of %d bytes, want %s of %d bytes", hash, objType, len(data), obj.objType, len(obj.data))
+		}
+	}
+	return repo
+}
+
+// packEntryKinds counts the entries of every pack of repo by pack type
+func packEntryKinds(t *testing.T, repo *Repository) map[byte]int {
+	t.Helper()
+	kinds := make(map[byte]int)
+	for _, pack := range repo.packs {
+		count := int(pack.index.fanout[255])
+		for i := 0; i < count; i++ {
+			var hash Hash
+			copy(hash[:], pack.index.hashAt(i))
+			offset, ok := pack.index.find(hash)
+			if !ok {
+				t.Fatalf("%s is listed in the index but can't be found", hash)
+			}
+			header := make([]byte, 1)
+			if _, err := pack.file.ReadAt(header, offset); err != nil {
+				t.Fatal(err)
+			}
+			kinds[(header[0]>>4)&7]++
+		}
+	}
+	return kinds
+}
+
+func TestPackOfsDeltas(t *testing.T) {
+	dir := newFixture(t)
+	git(t, dir, "gc", "-q", "--aggressive")
+
+	repo := checkObjects(t, dir)
+	if len(repo.packs) != 1 {
+		t.Fatalf("got %d packs, want 1", len(repo.packs))
+	}
+	if kinds := packEntryKinds(t, repo); kinds[packOfsDelta] == 0 {
+		t.Fatalf("fixture has no OFS deltas: %v", kinds)
+	}
+}
+
+func TestPackRefDeltas(t *testing.T) {
+	dir := newFixture(t)
+	git(t, dir, "-c", "repack.useDeltaBaseOffset=false", "repack", "-q", "-a", "-d", "-f")
+
+	repo := checkObjects(t, dir)
+	if kinds := packEntryKinds(t, repo); kinds[packRefDelta] == 0 || kinds[packOfsDelta] != 0 {
+		t.Fatalf("fixture should have only REF deltas: %v", kinds)
+	}
+}
+
+func TestRefDeltaCycle(t *testing.T) {
+	dir := newFixture(t)
+	git(t, dir, "-c", "repack.useDeltaBaseOffset=false", "repack", "-q", "-a", "-d", "-f")
+
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pack := repo.packs[0]
+	repo.Close()
+
+	// Point a REF delta at itself
+	f, err := os.OpenFile(pack.path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var target Hash
+	for i := 0; i < int(pack.index.fanout[255]) && target == (Hash{}); i++ {
+		var hash Hash
+		copy(hash[:], pack.index.hashAt(i))
+		offset, _ := pack.index.find(hash)
+
+		header := make([]byte, 32)
+		if _, err := f.ReadAt(header, offset); err != nil {
+			t.Fatal(err)
+		}
+		if (header[0]>>4)&7 != packRefDelta {
+			continue
+		}
+		pos := 1
+		for header[pos-1]&0x80 != 0 {
+			pos++
+		}
+		if _, err := f.WriteAt(hash[:], offset+int64(pos)); err != nil {
+			t.Fatal(err)
+		}
+		target = hash
+	}
+	if target == (Hash{}) {
+		t.Fatal("fixture has no REF deltas")
+	}
+
+	repo, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	if _, _, err := repo.ReadObject(target); err == nil || !strings.Contains(err.Error(), "too deep") {
+		t.Fatalf("ReadObject(%s) error = %v, want a delta chain error", target, err)
+	}
+}
+
+func TestMultiplePacks(t *testing.T) {
+	dir := newFixture(t)
+	git(t, dir, "gc", "-q")
+
+	// Each incremental repack writes a new pack of the loose objects
+	commitRevision(t, dir, 4)
+	git(t, dir, "repack", "-q", "-d")
+	commitRevision(t, dir, 5)
+	git(t, dir, "repack", "-q", "-d")
+
+	// And the last commit stays loose
+	commitRevision(t, dir, 6)
+
+	repo := checkObjects(t, dir)
+	if len(repo.packs) != 3 {
+		t.Fatalf("got %d packs, want 3", len(repo.packs))
+	}
+
+	head, err := repo.ResolveCommit("HEAD~3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.TrimSpace(git(t, dir, "rev-parse", "HEAD~3")); head.String() != want {
+		t.Errorf("HEAD~3 = %s, want %s", head, want)
+	}
+
+	hashes, err := repo.expandHash(head.String()[:7])
+	if err != nil || hashes != head {
+		t.Errorf("expandHash(%s) = %s, %v; want %s", head.String()[:7], hashes, err, head)
+	}
+}
+
+// packedFixture returns a single-pack fixture, the path of its pack, and
+// what git says every object is
+func packedFixture(t *testing.T) (string, string, map[Hash]gitObject) {
+	t.Helper()
+	dir := newFixture(t)
+	git(t, dir, "gc", "-q")
+	want := allObjects(t, dir)
+
+	packs, err := filepath.Glob(filepath.Join(dir, ".git", "objects", "pack", "*.pack"))
+	if err != nil || len(packs) != 1 {
+		t.Fatalf("got packs %v (%v), want one", packs, err)
+	}
+	return dir, packs[0], want
+}
+
+func TestTruncatedPack(t *testing.T) {
+	dir, pack, want := packedFixture(t)
+
+	data, err := os.ReadFile(pack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{len(data) / 2, 12, 0} {
+		if err := os.WriteFile(pack, data[:size], 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		repo, err := Open(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		failed := 0
+		for hash, obj := range want {
+			objType, content, err := repo.ReadObject(hash)
+			if err != nil {
+				failed++
+				continue
+			}
+			if objType != obj.objType || !bytes.Equal(content, obj.data) {
+				t.Errorf("pack cut to %d bytes: ReadObject(%s) returned wrong content without an error", size, hash)
+			}
+		}
+		if failed == 0 {
+			t.Errorf("pack cut to %d bytes: every object was read", size)
+		}
+		repo.Close()
+	}
+}
+
+func TestCorruptPack(t *testing.T) {
+	dir, pack, want := packedFixture(t)
+
+	data, err := os.ReadFile(pack)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every byte of every entry, one at a time. Reads may fail or, where
+	// the byte doesn't matter, succeed; they must not panic or hang.
+	for i := 12; i < len(data)-20; i++ {
+		corrupt := append([]byte(nil), data...)
+		corrupt[i] ^= 0xff
+		if err := os.WriteFile(pack, corrupt, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		repo, err := Open(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for hash := range want {
+			repo.ReadObject(hash)
+		}
+		repo.Close()
+	}
+}
+
+func TestCorruptIndex(t *testing.T) {
+	dir, pack, _ := packedFixture(t)
+	idx := strings.TrimSuffix(pack, ".pack") + ".idx"
+
+	data, err := os.ReadFile(idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated fanout", data[:100]},
+		{"truncated table", data[:len(data)/2]},
+		{"version 1", append([]byte{0xff, 't', 'O', 'c', 0, 0, 0, 1}, data[8:]...)},
+		{"not an index", bytes.Repeat([]byte("x"), len(data))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(idx, tt.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if repo, err := Open(dir); err == nil {
+				repo.Close()
+				t.Fatal("Open succeeded with a broken index")
+			}
+		})
+	}
+}
+
+func TestApplyDelta(t *testing.T) {
+	base := []byte("0123456789abcdef")
+
+	tests := []struct {
+		name  string
+		delta []byte
+		want  string
+		err   string
+	}{
+		{
+			name:  "copy and insert",
+			delta: []byte{16, 7, 0x91, 2, 4, 3, 'x', 'y', 'z'},
+			want:  "2345xyz",
+		},
+		{
+			name:  "copy of 0x10000 when size is zero",
+			delta: []byte{16, 0x80, 0x80, 0x04, 0x80},
+			err:   "copies past the end",
+		},
+		{name: "wrong base size", delta: []byte{15, 0}, err: "base size mismatch"},
+		{name: "wrong result size", delta: []byte{16, 5, 2, 'a', 'b'}, err: "result size mismatch"},
+		{name: "truncated insert", delta: []byte{16, 5, 5, 'a'}, err: "truncated"},
+		{name: "truncated copy", delta: []byte{16, 4, 0x91, 2}, err: "truncated"},
+		{name: "truncated size", delta: []byte{0x80}, err: "truncated"},
+		{name: "copy past the end", delta: []byte{16, 4, 0x91, 14, 4}, err: "past the end"},
+		{name: "reserved opcode", delta: []byte{16, 1, 0}, err: "reserved opcode"},
+		{name: "huge result", delta: []byte{16, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}, err: "result size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyDelta(base, tt.delta)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("applyDelta() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("applyDelta() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package gitrepo
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Repository reads objects and refs directly from a .git directory.
+// It never touches the working tree or the index.
+type Repository struct {
+	WorkTree string // Top-level directory of the checkout
+	gitDir   string // Per-worktree git directory (HEAD lives here)
+	common   string // Shared git directory (objects, refs, packed-refs)
+
+	packs         []*packFile
+	refDeltaDepth int // REF delta bases being read, see maxRefDeltaDepth
+}
+
+// Open finds the repository containing dir
+func Open(dir string) (*Repository, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	workTree, gitDir := findGitDir(absDir)
+	if gitDir == "" {
+		return nil, fmt.Errorf("%s is not inside a git repository", dir)
+	}
+
+	repo := &Repository{WorkTree: workTree, gitDir: gitDir, common: gitDir}
+
+	// Linked worktrees keep objects and refs in the main repository
+	if data, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		common := strings.TrimSpace(string(data))
+		if !filepath.IsAbs(common) {
+			common = filepath.Join(gitDir, common)
+		}
+		repo.common = filepath.Clean(common)
+	}
+
+	if err := repo.loadPacks(); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// findGitDir walks up from dir looking for a .git directory or gitdir file
+func findGitDir(dir string) (workTree, gitDir string) {
+	for current := dir; ; {
+		candidate := filepath.Join(current, ".git")
+		if info, err := os.Stat(candidate); err == nil {
+			if info.IsDir() {
+				return current, candidate
+			}
+			if data, err := os.ReadFile(candidate); err == nil {
+				target := strings.TrimSpace(strings.TrimPrefix(string(data), "gitdir:"))
+				if !filepath.IsAbs(target) {
+					target = filepath.Join(current, target)
+				}
+				return current, filepath.Clean(target)
+			}
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return "", ""
+		}
+		current = parent
+	}
+}
+
+// ResolveCommit turns a revision into a commit hash. Supported forms:
+// full or abbreviated hashes, HEAD, branch, tag and remote names, full
+// ref names, and any of those followed by "~N" or "^" suffixes.
+// Annotated tags are peeled to the commit they point at.
+func (r *Repository) ResolveCommit(rev string) (Hash, error) {
+	base, steps, err := splitAncestry(rev)
+	if err != nil {
+		return Hash{}, err
+	}
+
+	hash, err := r.resolveName(base)
+	if err != nil {
+		return Hash{}, err
+	}
+
+	commit, err := r.peelToCommit(hash)
+	if err != nil {
+		return Hash{}, err
+	}
+
+	for i := 0; i < steps; i++ {
+		c, err := r.ReadCommit(commit)
+		if err != nil {
+			return Hash{}, err
+		}
+		if len(c.Parents) == 0 {
+			return Hash{}, fmt.Errorf("revision %q goes past the root commit", rev)
+		}
+		commit = c.Parents[0]
+	}
+
+	return commit, nil
+}
+
+// splitAncestry separates "v1.0~2^" into "v1.0" and 3 first-parent steps
+func splitAncestry(rev string) (string, int, error) {
+	steps := 0
+	for {
+		if strings.HasSuffix(rev, "^") {
+			rev = rev[:len(rev)-1]
+			steps++
+			continue
+		}
+		if i := strings.LastIndex(rev, "~"); i > 0 {
+			suffix := rev[i+1:]
+			n := 1
+			if suffix != "" {
+				parsed, err := strconv.Atoi(suffix)
+				if err != nil {
+					break
+				}
+				n = parsed
+			}
+			rev = rev[:i]
+			steps += n
+			continue
+		}
+		break
+	}
+	if rev == "" {
+		return "", 0, fmt.Errorf("empty revision")
+	}
+	return rev, steps, nil
+}
+
+// resolveName resolves a ref name the way git does: a pseudo-ref such as
+// HEAD or FETCH_HEAD, then under refs/, tags, branches and remotes, then
+// an abbreviated hash
+func (r *Repository) resolveName(name string) (Hash, error) {
+	if strings.Contains(name, "..") || strings.HasPrefix(name, "/") || strings.Contains(name, "\\") {
+		return Hash{}, fmt.Errorf("invalid revision %q", name)
+	}
+
+	var candidates []string
+	if isPseudoRef(name) || strings.HasPrefix(name, "refs/") {
+		candidates = append(candidates, name)
+	}
+	if name != "HEAD" && !strings.HasPrefix(name, "refs/") {
+		candidates = append(candidates,
+			"refs/"+name,
+			"refs/tags/"+name,
+			"refs/heads/"+name,
+			"refs/remotes/"+name,
+			"refs/remotes/"+name+"/HEAD",
+		)
+	}
+
+	for _, ref := range candidates {
+		if hash, ok, err := r.readRef(ref, 0); err != nil {
+			return Hash{}, err
+		} else if ok {
+			return hash, nil
+		}
+	}
+
+	if isHex(name) && len(name) >= 4 {
+		return r.expandHash(name)
+	}
+
+	return Hash{}, fmt.Errorf("unknown revision %q", name)
+}
+
+// isPseudoRef matches the all-caps refs kept directly in the git
+// directory: HEAD, FETCH_HEAD, ORIG_HEAD, ...
+func isPseudoRef(name string) bool {
+	for _, c := range name {
+		if (c < 'A' || c > 'Z') && c != '_' {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// readRef resolves a (possibly symbolic) ref from loose files or
+// packed-refs. A file that doesn't hold a ref isn't one.
+func (r *Repository) readRef(name string, depth int) (Hash, bool, error) {
+	if depth > 10 {
+		return Hash{}, false, fmt.Errorf("symbolic ref loop at %s", name)
+	}
+	if strings.Contains(name, "..") || !isPseudoRef(name) && !strings.HasPrefix(name, "refs/") {
+		return Hash{}, false, nil
+	}
+
+	// HEAD and other per-worktree refs live in gitDir; the rest in common
+	for _, dir := range []string{r.gitDir, r.common} {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			continue
+		}
+		content := strings.TrimSpace(string(data))
+		if target, ok := strings.CutPrefix(content, "ref: "); ok {
+			return r.readRef(strings.TrimSpace(target), depth+1)
+		}
+		if hash, err := ParseHash(content); err == nil {
+			return hash, true, nil
+		}
+	}
+
+	return r.readPackedRef(name)
+}
+
+func (r *Repository) readPackedRef(name string) (Hash, bool, error) {
+	f, err := os.Open(filepath.Join(r.common, "packed-refs"))
+	if err != nil {
+		return Hash{}, false, nil
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" || line[0] == '#' || line[0] == '^' {
+			continue
+		}
+		hashText, ref, found := strings.Cut(line, " ")
+		if !found || ref != name {
+			continue
+		}
+		hash, err := ParseHash(hashText)
+		if err != nil {
+			return Hash{}, false, fmt.Errorf("packed-refs: %w", err)
+		}
+		return hash, true, nil
+	}
+	return Hash{}, false, sc.Err()
+}
+
+// expandHash resolves an abbreviated hash against loose and packed objects
+func (r *Repository) expandHash(prefix string) (Hash, error) {
+	prefix = strings.ToLower(prefix)
+	if len(prefix) == 40 {
+		return ParseHash(prefix)
+	}
+
+	matches := map[Hash]bool{}
+
+	looseDir := filepath.Join(r.common, "objects", prefix[:2])
+	if entries, err := os.ReadDir(looseDir); err == nil {
+		for _, entry := range entries {
+			full := prefix[:2] + entry.Name()
+			if strings.HasPrefix(full, prefix) {
+				if hash, err := ParseHash(full); err == nil {
+					matches[hash] = true
+				}
+			}
+		}
+	}
+
+	for _, pack := range r.packs {
+		for _, hash := range pack.index.withPrefix(prefix) {
+			matches[hash] = true
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return Hash{}, fmt.Errorf("unknown revision %q", prefix)
+	case 1:
+		for hash := range matches {
+			return hash, nil
+		}
+	}
+	return Hash{}, fmt.Errorf("short hash %q is ambiguous", prefix)
+}
+
+// peelToCommit follows annotated tags until it reaches a commit
+func (r *Repository) peelToCommit(hash Hash) (Hash, error) {
+	for depth := 0; depth < 10; depth++ {
+		objType, data, err := r.ReadObject(hash)
+		if err != nil {
+			return Hash{}, err
+		}
+		switch objType {
+		case ObjectCommit:
+			return hash, nil
+		case ObjectTag:
+			target, ok := headerField(data, "object")
+			if !ok {
+				return Hash{}, fmt.Errorf("tag %s has no object", hash)
+			}
+			if hash, err = ParseHash(target); err != nil {
+				return Hash{}, err
+			}
+		default:
+			return Hash{}, fmt.Errorf("%s is a %s, not a commit", hash, objType)
+		}
+	}
+	return Hash{}, fmt.Errorf("tag chain too deep at %s", hash)
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s + strings.Repeat("0", len(s)%2))
+	return err == nil
+}
@@ -0,0 +1,51 @@
+package gitrepo
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveNames(t *testing.T) {
+	dir := newFixture(t)
+	git(t, dir, "branch", "config", "HEAD~1")
+	git(t, dir, "branch", "index", "HEAD~2")
+	git(t, dir, "tag", "v1", "HEAD~3")
+	git(t, dir, "update-ref", "ORIG_HEAD", "HEAD~1")
+	git(t, dir, "branch", "packed", "HEAD~2")
+	git(t, dir, "pack-refs", "--all")
+	git(t, dir, "branch", "loose", "HEAD~3")
+
+	// A file under refs/ that isn't a ref
+	writeFile(t, filepath.Join(dir, ".git", "refs", "heads", "junk"), "not a ref\n")
+
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rev := range []string{"HEAD", "HEAD~1", "config", "index", "v1", "ORIG_HEAD", "packed", "loose",
+		"heads/config", "refs/heads/index", "tags/v1"} {
+		t.Run(rev, func(t *testing.T) {
+			got, err := repo.ResolveCommit(rev)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := strings.TrimSpace(git(t, dir, "rev-parse", rev+"^{commit}")); got.String() != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+
+	for _, rev := range []string{"description", "junk", "../../x", "refs/../config", "/etc/passwd", "nope"} {
+		t.Run(rev, func(t *testing.T) {
+			_, err := repo.ResolveCommit(rev)
+			if err == nil {
+				t.Fatal("resolved, want an error")
+			}
+			if strings.Contains(err.Error(), "\n") || strings.Contains(err.Error(), "[core]") {
+				t.Errorf("error shows file contents: %v", err)
+			}
+		})
+	}
+}
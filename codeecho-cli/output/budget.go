@@ -0,0 +1,125 @@
+package output
+
+import (
+	"time"
+
+	"github.com/opskraken/codeecho-cli/config"
+	"github.com/opskraken/codeecho-cli/scanner"
+	"github.com/opskraken/codeecho-cli/tokens"
+)
+
+// BudgetMeter measures a pack as a format renders it, so --max-tokens
+// covers the markup, metadata, tree and footer around file contents and
+// not just the contents. It implements scanner.PackMeter.
+type BudgetMeter struct {
+	format    string
+	opts      config.OutputOptions
+	tokenizer tokens.Counter
+	repoPath  string
+	lead      int // Tokens of leadEntry alone, -1 until measured
+}
+
+// leadEntry is written before the measured file, so markup that only
+// precedes the first entry (such as opening the JSON files array) is
+// counted once in FixedTokens rather than once per file
+var leadEntry = &scanner.FileInfo{Path: "lead", RelativePath: "lead", IsText: true}
+
+// NewBudgetMeter measures packs of repoPath written in format
+func NewBudgetMeter(format string, opts config.OutputOptions, tokenizer tokens.Counter, repoPath string) *BudgetMeter {
+	return &BudgetMeter{format: format, opts: opts, tokenizer: tokenizer, repoPath: repoPath, lead: -1}
+}
+
+func (m *BudgetMeter) count(section func(StreamingWriter) error) (int, error) {
+	text, err := renderSection(m.format, m.opts, section)
+	if err != nil {
+		return 0, err
+	}
+	return m.tokenizer.Count(text), nil
+}
+
+// entry counts the tokens a file's entry adds after another entry
+func (m *BudgetMeter) entry(file *scanner.FileInfo) (int, error) {
+	if m.lead < 0 {
+		lead, err := m.count(func(w StreamingWriter) error { return w.WriteFile(leadEntry) })
+		if err != nil {
+			return 0, err
+		}
+		m.lead = lead
+	}
+
+	both, err := m.count(func(w StreamingWriter) error {
+		if err := w.WriteFile(leadEntry); err != nil {
+			return err
+		}
+		return w.WriteFile(file)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return both - m.lead, nil
+}
+
+// FileTokens returns the tokens of a file's entry, what its content adds
+// to that, and the tokens of the entry as written when the budget keeps
+// only its structure. The file's secrets, listed in the footer, count
+// as part of the entry.
+func (m *BudgetMeter) FileTokens(file *scanner.FileInfo) (total, content, structure int, err error) {
+	if total, err = m.entry(file); err != nil {
+		return 0, 0, 0, err
+	}
+
+	bare := *file
+	bare.Content = ""
+	withoutContent, err := m.entry(&bare)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	content = total - withoutContent
+
+	bare.LineCount = 0
+	bare.TokenCount = 0
+	bare.BudgetAction = scanner.BudgetActionStructureOnly
+	if structure, err = m.entry(&bare); err != nil {
+		return 0, 0, 0, err
+	}
+
+	if len(file.Secrets) > 0 {
+		listed, err := m.count(func(w StreamingWriter) error {
+			return w.WriteFooter(&scanner.StreamingStats{Secrets: file.Secrets})
+		})
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		empty, err := m.count(func(w StreamingWriter) error {
+			return w.WriteFooter(&scanner.StreamingStats{})
+		})
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		total += listed - empty
+		structure += listed - empty
+	}
+	return total, content, structure, nil
+}
+
+// FixedTokens returns the tokens of the header, of the directory tree of
+// paths and of the footer for stats
+func (m *BudgetMeter) FixedTokens(paths []string, stats *scanner.StreamingStats) (int, error) {
+	footerStats := *stats
+	footerStats.Tokenizer = m.tokenizer.Name()
+
+	// The scan time isn't known yet, but looks like this
+	scanTime := time.Now().Format(time.RFC3339)
+
+	return m.count(func(w StreamingWriter) error {
+		if err := w.WriteHeader(m.repoPath, scanTime); err != nil {
+			return err
+		}
+		if len(paths) > 0 {
+			if err := w.WriteTree(paths); err != nil {
+				return err
+			}
+		}
+		return w.WriteFooter(&footerStats)
+	})
+}
@@ -0,0 +1,52 @@
+// Filters the files of the report by path and, optionally, by content
+(() => {
+  const input = document.getElementById("filter");
+  const contents = document.getElementById("filter-contents");
+  const count = document.getElementById("filter-count");
+  const files = Array.from(document.querySelectorAll("section.file"));
+  const entries = Array.from(document.querySelectorAll("nav.tree li[data-path]"));
+  const dirs = Array.from(document.querySelectorAll("nav.tree li.dir")).reverse();
+  const text = new Map();
+
+  const matches = (file, query) => {
+    if (file.dataset.path.toLowerCase().includes(query)) {
+      return true;
+    }
+    if (!contents.checked) {
+      return false;
+    }
+    if (!text.has(file)) {
+      const code = file.querySelector("pre");
+      text.set(file, code ? code.textContent.toLowerCase() : "");
+    }
+    return text.get(file).includes(query);
+  };
+
+  const apply = () => {
+    const query = input.value.trim().toLowerCase();
+    const shown = new Set();
+    for (const file of files) {
+      const match = query === "" || matches(file, query);
+      file.hidden = !match;
+      if (match) {
+        shown.add(file.dataset.path);
+      }
+    }
+    for (const entry of entries) {
+      entry.hidden = query !== "" && !shown.has(entry.dataset.path);
+    }
+    // Innermost directories first, so parents see their children's state
+    for (const dir of dirs) {
+      dir.hidden = query !== "" && !dir.querySelector("li[data-path]:not([hidden])");
+    }
+    count.textContent = query === "" ? `${files.length} files` : `${shown.size} of ${files.length} files`;
+  };
+
+  let timer;
+  input.addEventListener("input", () => {
+    clearTimeout(timer);
+    timer = setTimeout(apply, 150);
+  });
+  contents.addEventListener("change", apply);
+  apply();
+})();
@@ -0,0 +1,140 @@
+package output
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/opskraken/codeecho-cli/config"
+	"github.com/opskraken/codeecho-cli/scanner"
+)
+
+// --line-endings values
+const (
+	LineEndingsKeep = ""
+	LineEndingsLF   = "lf"
+	LineEndingsCRLF = "crlf"
+)
+
+// ValidateLineEndings checks a --line-endings value
+func ValidateLineEndings(mode string) error {
+	switch mode {
+	case LineEndingsKeep, LineEndingsLF, LineEndingsCRLF:
+		return nil
+	}
+	return fmt.Errorf("unknown --line-endings %q (supported: lf, crlf)", mode)
+}
+
+// renderContent prepares file content for a writer. Every format renders
+// content through it, so an option gives the same text in all of them;
+// the writer only escapes or wraps the result.
+func renderContent(content string, opts config.OutputOptions) string {
+	content = normalizeLineEndings(content, opts.LineEndings)
+	if opts.TabWidth > 0 {
+		content = expandTabs(content, opts.TabWidth)
+	}
+	if opts.ShowLineNumbers {
+		// Numbered last, so the prefix doesn't move tab stops
+		content = addLineNumbers(content)
+	}
+	return content
+}
+
+// renderedFile returns file with its content rendered, for the formats
+// that serialize the whole FileInfo
+func renderedFile(file *scanner.FileInfo, opts config.OutputOptions) *scanner.FileInfo {
+	if file.Content == "" || !file.IsText {
+		return file
+	}
+	rendered := *file
+	rendered.Content = renderContent(file.Content, opts)
+	return &rendered
+}
+
+// normalizeLineEndings converts CRLF and lone CR line endings to mode
+func normalizeLineEndings(content, mode string) string {
+	if mode == LineEndingsKeep {
+		return content
+	}
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.ReplaceAll(content, "\r", "\n")
+	if mode == LineEndingsCRLF {
+		content = strings.ReplaceAll(content, "\n", "\r\n")
+	}
+	return content
+}
+
+// expandTabs replaces tabs with spaces up to the next multiple of width,
+// counting columns in runes
+func expandTabs(content string, width int) string {
+	if !strings.Contains(content, "\t") {
+		return content
+	}
+
+	var b strings.Builder
+	b.Grow(len(content))
+	column := 0
+	for _, r := range content {
+		switch r {
+		case '\t':
+			spaces := width - column%width
+			b.WriteString(strings.Repeat(" ", spaces))
+			column += spaces
+		case '\n', '\r':
+			b.WriteRune(r)
+			column = 0
+		default:
+			b.WriteRune(r)
+			column++
+		}
+	}
+	return b.String()
+}
+
+func addLineNumbers(content string) string {
+	lines := strings.Split(content, "\n")
+	var numberedLines []string
+
+	for i, line := range lines {
+		numberedLines = append(numberedLines, fmt.Sprintf("%4d: %s", i+1, line))
+	}
+
+	return strings.Join(numberedLines, "\n")
+}
+
+// codeFence returns a backtick fence longer than any run of backticks
+// that starts a line of content, so the content can't close the block
+func codeFence(content string) string {
+	longest := 2
+	for _, line := range strings.Split(content, "\n") {
+		// Up to three spaces of indentation still close a fence
+		trimmed := strings.TrimLeft(line, " ")
+		if len(line)-len(trimmed) > 3 {
+			continue
+		}
+		run := len(trimmed) - len(strings.TrimLeft(trimmed, "`"))
+		longest = max(longest, run)
+	}
+	return strings.Repeat("`", longest+1)
+}
+
+// CDATA section delimiters. A "]]>" in the content is split across two
+// sections, so no rendered line ever ends with cdataEnd except the last.
+const (
+	cdataStart = "<![CDATA["
+	cdataEnd   = "]]>"
+	cdataSplit = "]]]]><![CDATA[>"
+)
+
+// cdata wraps content in a CDATA section
+func cdata(content string) string {
+	return cdataStart + strings.ReplaceAll(content, cdataEnd, cdataSplit) + cdataEnd
+}
+
+// UnwrapCDATA undoes cdata. ok is false when s isn't a CDATA section.
+func UnwrapCDATA(s string) (content string, ok bool) {
+	if !strings.HasPrefix(s, cdataStart) || !strings.HasSuffix(s, cdataEnd) || len(s) < len(cdataStart)+len(cdataEnd) {
+		return "", false
+	}
+	s = s[len(cdataStart) : len(s)-len(cdataEnd)]
+	return strings.ReplaceAll(s, cdataSplit, cdataEnd), true
+}
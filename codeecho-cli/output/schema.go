@@ -0,0 +1,24 @@
+package output
+
+import (
+	_ "embed"
+	"fmt"
+)
+
+// JSONSchemaVersion is the schema_version of JSON packs. Bump the minor
+// version when adding optional fields, and the major version (with the
+// pattern in schemas/pack.schema.json) when removing or changing one.
+const JSONSchemaVersion = "1.1"
+
+//go:embed schemas/pack.schema.json
+var jsonSchema []byte
+
+// Schema returns the JSON Schema of the packs written for format
+func Schema(format string) ([]byte, error) {
+	switch format {
+	case "json":
+		return jsonSchema, nil
+	default:
+		return nil, fmt.Errorf("no schema for format %q (supported: json)", format)
+	}
+}
@@ -0,0 +1,642 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/opskraken/codeecho-cli/config"
+	"github.com/opskraken/codeecho-cli/scanner"
+	"github.com/opskraken/codeecho-cli/tokens"
+	"github.com/opskraken/codeecho-cli/utils"
+)
+
+// --split-by values
+const (
+	SplitByDirectory = "directory"
+	SplitByLanguage  = "language"
+)
+
+// rootGroup holds files directly in the scan root for --split-by directory
+const rootGroup = "root"
+
+// SplitOptions controls how a pack is divided into parts
+type SplitOptions struct {
+	MaxBytes  int64  // --split-size (0 = no size limit)
+	MaxTokens int    // --split-tokens (0 = no token limit)
+	By        string // --split-by: "", directory or language
+
+	Format    string
+	Output    config.OutputOptions
+	Tokenizer tokens.Counter
+	Budget    *scanner.BudgetReport // Listed in the footer of part 1
+}
+
+// Enabled reports whether any split flag was given
+func (o SplitOptions) Enabled() bool {
+	return o.MaxBytes > 0 || o.MaxTokens > 0 || o.By != ""
+}
+
+// ValidateSplitBy checks a --split-by value
+func ValidateSplitBy(by string) error {
+	switch by {
+	case "", SplitByDirectory, SplitByLanguage:
+		return nil
+	}
+	return fmt.Errorf("unknown --split-by %q (supported: directory, language)", by)
+}
+
+// limit is the part limit in bytes or tokens (0 = unlimited)
+func (o SplitOptions) limit() int64 {
+	if o.MaxBytes > 0 {
+		return o.MaxBytes
+	}
+	return int64(o.MaxTokens)
+}
+
+// cost measures rendered text in the unit of the limit
+func (o SplitOptions) cost(text string) int64 {
+	if o.MaxTokens > 0 {
+		return int64(o.Tokenizer.Count(text))
+	}
+	return int64(len(text))
+}
+
+func (o SplitOptions) groupOf(file *scanner.FileInfo) string {
+	switch o.By {
+	case SplitByDirectory:
+		dir, _, found := strings.Cut(filepath.ToSlash(file.RelativePath), "/")
+		if !found {
+			return rootGroup
+		}
+		return dir
+	case SplitByLanguage:
+		if file.Language == "" {
+			return "other"
+		}
+		return file.Language
+	}
+	return ""
+}
+
+// render captures what a writer produces for one section of a document
+func (o SplitOptions) render(opts config.OutputOptions, section func(StreamingWriter) error) (string, error) {
+	return renderSection(o.Format, opts, section)
+}
+
+// renderSection captures what a writer of format produces for one
+// section of a document
+func renderSection(format string, opts config.OutputOptions, section func(StreamingWriter) error) (string, error) {
+	var buf bytes.Buffer
+	w, err := NewStreamingWriter(&buf, format, opts)
+	if err != nil {
+		return "", err
+	}
+	if err := section(w); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// fileCost returns the cost of a rendered file entry and of its markup alone
+func (o SplitOptions) fileCost(file *scanner.FileInfo) (total, markup int64, err error) {
+	bare := *file
+	bare.Content = ""
+	markupText, err := o.render(o.Output, func(w StreamingWriter) error { return w.WriteFile(&bare) })
+	if err != nil {
+		return 0, 0, err
+	}
+	markup = o.cost(markupText)
+
+	// The file's secrets are listed in its part's footer
+	if len(file.Secrets) > 0 {
+		listed, err := o.render(o.Output, func(w StreamingWriter) error {
+			return w.WriteFooter(&scanner.StreamingStats{Secrets: file.Secrets})
+		})
+		if err != nil {
+			return 0, 0, err
+		}
+		empty, err := o.render(o.Output, func(w StreamingWriter) error {
+			return w.WriteFooter(&scanner.StreamingStats{})
+		})
+		if err != nil {
+			return 0, 0, err
+		}
+		markup += o.cost(listed) - o.cost(empty)
+	}
+	listing := markup - o.cost(markupText)
+
+	// Token counts for the content were already taken by the scanner
+	if o.MaxTokens > 0 {
+		return markup + int64(file.TokenCount), markup, nil
+	}
+
+	text, err := o.render(o.Output, func(w StreamingWriter) error { return w.WriteFile(file) })
+	if err != nil {
+		return 0, 0, err
+	}
+	return o.cost(text) + listing, markup, nil
+}
+
+// splitPart is one output document
+type splitPart struct {
+	group  string
+	index  int  // 1-based within the group
+	first  bool // Carries the directory tree and budget report
+	used   int64
+	files  int
+	number int // 1-based across all parts, assigned by Plan
+}
+
+// splitEntry records where a file goes: one part, or one per chunk
+type splitEntry struct {
+	parts     []*splitPart
+	chunkSize int // Max content bytes per chunk when the file is cut
+}
+
+// SplitPlanner assigns files to parts during a counting pass. Use
+// ObserveTree and Observe as the tree writer and file handler of that pass.
+type SplitPlanner struct {
+	opts    SplitOptions
+	tree    int64
+	headers map[string]int64
+	footers [2]int64 // Other parts, first part
+	groups  []string // In order of first appearance
+	parts   []*splitPart
+	current map[string]*splitPart
+	files   map[string]splitEntry
+}
+
+func NewSplitPlanner(opts SplitOptions) (*SplitPlanner, error) {
+	p := &SplitPlanner{
+		opts:    opts,
+		headers: make(map[string]int64),
+		current: make(map[string]*splitPart),
+		files:   make(map[string]splitEntry),
+	}
+
+	// Footers are measured with oversized numbers so real ones always fit
+	for i, budget := range []*scanner.BudgetReport{nil, opts.Budget} {
+		stats := &scanner.StreamingStats{
+			TotalFiles:   999999,
+			TotalSize:    1 << 50,
+			TotalTokens:  999999999,
+			Tokenizer:    opts.Tokenizer.Name(),
+			TextFiles:    999999,
+			BinaryFiles:  999999,
+			DeletedFiles: 999999,
+			Budget:       budget,
+		}
+		footer, err := opts.render(opts.Output, func(w StreamingWriter) error { return w.WriteFooter(stats) })
+		if err != nil {
+			return nil, err
+		}
+		p.footers[i] = opts.cost(footer)
+	}
+	return p, nil
+}
+
+// ObserveTree measures the directory tree that part 1 will carry
+func (p *SplitPlanner) ObserveTree(paths []string) error {
+	tree, err := p.opts.render(p.opts.Output, func(w StreamingWriter) error { return w.WriteTree(paths) })
+	if err != nil {
+		return err
+	}
+	p.tree = p.opts.cost(tree)
+	return nil
+}
+
+// overhead is what a part costs before any file is added
+func (p *SplitPlanner) overhead(group string, first bool) (int64, error) {
+	header, ok := p.headers[group]
+	if !ok {
+		opts := p.opts.Output
+		opts.Part, opts.PartCount, opts.PartGroup = 9999, 9999, group
+		text, err := p.opts.render(opts, func(w StreamingWriter) error {
+			return w.WriteHeader(strings.Repeat("x", 256), "2006-01-02T15:04:05Z07:00")
+		})
+		if err != nil {
+			return 0, err
+		}
+		header = p.opts.cost(text)
+		p.headers[group] = header
+	}
+
+	if first {
+		return header + p.tree + p.footers[1], nil
+	}
+	return header + p.footers[0], nil
+}
+
+func (p *SplitPlanner) newPart(group string) (*splitPart, error) {
+	if _, seen := p.current[group]; !seen {
+		p.groups = append(p.groups, group)
+	}
+
+	part := &splitPart{group: group, first: len(p.parts) == 0}
+	if prev := p.current[group]; prev != nil {
+		part.index = prev.index + 1
+	} else {
+		part.index = 1
+	}
+
+	used, err := p.overhead(group, part.first)
+	if err != nil {
+		return nil, err
+	}
+	if limit := p.opts.limit(); limit > 0 && used >= limit {
+		return nil, fmt.Errorf("split limit of %d is too small: headers and footer alone take %d", limit, used)
+	}
+	part.used = used
+
+	p.parts = append(p.parts, part)
+	p.current[group] = part
+	return part, nil
+}
+
+// Observe assigns a file to a part. Files are kept whole; only a file
+// that alone exceeds an empty part is cut into chunks on line boundaries.
+func (p *SplitPlanner) Observe(file *scanner.FileInfo) error {
+	group := p.opts.groupOf(file)
+	total, markup, err := p.opts.fileCost(file)
+	if err != nil {
+		return err
+	}
+
+	limit := p.opts.limit()
+	part := p.current[group]
+	if part == nil || (limit > 0 && part.files > 0 && part.used+total > limit) {
+		if part, err = p.newPart(group); err != nil {
+			return err
+		}
+	}
+
+	contentCost := total - markup
+	if limit == 0 || part.used+total <= limit || contentCost <= 0 || file.Content == "" {
+		part.used += total
+		part.files++
+		p.files[file.RelativePath] = splitEntry{parts: []*splitPart{part}}
+		return nil
+	}
+
+	// Scale the room left in an empty part to content bytes, keeping a
+	// margin because escaping and tokenization aren't uniform
+	room := limit - part.used - markup
+	if room <= 0 {
+		return fmt.Errorf("split limit of %d is too small for the metadata of %s", limit, file.RelativePath)
+	}
+	chunkSize := int(float64(len(file.Content)) * float64(room) / float64(contentCost) * 0.9)
+	if chunkSize < 1 {
+		chunkSize = 1
+	}
+
+	entry := splitEntry{chunkSize: chunkSize}
+	for i, chunk := range chunkContent(file.Content, chunkSize) {
+		if i > 0 {
+			if part, err = p.newPart(group); err != nil {
+				return err
+			}
+		}
+		part.used += markup + contentCost*int64(len(chunk))/int64(len(file.Content))
+		part.files++
+		entry.parts = append(entry.parts, part)
+	}
+	p.files[file.RelativePath] = entry
+	return nil
+}
+
+// Plan numbers the parts: groups in order of first appearance, then by
+// index within the group, so the part holding the tree is always part 1
+func (p *SplitPlanner) Plan() (*SplitPlan, error) {
+	if len(p.parts) == 0 {
+		if _, err := p.newPart(""); err != nil {
+			return nil, err
+		}
+	}
+
+	order := make(map[string]int, len(p.groups))
+	for i, group := range p.groups {
+		order[group] = i
+	}
+
+	parts := append([]*splitPart(nil), p.parts...)
+	sort.SliceStable(parts, func(i, j int) bool {
+		if parts[i].group != parts[j].group {
+			return order[parts[i].group] < order[parts[j].group]
+		}
+		return parts[i].index < parts[j].index
+	})
+	for i, part := range parts {
+		part.number = i + 1
+	}
+
+	groupParts := make(map[string]int)
+	for _, part := range parts {
+		groupParts[part.group]++
+	}
+
+	return &SplitPlan{opts: p.opts, parts: parts, files: p.files, groupParts: groupParts}, nil
+}
+
+// SplitPlan is the result of the counting pass, consumed by SplitWriter
+type SplitPlan struct {
+	opts       SplitOptions
+	parts      []*splitPart // By number
+	files      map[string]splitEntry
+	groupParts map[string]int
+}
+
+// PartCount is the number of documents the pack is split into
+func (p *SplitPlan) PartCount() int {
+	return len(p.parts)
+}
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// filename names a part after the base output path
+func (p *SplitPlan) filename(basePath string, part *splitPart) string {
+	if part.group == "" {
+		return utils.PartFilename(basePath, fmt.Sprintf("part-%03d", part.number))
+	}
+
+	label := strings.Trim(unsafeFilenameChars.ReplaceAllString(part.group, "-"), "-")
+	if label == "" {
+		label = "group"
+	}
+	if p.groupParts[part.group] > 1 {
+		label += fmt.Sprintf("-part-%03d", part.index)
+	}
+	return utils.PartFilename(basePath, label)
+}
+
+// chunkContent cuts content into pieces of at most size bytes, on line
+// boundaries where possible. Concatenating the chunks restores content.
+func chunkContent(content string, size int) []string {
+	var chunks []string
+	var current strings.Builder
+
+	for len(content) > 0 {
+		line := content
+		if i := strings.IndexByte(content, '\n'); i >= 0 {
+			line = content[:i+1]
+		}
+
+		if current.Len() > 0 && current.Len()+len(line) > size {
+			chunks = append(chunks, current.String())
+			current.Reset()
+		}
+
+		// A single line longer than a chunk is cut on a rune boundary
+		for len(line) > size {
+			cut := size
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			if cut == 0 {
+				cut = size
+			}
+			chunks = append(chunks, line[:cut])
+			content = content[cut:]
+			line = line[cut:]
+		}
+
+		current.WriteString(line)
+		content = content[len(line):]
+	}
+
+	if current.Len() > 0 {
+		chunks = append(chunks, current.String())
+	}
+	return chunks
+}
+
+// openPart is a part file being written
+type openPart struct {
+	part   *splitPart
+	file   *os.File
+	writer StreamingWriter
+	stats  *scanner.StreamingStats
+}
+
+// SplitWriter is a StreamingWriter that spreads files over the parts of
+// a SplitPlan. Each part is a complete document with its own header and
+// footer; parts are opened as their first file arrives.
+type SplitWriter struct {
+	plan     *SplitPlan
+	basePath string
+
+	repoPath string
+	scanTime string
+	tree     []string
+
+	current  map[string]*openPart // Open part per group
+	finished map[*splitPart]bool
+	paths    []string
+}
+
+// NewSplitWriter writes the parts of plan next to basePath
+func NewSplitWriter(plan *SplitPlan, basePath string) *SplitWriter {
+	return &SplitWriter{
+		plan:     plan,
+		basePath: basePath,
+		current:  make(map[string]*openPart),
+		finished: make(map[*splitPart]bool),
+	}
+}
+
+// Paths lists the part files written so far, in part order
+func (s *SplitWriter) Paths() []string {
+	paths := append([]string(nil), s.paths...)
+	sort.Strings(paths)
+	return paths
+}
+
+func (s *SplitWriter) WriteHeader(repoPath string, scanTime string) error {
+	s.repoPath = repoPath
+	s.scanTime = scanTime
+	return nil
+}
+
+// WriteTree keeps the paths for part 1
+func (s *SplitWriter) WriteTree(paths []string) error {
+	s.tree = paths
+	return nil
+}
+
+func (s *SplitWriter) WriteFile(file *scanner.FileInfo) error {
+	entry, ok := s.plan.files[file.RelativePath]
+	if !ok {
+		// Appeared after the counting pass: append to the group's last part
+		group := s.plan.opts.groupOf(file)
+		var last *splitPart
+		for _, part := range s.plan.parts {
+			if part.group == group || last == nil {
+				last = part
+			}
+		}
+		entry = splitEntry{parts: []*splitPart{last}}
+	}
+
+	if len(entry.parts) == 1 {
+		return s.write(entry.parts[0], file)
+	}
+
+	chunks := chunkContent(file.Content, entry.chunkSize)
+	for i, chunk := range chunks {
+		part := entry.parts[len(entry.parts)-1]
+		if i < len(entry.parts) {
+			part = entry.parts[i]
+		}
+
+		piece := *file
+		piece.Content = chunk
+		piece.LineCount = utils.CountLines(chunk)
+		if file.TokenCount > 0 {
+			piece.TokenCount = s.plan.opts.Tokenizer.Count(chunk)
+		}
+		piece.Chunk, piece.Chunks = i+1, len(chunks)
+
+		if err := s.write(part, &piece); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SplitWriter) write(part *splitPart, file *scanner.FileInfo) error {
+	op, err := s.open(part)
+	if err != nil {
+		return err
+	}
+
+	op.stats.TotalFiles++
+	if file.Chunks > 0 {
+		op.stats.TotalSize += int64(len(file.Content))
+	} else {
+		op.stats.TotalSize += file.Size
+	}
+	op.stats.TotalTokens += file.TokenCount
+	if file.Chunk <= 1 {
+		op.stats.Secrets = append(op.stats.Secrets, file.Secrets...)
+	}
+	if file.ChangeStatus == "deleted" {
+		op.stats.DeletedFiles++
+	} else if file.IsText {
+		op.stats.TextFiles++
+	} else {
+		op.stats.BinaryFiles++
+	}
+	if file.Language != "" {
+		op.stats.LanguageCounts[file.Language]++
+	}
+
+	return op.writer.WriteFile(file)
+}
+
+// open returns the writer for part, finishing the group's previous part
+func (s *SplitWriter) open(part *splitPart) (*openPart, error) {
+	if op := s.current[part.group]; op != nil {
+		if op.part == part {
+			return op, nil
+		}
+		if err := s.finish(op); err != nil {
+			return nil, err
+		}
+	}
+	if s.finished[part] {
+		return nil, fmt.Errorf("part %d was already written", part.number)
+	}
+
+	path := s.plan.filename(s.basePath, part)
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+
+	opts := s.plan.opts.Output
+	opts.Part, opts.PartCount, opts.PartGroup = part.number, len(s.plan.parts), part.group
+	writer, err := NewStreamingWriter(f, s.plan.opts.Format, opts)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	op := &openPart{
+		part:   part,
+		file:   f,
+		writer: writer,
+		stats: &scanner.StreamingStats{
+			Tokenizer:      s.plan.opts.Tokenizer.Name(),
+			LanguageCounts: make(map[string]int),
+		},
+	}
+	if part.number == 1 {
+		op.stats.Budget = s.plan.opts.Budget
+	}
+	s.current[part.group] = op
+	s.paths = append(s.paths, path)
+
+	if err := writer.WriteHeader(s.repoPath, s.scanTime); err != nil {
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+	if part.number == 1 {
+		if err := writer.WriteTree(s.tree); err != nil {
+			return nil, fmt.Errorf("failed to write tree: %w", err)
+		}
+	}
+	return op, nil
+}
+
+func (s *SplitWriter) finish(op *openPart) error {
+	delete(s.current, op.part.group)
+	s.finished[op.part] = true
+
+	if err := op.writer.WriteFooter(op.stats); err != nil {
+		op.file.Close()
+		return fmt.Errorf("failed to write footer: %w", err)
+	}
+	if err := op.writer.Close(); err != nil {
+		op.file.Close()
+		return err
+	}
+	return op.file.Close()
+}
+
+// WriteFooter finishes every part, writing empty ones that lost all
+// their files since the counting pass so "part N of M" stays accurate.
+// Scan errors are only known now, so they are listed in the last part.
+func (s *SplitWriter) WriteFooter(stats *scanner.StreamingStats) error {
+	for i, part := range s.plan.parts {
+		if s.finished[part] {
+			continue
+		}
+		op, err := s.open(part)
+		if err != nil {
+			return err
+		}
+		if i == len(s.plan.parts)-1 {
+			op.stats.Errors = stats.Errors
+		}
+		if err := s.finish(op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close releases parts left open by a failed scan
+func (s *SplitWriter) Close() error {
+	for group, op := range s.current {
+		delete(s.current, group)
+		op.file.Close()
+	}
+	return nil
+}
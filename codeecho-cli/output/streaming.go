@@ -25,9 +25,52 @@ func NewStreamingWriter(w io.Writer, format string, opts config.OutputOptions) (
 		return NewStreamingXMLWriter(w, opts), nil
 	case "json":
 		return NewStreamingJSONWriter(w, opts), nil
+	case "jsonl":
+		return NewStreamingJSONLWriter(w, opts), nil
 	case "markdown", "md":
 		return NewStreamingMarkdownWriter(w, opts), nil
+	case "plain", "txt":
+		return NewStreamingPlainWriter(w, opts), nil
+	case "html":
+		return NewStreamingHTMLWriter(w, opts), nil
+	case "sqlite":
+		return NewStreamingSQLiteWriter(w, opts), nil
+	case "template":
+		if opts.Template == nil {
+			return nil, fmt.Errorf("the template format needs a template (use --template)")
+		}
+		return NewStreamingTemplateWriter(w, opts), nil
 	default:
 		return nil, fmt.Errorf("unsupported format: %s", format)
 	}
 }
+
+// processingOptions describes the content options applied to a pack,
+// for the header of the XML, Markdown, plain and HTML formats
+func processingOptions(opts config.OutputOptions) []string {
+	var options []string
+	if opts.KeepDocComments {
+		options = append(options, "implementation comments removed (doc comments kept)")
+	} else if opts.RemoveComments {
+		options = append(options, "comments removed")
+	}
+	if opts.RemoveEmptyLines {
+		options = append(options, "empty lines removed")
+	}
+	switch opts.Compress {
+	case "whitespace":
+		options = append(options, "code compressed")
+	case "signatures":
+		options = append(options, "function bodies elided (signatures only)")
+	}
+	if opts.TabWidth > 0 {
+		options = append(options, fmt.Sprintf("tabs expanded to %d columns", opts.TabWidth))
+	}
+	switch opts.LineEndings {
+	case LineEndingsLF:
+		options = append(options, "line endings converted to LF")
+	case LineEndingsCRLF:
+		options = append(options, "line endings converted to CRLF")
+	}
+	return options
+}
@@ -0,0 +1,339 @@
+package output
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/opskraken/codeecho-cli/config"
+	"github.com/opskraken/codeecho-cli/scanner"
+	"github.com/opskraken/codeecho-cli/utils"
+)
+
+// The stylesheet and script are inlined, so a report works offline
+var (
+	//go:embed html/report.css
+	htmlStyle string
+
+	//go:embed html/report.js
+	htmlScript string
+)
+
+// StreamingHTMLWriter writes a self-contained HTML report, for reviewers
+// who browse a pack rather than feed it to a model
+type StreamingHTMLWriter struct {
+	writer   *bufio.Writer
+	opts     config.OutputOptions
+	stats    *scanner.StreamingStats
+	repoPath string
+}
+
+// NewStreamingHTMLWriter creates a new streaming HTML writer
+func NewStreamingHTMLWriter(w io.Writer, opts config.OutputOptions) *StreamingHTMLWriter {
+	return &StreamingHTMLWriter{
+		writer: bufio.NewWriterSize(w, 65536),
+		opts:   opts,
+		stats: &scanner.StreamingStats{
+			LanguageCounts: make(map[string]int),
+		},
+	}
+}
+
+// htmlAnchor is the id of a file's section, derived from its path so the
+// tree can link to sections before they're written
+func htmlAnchor(path string) string {
+	return "file-" + url.PathEscape(filepath.ToSlash(path))
+}
+
+// WriteHeader opens the document and writes the repository information
+// and the filter box
+func (w *StreamingHTMLWriter) WriteHeader(repoPath string, scanTime string) error {
+	w.repoPath = repoPath
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="generator" content="CodeEcho CLI">
+<title>CodeEcho: %s</title>
+<style>
+%s</style>
+</head>
+<body>
+<header class="report">
+<h1>CodeEcho Repository Scan</h1>
+<dl class="info">
+<dt>Repository</dt><dd>%s</dd>
+<dt>Scan Time</dt><dd>%s</dd>
+`, html.EscapeString(filepath.Base(repoPath)), htmlStyle, html.EscapeString(repoPath), html.EscapeString(scanTime))
+
+	if w.opts.CommitSHA != "" {
+		fmt.Fprintf(&b, "<dt>Revision</dt><dd>%s</dd>\n<dt>Commit</dt><dd><code>%s</code></dd>\n<dt>Commit Date</dt><dd>%s</dd>\n",
+			html.EscapeString(w.opts.Revision), html.EscapeString(w.opts.CommitSHA), html.EscapeString(w.opts.CommitDate))
+	}
+	if w.opts.PartCount > 0 {
+		part := fmt.Sprintf("%d of %d", w.opts.Part, w.opts.PartCount)
+		if w.opts.PartGroup != "" {
+			part += fmt.Sprintf(" (%s)", w.opts.PartGroup)
+		}
+		fmt.Fprintf(&b, "<dt>Part</dt><dd>%s</dd>\n", html.EscapeString(part))
+	}
+
+	processing := "no processing applied"
+	if options := processingOptions(w.opts); len(options) > 0 {
+		processing = strings.Join(options, ", ")
+	}
+	fmt.Fprintf(&b, "<dt>Processing</dt><dd>%s</dd>\n</dl>\n", html.EscapeString(processing))
+
+	if w.opts.PartCount > 0 {
+		b.WriteString(`<p class="notice">Files are only split across parts when a single file exceeds the part limit; the directory structure is in part 1.</p>` + "\n")
+	}
+
+	b.WriteString(`<div class="filter">
+<input type="search" id="filter" placeholder="Filter files by name or content" autocomplete="off" aria-label="Filter files">
+<label><input type="checkbox" id="filter-contents" checked> Search contents</label>
+<span class="count" id="filter-count"></span>
+</div>
+</header>
+`)
+
+	_, err := w.writer.WriteString(b.String())
+	return err
+}
+
+// WriteTree writes the directory tree as nested collapsible lists that
+// link to the file sections
+func (w *StreamingHTMLWriter) WriteTree(paths []string) error {
+	if !w.opts.IncludeDirectoryTree || len(paths) == 0 {
+		return nil
+	}
+
+	root := "project"
+	if w.repoPath != "" {
+		root = filepath.Base(w.repoPath)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<nav class=\"tree\">\n<details open>\n<summary>%s/</summary>\n", html.EscapeString(root))
+	writeHTMLTree(&b, BuildDirectoryTree(paths))
+	b.WriteString("</details>\n</nav>\n")
+
+	_, err := w.writer.WriteString(b.String())
+	return err
+}
+
+// writeHTMLTree writes one level of the tree; directories start collapsed
+func writeHTMLTree(b *strings.Builder, nodes []*TreeNode) {
+	b.WriteString("<ul>\n")
+	for _, node := range nodes {
+		name := html.EscapeString(node.Name)
+		if node.Type == TreeDirectory {
+			fmt.Fprintf(b, "<li class=\"dir\"><details>\n<summary>%s/</summary>\n", name)
+			writeHTMLTree(b, node.Children)
+			b.WriteString("</details></li>\n")
+			continue
+		}
+		fmt.Fprintf(b, "<li data-path=\"%s\"><a href=\"#%s\"><code>%s</code></a></li>\n",
+			html.EscapeString(node.Path), html.EscapeString(htmlAnchor(node.Path)), name)
+	}
+	b.WriteString("</ul>\n")
+}
+
+// WriteFile writes a file's section, with its content highlighted
+func (w *StreamingHTMLWriter) WriteFile(file *scanner.FileInfo) error {
+	// Update stats
+	w.stats.TotalFiles++
+	w.stats.TotalSize += file.Size
+
+	if file.IsText {
+		w.stats.TextFiles++
+	} else {
+		w.stats.BinaryFiles++
+	}
+
+	if file.Language != "" {
+		w.stats.LanguageCounts[file.Language]++
+	}
+
+	// Chunks of a file share its path; the tree links to the first
+	path := filepath.ToSlash(file.RelativePath)
+	anchor := htmlAnchor(path)
+	if file.Chunk > 1 {
+		anchor += fmt.Sprintf("-%d", file.Chunk)
+	}
+
+	// Metadata
+	metadata := fmt.Sprintf("Size: %s", file.SizeFormatted)
+	if file.Language != "" {
+		metadata += fmt.Sprintf(" | Language: %s", file.Language)
+	}
+	if file.LineCount > 0 {
+		metadata += fmt.Sprintf(" | Lines: %d", file.LineCount)
+	}
+	if file.TokenCount > 0 {
+		metadata += fmt.Sprintf(" | Tokens: %d", file.TokenCount)
+	}
+	metadata += fmt.Sprintf(" | Modified: %s", file.ModTimeFormatted)
+	if file.Hash != "" {
+		metadata += fmt.Sprintf(" | Hash: %s", file.Hash)
+	}
+	if file.ChangeStatus != "" {
+		metadata += fmt.Sprintf(" | Status: %s", file.ChangeStatus)
+	}
+	if file.PreviousPath != "" {
+		metadata += fmt.Sprintf(" | Previous Path: %s", file.PreviousPath)
+	}
+	if file.Compression != "" {
+		metadata += fmt.Sprintf(" | Compression: %s", file.Compression)
+	}
+	if file.BudgetAction != "" {
+		metadata += fmt.Sprintf(" | Budget: %s", file.BudgetAction)
+	}
+	if file.Chunks > 0 {
+		metadata += fmt.Sprintf(" | Chunk: %d of %d", file.Chunk, file.Chunks)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<section class=\"file\" id=\"%s\" data-path=\"%s\">\n<h2><a href=\"#%s\">%s</a></h2>\n<p class=\"meta\">%s</p>\n",
+		html.EscapeString(anchor), html.EscapeString(path), html.EscapeString(anchor), html.EscapeString(path), html.EscapeString(metadata))
+
+	// Content
+	missing := "Content not included"
+	if file.ChangeStatus == "deleted" {
+		missing = "File deleted - no content"
+	} else if file.BudgetAction == scanner.BudgetActionStructureOnly {
+		missing = "Content omitted to fit the token budget"
+	} else if w.opts.IncludeContent && file.Content != "" && file.IsText {
+		missing = ""
+	} else if !file.IsText {
+		missing = "Binary file - content not displayed"
+	}
+
+	if missing != "" {
+		fmt.Fprintf(&b, "<p class=\"missing\">%s</p>\n", missing)
+	} else {
+		// Line numbers are added as markup, after highlighting
+		opts := w.opts
+		opts.ShowLineNumbers = false
+		content := renderContent(file.Content, opts)
+		fmt.Fprintf(&b, "<pre><code class=\"language-%s\">%s</code></pre>\n",
+			html.EscapeString(strings.ToLower(file.Language)), highlightHTML(content, file.Language, w.opts.ShowLineNumbers))
+	}
+	b.WriteString("</section>\n")
+
+	_, err := w.writer.WriteString(b.String())
+	return err
+}
+
+// highlightHTML escapes content for a <pre> block, wrapping its syntax
+// spans in classed <span>s. Line numbers are unselectable, so copied code
+// comes without them.
+func highlightHTML(content, language string, lineNumbers bool) string {
+	var b strings.Builder
+	b.Grow(len(content) * 5 / 4)
+
+	line := 1
+	number := func() {
+		fmt.Fprintf(&b, `<span class="ln">%4d: </span>`, line)
+		line++
+	}
+	text := func(s string) {
+		for lineNumbers {
+			i := strings.IndexByte(s, '\n')
+			if i < 0 {
+				break
+			}
+			b.WriteString(html.EscapeString(s[:i+1]))
+			number()
+			s = s[i+1:]
+		}
+		b.WriteString(html.EscapeString(s))
+	}
+
+	if lineNumbers {
+		number()
+	}
+	pos := 0
+	for _, span := range scanner.Highlight(content, language) {
+		text(content[pos:span.Start])
+		fmt.Fprintf(&b, `<span class="%s">`, span.Kind)
+		text(content[span.Start:span.End])
+		b.WriteString("</span>")
+		pos = span.End
+	}
+	text(content[pos:])
+	return b.String()
+}
+
+// WriteFooter writes the budget, secrets, errors and statistics, then the
+// filter script, and closes the document
+func (w *StreamingHTMLWriter) WriteFooter(stats *scanner.StreamingStats) error {
+	var b strings.Builder
+	b.WriteString("<footer class=\"report\">\n")
+
+	// Token budget decisions, so readers know what's missing
+	if budget := stats.Budget; budget != nil {
+		fmt.Fprintf(&b, "<h2>Token Budget</h2>\n<p>Max Tokens: %d | Strategy: %s | Original: %d | Planned: %d</p>\n",
+			budget.MaxTokens, html.EscapeString(string(budget.Strategy)), budget.OriginalTokens, budget.PlannedTokens)
+		if len(budget.Decisions) > 0 {
+			b.WriteString("<table>\n<tr><th>File</th><th>Action</th><th>Tokens</th><th>Reason</th></tr>\n")
+			for _, d := range budget.Decisions {
+				fmt.Fprintf(&b, "<tr><td>%s</td><td>%s</td><td>%d → %d</td><td>%s</td></tr>\n",
+					html.EscapeString(d.Path), html.EscapeString(d.Action), d.OriginalTokens, d.KeptTokens, html.EscapeString(d.Reason))
+			}
+			b.WriteString("</table>\n")
+		}
+	}
+
+	// Redacted secrets, so readers know why placeholders appear
+	if len(stats.Secrets) > 0 {
+		fmt.Fprintf(&b, "<h2>Redacted Secrets</h2>\n<p>%d secret(s) were replaced with <code>[REDACTED:&lt;rule&gt;]</code> placeholders.</p>\n", len(stats.Secrets))
+		b.WriteString("<table>\n<tr><th>File</th><th>Line</th><th>Rule</th></tr>\n")
+		for _, s := range stats.Secrets {
+			fmt.Fprintf(&b, "<tr><td>%s</td><td>%d</td><td>%s</td></tr>\n", html.EscapeString(s.Path), s.Line, html.EscapeString(s.Rule))
+		}
+		b.WriteString("</table>\n")
+	}
+
+	// Scan errors, so readers know the report is incomplete
+	if w.opts.IncludeErrors && len(stats.Errors) > 0 {
+		fmt.Fprintf(&b, "<h2>Errors</h2>\n<p>%d error(s) occurred while scanning; the files below are missing or incomplete.</p>\n", len(stats.Errors))
+		b.WriteString("<table>\n<tr><th>File</th><th>Phase</th><th>Skipped</th><th>Error</th></tr>\n")
+		for _, e := range stats.Errors {
+			fmt.Fprintf(&b, "<tr><td>%s</td><td>%s</td><td>%t</td><td>%s</td></tr>\n",
+				html.EscapeString(e.Path), html.EscapeString(e.Phase), e.Skipped, html.EscapeString(fmt.Sprint(e.Error)))
+		}
+		b.WriteString("</table>\n")
+	}
+
+	fmt.Fprintf(&b, `<h2>Scan Statistics</h2>
+<table>
+<tr><th>Total Files</th><td>%d</td></tr>
+<tr><th>Total Size</th><td>%s</td></tr>
+<tr><th>Text Files</th><td>%d</td></tr>
+<tr><th>Binary Files</th><td>%d</td></tr>
+`, stats.TotalFiles, utils.FormatBytes(stats.TotalSize), stats.TextFiles, stats.BinaryFiles)
+	if stats.DeletedFiles > 0 {
+		fmt.Fprintf(&b, "<tr><th>Deleted Files</th><td>%d</td></tr>\n", stats.DeletedFiles)
+	}
+	if stats.Tokenizer != "" {
+		fmt.Fprintf(&b, "<tr><th>Total Tokens</th><td>%d (%s)</td></tr>\n", stats.TotalTokens, html.EscapeString(stats.Tokenizer))
+	}
+	b.WriteString("</table>\n<p class=\"generated\">Generated by CodeEcho CLI</p>\n</footer>\n")
+
+	fmt.Fprintf(&b, "<script>\n%s</script>\n</body>\n</html>\n", htmlScript)
+
+	_, err := w.writer.WriteString(b.String())
+	return err
+}
+
+func (w *StreamingHTMLWriter) Close() error {
+	return w.writer.Flush()
+}
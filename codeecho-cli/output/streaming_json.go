@@ -37,11 +37,34 @@ func (w *StreamingJSONWriter) WriteHeader(repoPath string, scanTime string) erro
 	}
 
 	// Write repo metadata
-	repoInfo := fmt.Sprintf(`  "repo_path": %s,
+	repoInfo := fmt.Sprintf(`  "schema_version": %s,
+  "repo_path": %s,
   "scan_time": %s,
-  "processed_by": "CodeEcho CLI",
-  "files": [
-`, jsonString(repoPath), jsonString(scanTime))
+`, jsonString(JSONSchemaVersion), jsonString(repoPath), jsonString(scanTime))
+
+	if w.opts.CommitSHA != "" {
+		repoInfo += fmt.Sprintf(`  "revision": %s,
+  "commit": %s,
+  "commit_date": %s,
+`, jsonString(w.opts.Revision), jsonString(w.opts.CommitSHA), jsonString(w.opts.CommitDate))
+	}
+
+	if w.opts.PartCount > 0 {
+		repoInfo += fmt.Sprintf(`  "part": {"number": %d, "count": %d, "group": %s},
+`, w.opts.Part, w.opts.PartCount, jsonString(w.opts.PartGroup))
+	}
+
+	repoInfo += `  "processed_by": "CodeEcho CLI",
+`
+
+	// Processing options, so readers know how the content differs from
+	// the files
+	optionsJSON, err := json.MarshalIndent(newJSONOptions(w.opts), "  ", "  ")
+	if err != nil {
+		return err
+	}
+	repoInfo += fmt.Sprintf(`  "options": %s,
+`, optionsJSON)
 
 	if _, err := w.writer.WriteString(repoInfo); err != nil {
 		return err
@@ -50,22 +73,60 @@ func (w *StreamingJSONWriter) WriteHeader(repoPath string, scanTime string) erro
 	return nil
 }
 
+// jsonOptions is the options block of the JSON header
+type jsonOptions struct {
+	IncludeContent   bool   `json:"include_content"`
+	IncludeTree      bool   `json:"include_tree"`
+	LineNumbers      bool   `json:"line_numbers"`
+	TabWidth         int    `json:"tab_width"`    // 0 when tabs are kept
+	LineEndings      string `json:"line_endings"` // "lf", "crlf" or "" when kept
+	RemoveComments   bool   `json:"remove_comments"`
+	KeepDocComments  bool   `json:"keep_doc_comments"`
+	RemoveEmptyLines bool   `json:"remove_empty_lines"`
+	Compress         string `json:"compress"` // "whitespace", "signatures" or ""
+	IncludeErrors    bool   `json:"include_errors"`
+}
+
+func newJSONOptions(opts config.OutputOptions) jsonOptions {
+	return jsonOptions{
+		IncludeContent:   opts.IncludeContent,
+		IncludeTree:      opts.IncludeDirectoryTree,
+		LineNumbers:      opts.ShowLineNumbers,
+		TabWidth:         opts.TabWidth,
+		LineEndings:      opts.LineEndings,
+		RemoveComments:   opts.RemoveComments,
+		KeepDocComments:  opts.KeepDocComments,
+		RemoveEmptyLines: opts.RemoveEmptyLines,
+		Compress:         opts.Compress,
+		IncludeErrors:    opts.IncludeErrors,
+	}
+}
+
+// processing describes the options as processingOptions does
+func (o jsonOptions) processing() []string {
+	return processingOptions(config.OutputOptions{
+		TabWidth:         o.TabWidth,
+		LineEndings:      o.LineEndings,
+		RemoveComments:   o.RemoveComments,
+		KeepDocComments:  o.KeepDocComments,
+		RemoveEmptyLines: o.RemoveEmptyLines,
+		Compress:         o.Compress,
+	})
+}
+
 func (w *StreamingJSONWriter) WriteTree(paths []string) error {
 	if !w.opts.IncludeDirectoryTree || len(paths) == 0 {
 		return nil
 	}
 
-	// Convert paths to FileInfo structs (minimal data needed for tree)
-	fileInfos := make([]scanner.FileInfo, len(paths))
-	for i, path := range paths {
-		fileInfos[i] = scanner.FileInfo{RelativePath: path}
+	treeJSON, err := json.MarshalIndent(BuildDirectoryTree(paths), "  ", "  ")
+	if err != nil {
+		return err
 	}
 
-	tree := GenerateDirectoryTree(fileInfos)
-
 	// Add tree field before files array
-	treeField := fmt.Sprintf(`  "directory_tree": %s,
-`, jsonString(tree))
+	treeField := fmt.Sprintf(`  "tree": %s,
+`, treeJSON)
 
 	if _, err := w.writer.WriteString(treeField); err != nil {
 		return err
@@ -95,11 +156,13 @@ func (w *StreamingJSONWriter) WriteFile(file *scanner.FileInfo) error {
 		if _, err := w.writer.WriteString(",\n"); err != nil {
 			return err
 		}
+	} else if err := w.openFiles(); err != nil {
+		return err
 	}
 	w.firstFile = false
 
 	// Marshal file to JSON (Go does this automatically)
-	fileJSON, err := json.MarshalIndent(file, "    ", "  ")
+	fileJSON, err := json.MarshalIndent(renderedFile(file, w.opts), "    ", "  ")
 	if err != nil {
 		return err
 	}
@@ -115,26 +178,100 @@ func (w *StreamingJSONWriter) WriteFile(file *scanner.FileInfo) error {
 	return nil
 }
 
+// openFiles starts the files array. It's deferred until the first file so
+// the directory tree (written after the header) stays outside the array.
+func (w *StreamingJSONWriter) openFiles() error {
+	_, err := w.writer.WriteString(`  "files": [
+`)
+	return err
+}
+
 func (w *StreamingJSONWriter) WriteFooter(stats *scanner.StreamingStats) error {
-	// Close files array
+	// Close files array (open an empty one if no file was written)
+	if w.firstFile {
+		if err := w.openFiles(); err != nil {
+			return err
+		}
+	}
 	if _, err := w.writer.WriteString("\n  ],\n"); err != nil {
 		return err
 	}
 
+	// Language counts are sorted by key, so packs of the same tree diff
+	// cleanly
+	languages := stats.LanguageCounts
+	if languages == nil {
+		languages = map[string]int{}
+	}
+	languagesJSON, err := json.MarshalIndent(languages, "    ", "  ")
+	if err != nil {
+		return err
+	}
+
 	// Write statistics
 	statsJSON := fmt.Sprintf(`  "statistics": {
     "total_files": %d,
-    "total_size": %s,
+    "total_size": %d,
+    "total_size_formatted": %s,
     "text_files": %d,
-    "binary_files": %d
-  }
-}
-`, stats.TotalFiles, jsonString(utils.FormatBytes(stats.TotalSize)), stats.TextFiles, stats.BinaryFiles)
+    "binary_files": %d,
+    "deleted_files": %d,
+    "total_tokens": %d,
+    "tokenizer": %s,
+    "language_counts": %s
+  }`, stats.TotalFiles, stats.TotalSize, jsonString(utils.FormatBytes(stats.TotalSize)), stats.TextFiles, stats.BinaryFiles,
+		stats.DeletedFiles, stats.TotalTokens, jsonString(stats.Tokenizer), languagesJSON)
 
 	if _, err := w.writer.WriteString(statsJSON); err != nil {
 		return err
 	}
 
+	// Token budget decisions, so readers know what's missing
+	if stats.Budget != nil {
+		budgetJSON, err := json.MarshalIndent(stats.Budget, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		if _, err := w.writer.WriteString(",\n  \"token_budget\": "); err != nil {
+			return err
+		}
+		if _, err := w.writer.Write(budgetJSON); err != nil {
+			return err
+		}
+	}
+
+	// Redacted secrets, so readers know why placeholders appear
+	if len(stats.Secrets) > 0 {
+		secretsJSON, err := json.MarshalIndent(stats.Secrets, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		if _, err := w.writer.WriteString(",\n  \"redacted_secrets\": "); err != nil {
+			return err
+		}
+		if _, err := w.writer.Write(secretsJSON); err != nil {
+			return err
+		}
+	}
+
+	// Scan errors, so readers know the pack is incomplete
+	if w.opts.IncludeErrors && len(stats.Errors) > 0 {
+		errorsJSON, err := json.MarshalIndent(stats.Errors, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		if _, err := w.writer.WriteString(",\n  \"errors\": "); err != nil {
+			return err
+		}
+		if _, err := w.writer.Write(errorsJSON); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.writer.WriteString("\n}\n"); err != nil {
+		return err
+	}
+
 	return nil
 }
 
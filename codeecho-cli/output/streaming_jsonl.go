@@ -0,0 +1,144 @@
+package output
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/opskraken/codeecho-cli/config"
+	"github.com/opskraken/codeecho-cli/scanner"
+)
+
+// JSON Lines record types, in the order they appear
+const (
+	JSONLHeader = "header"
+	JSONLTree   = "tree"
+	JSONLFile   = "file"
+	JSONLStats  = "stats"
+)
+
+// jsonlPart places a part within a split pack
+type jsonlPart struct {
+	Number int    `json:"number"`
+	Count  int    `json:"count"`
+	Group  string `json:"group"`
+}
+
+type jsonlHeaderRecord struct {
+	Type        string      `json:"type"`
+	RepoPath    string      `json:"repo_path"`
+	ScanTime    string      `json:"scan_time"`
+	Revision    string      `json:"revision,omitempty"`
+	Commit      string      `json:"commit,omitempty"`
+	CommitDate  string      `json:"commit_date,omitempty"`
+	Part        *jsonlPart  `json:"part,omitempty"`
+	ProcessedBy string      `json:"processed_by"`
+	Options     jsonOptions `json:"options"` // As in the JSON header
+}
+
+type jsonlTreeRecord struct {
+	Type          string   `json:"type"`
+	Paths         []string `json:"paths"`
+	DirectoryTree string   `json:"directory_tree"`
+}
+
+type jsonlFileRecord struct {
+	Type string `json:"type"`
+	*scanner.FileInfo
+}
+
+type jsonlStatsRecord struct {
+	Type string `json:"type"`
+	*scanner.StreamingStats
+	Errors []scanner.ScanError `json:"errors,omitempty"` // Only with IncludeErrors
+}
+
+// StreamingJSONLWriter writes JSON Lines output: one record per line, so
+// a pack can be processed before it's complete and split on any line
+type StreamingJSONLWriter struct {
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	opts    config.OutputOptions
+	stats   *scanner.StreamingStats
+}
+
+// NewStreamingJSONLWriter creates a new streaming JSON Lines writer
+func NewStreamingJSONLWriter(w io.Writer, opts config.OutputOptions) *StreamingJSONLWriter {
+	writer := bufio.NewWriterSize(w, 65536)
+	return &StreamingJSONLWriter{
+		writer:  writer,
+		encoder: json.NewEncoder(writer), // Encode ends every record with a newline
+		opts:    opts,
+		stats: &scanner.StreamingStats{
+			LanguageCounts: make(map[string]int),
+		},
+	}
+}
+
+func (w *StreamingJSONLWriter) WriteHeader(repoPath string, scanTime string) error {
+	header := jsonlHeaderRecord{
+		Type:        JSONLHeader,
+		RepoPath:    repoPath,
+		ScanTime:    scanTime,
+		ProcessedBy: "CodeEcho CLI",
+		Options:     newJSONOptions(w.opts),
+	}
+	if w.opts.CommitSHA != "" {
+		header.Revision = w.opts.Revision
+		header.Commit = w.opts.CommitSHA
+		header.CommitDate = w.opts.CommitDate
+	}
+	if w.opts.PartCount > 0 {
+		header.Part = &jsonlPart{Number: w.opts.Part, Count: w.opts.PartCount, Group: w.opts.PartGroup}
+	}
+	return w.encoder.Encode(header)
+}
+
+func (w *StreamingJSONLWriter) WriteTree(paths []string) error {
+	if !w.opts.IncludeDirectoryTree || len(paths) == 0 {
+		return nil
+	}
+
+	// Convert paths to FileInfo structs (minimal data needed for tree)
+	fileInfos := make([]scanner.FileInfo, len(paths))
+	for i, path := range paths {
+		fileInfos[i] = scanner.FileInfo{RelativePath: path}
+	}
+
+	return w.encoder.Encode(jsonlTreeRecord{
+		Type:          JSONLTree,
+		Paths:         paths,
+		DirectoryTree: GenerateDirectoryTree(fileInfos),
+	})
+}
+
+func (w *StreamingJSONLWriter) WriteFile(file *scanner.FileInfo) error {
+	// Update stats
+	w.stats.TotalFiles++
+	w.stats.TotalSize += file.Size
+
+	if file.IsText {
+		w.stats.TextFiles++
+	} else {
+		w.stats.BinaryFiles++
+	}
+
+	if file.Language != "" {
+		w.stats.LanguageCounts[file.Language]++
+	}
+
+	return w.encoder.Encode(jsonlFileRecord{Type: JSONLFile, FileInfo: renderedFile(file, w.opts)})
+}
+
+// WriteFooter writes the stats record, with what the pack is missing
+func (w *StreamingJSONLWriter) WriteFooter(stats *scanner.StreamingStats) error {
+	record := jsonlStatsRecord{Type: JSONLStats, StreamingStats: stats}
+	if w.opts.IncludeErrors {
+		record.Errors = stats.Errors
+	}
+	return w.encoder.Encode(record)
+}
+
+func (w *StreamingJSONLWriter) Close() error {
+	return w.writer.Flush()
+}
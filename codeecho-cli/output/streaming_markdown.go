@@ -32,10 +32,30 @@ func (w *StreamingMarkdownWriter) WriteHeader(repoPath string, scanTime string)
 
 **Repository:** %s
 **Scan Time:** %s
+`, repoPath, scanTime)
 
-## Files
+	if w.opts.CommitSHA != "" {
+		header += fmt.Sprintf(`**Revision:** %s
+**Commit:** %s
+**Commit Date:** %s
+`, w.opts.Revision, w.opts.CommitSHA, w.opts.CommitDate)
+	}
 
-`, repoPath, scanTime)
+	processing := "no processing applied"
+	if options := processingOptions(w.opts); len(options) > 0 {
+		processing = strings.Join(options, ", ")
+	}
+	header += fmt.Sprintf("**Processing:** %s\n", processing)
+
+	if w.opts.PartCount > 0 {
+		header += fmt.Sprintf("**Part:** %d of %d", w.opts.Part, w.opts.PartCount)
+		if w.opts.PartGroup != "" {
+			header += fmt.Sprintf(" (%s)", w.opts.PartGroup)
+		}
+		header += "\n\n> Files are only split across parts when a single file exceeds the part limit; the directory structure is in part 1.\n"
+	}
+
+	header += "\n## Files\n\n"
 
 	if _, err := w.writer.WriteString(header); err != nil {
 		return err
@@ -61,13 +81,14 @@ func (w *StreamingMarkdownWriter) WriteTree(paths []string) error {
 	if _, err := w.writer.WriteString("## Directory Structure\n\n"); err != nil {
 		return err
 	}
-	if _, err := w.writer.WriteString("```\n"); err != nil {
+	fence := codeFence(tree)
+	if _, err := w.writer.WriteString(fence + "\n"); err != nil {
 		return err
 	}
 	if _, err := w.writer.WriteString(tree); err != nil {
 		return err
 	}
-	if _, err := w.writer.WriteString("```\n\n"); err != nil {
+	if _, err := w.writer.WriteString(fence + "\n\n"); err != nil {
 		return err
 	}
 
@@ -102,19 +123,51 @@ func (w *StreamingMarkdownWriter) WriteFile(file *scanner.FileInfo) error {
 	if file.LineCount > 0 {
 		metadata += fmt.Sprintf(" | **Lines:** %d", file.LineCount)
 	}
+	if file.TokenCount > 0 {
+		metadata += fmt.Sprintf(" | **Tokens:** %d", file.TokenCount)
+	}
 	if file.Extension != "" {
 		metadata += fmt.Sprintf(" | **Extension:** %s", file.Extension)
 	}
 	metadata += fmt.Sprintf(" | **Modified:** %s", file.ModTimeFormatted)
-	metadata += fmt.Sprintf(" | **Text File:** %t\n\n", file.IsText)
+	metadata += fmt.Sprintf(" | **Text File:** %t", file.IsText)
+	if file.Hash != "" {
+		metadata += fmt.Sprintf(" | **Hash:** %s", file.Hash)
+	}
+	if file.ChangeStatus != "" {
+		metadata += fmt.Sprintf(" | **Status:** %s", file.ChangeStatus)
+	}
+	if file.Compression != "" {
+		metadata += fmt.Sprintf(" | **Compression:** %s (function bodies elided)", file.Compression)
+	}
+	if file.BudgetAction != "" {
+		metadata += fmt.Sprintf(" | **Budget:** %s", file.BudgetAction)
+	}
+	if file.Chunks > 0 {
+		metadata += fmt.Sprintf(" | **Chunk:** %d of %d", file.Chunk, file.Chunks)
+	}
+	if file.PreviousPath != "" {
+		metadata += fmt.Sprintf(" | **Previous Path:** %s", file.PreviousPath)
+	}
+	metadata += "\n\n"
 
 	if _, err := w.writer.WriteString(metadata); err != nil {
 		return err
 	}
 
 	// Content
-	if w.opts.IncludeContent && file.Content != "" && file.IsText {
-		codeBlock := fmt.Sprintf("```%s\n%s\n```\n\n", strings.ToLower(file.Language), file.Content)
+	if file.ChangeStatus == "deleted" {
+		if _, err := w.writer.WriteString("*File deleted - no content*\n\n"); err != nil {
+			return err
+		}
+	} else if file.BudgetAction == scanner.BudgetActionStructureOnly {
+		if _, err := w.writer.WriteString("*Content omitted to fit the token budget*\n\n"); err != nil {
+			return err
+		}
+	} else if w.opts.IncludeContent && file.Content != "" && file.IsText {
+		content := renderContent(file.Content, w.opts)
+		fence := codeFence(content)
+		codeBlock := fmt.Sprintf("%s%s\n%s\n%s\n\n", fence, strings.ToLower(file.Language), content, fence)
 		if _, err := w.writer.WriteString(codeBlock); err != nil {
 			return err
 		}
@@ -137,17 +190,68 @@ func (w *StreamingMarkdownWriter) WriteFile(file *scanner.FileInfo) error {
 }
 
 func (w *StreamingMarkdownWriter) WriteFooter(stats *scanner.StreamingStats) error {
+	// Optional statistics lines
+	extra := ""
+	if stats.DeletedFiles > 0 {
+		extra = fmt.Sprintf("- **Deleted Files:** %d\n", stats.DeletedFiles)
+	}
+	if stats.Tokenizer != "" {
+		extra += fmt.Sprintf("- **Total Tokens:** %d (%s)\n", stats.TotalTokens, stats.Tokenizer)
+	}
+
+	// Token budget decisions, so readers know what's missing
+	if budget := stats.Budget; budget != nil {
+		section := fmt.Sprintf("## Token Budget\n\n**Max Tokens:** %d | **Strategy:** %s | **Original:** %d | **Planned:** %d\n\n",
+			budget.MaxTokens, budget.Strategy, budget.OriginalTokens, budget.PlannedTokens)
+		if len(budget.Decisions) > 0 {
+			section += "| File | Action | Tokens | Reason |\n| --- | --- | --- | --- |\n"
+			for _, d := range budget.Decisions {
+				section += fmt.Sprintf("| %s | %s | %d → %d | %s |\n", d.Path, d.Action, d.OriginalTokens, d.KeptTokens, d.Reason)
+			}
+			section += "\n"
+		}
+		if _, err := w.writer.WriteString(section); err != nil {
+			return err
+		}
+	}
+
+	// Redacted secrets, so readers know why placeholders appear
+	if len(stats.Secrets) > 0 {
+		section := fmt.Sprintf("## Redacted Secrets\n\n%d secret(s) were replaced with `[REDACTED:<rule>]` placeholders.\n\n", len(stats.Secrets))
+		section += "| File | Line | Rule |\n| --- | --- | --- |\n"
+		for _, s := range stats.Secrets {
+			section += fmt.Sprintf("| %s | %d | %s |\n", s.Path, s.Line, s.Rule)
+		}
+		section += "\n"
+		if _, err := w.writer.WriteString(section); err != nil {
+			return err
+		}
+	}
+
+	// Scan errors, so readers know the pack is incomplete
+	if w.opts.IncludeErrors && len(stats.Errors) > 0 {
+		section := fmt.Sprintf("## Errors\n\n%d error(s) occurred while scanning; the files below are missing or incomplete.\n\n", len(stats.Errors))
+		section += "| File | Phase | Skipped | Error |\n| --- | --- | --- | --- |\n"
+		for _, e := range stats.Errors {
+			section += fmt.Sprintf("| %s | %s | %t | %s |\n", e.Path, e.Phase, e.Skipped, e.Error)
+		}
+		section += "\n"
+		if _, err := w.writer.WriteString(section); err != nil {
+			return err
+		}
+	}
+
 	footer := fmt.Sprintf(`## Scan Statistics
 
 - **Total Files:** %d
 - **Total Size:** %s
 - **Text Files:** %d
 - **Binary Files:** %d
-
+%s
 ---
 
 *Generated by CodeEcho CLI*
-`, stats.TotalFiles, utils.FormatBytes(stats.TotalSize), stats.TextFiles, stats.BinaryFiles)
+`, stats.TotalFiles, utils.FormatBytes(stats.TotalSize), stats.TextFiles, stats.BinaryFiles, extra)
 
 	if _, err := w.writer.WriteString(footer); err != nil {
 		return err
@@ -0,0 +1,289 @@
+package output
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/opskraken/codeecho-cli/config"
+	"github.com/opskraken/codeecho-cli/scanner"
+	"github.com/opskraken/codeecho-cli/utils"
+)
+
+// plainRule separates the sections of a plain text pack
+var plainRule = strings.Repeat("=", 64)
+
+// StreamingPlainWriter writes plain text output incrementally, for tools
+// and models that handle neither XML nor Markdown well
+type StreamingPlainWriter struct {
+	writer *bufio.Writer
+	opts   config.OutputOptions
+	stats  *scanner.StreamingStats
+}
+
+// NewStreamingPlainWriter creates a new streaming plain text writer
+func NewStreamingPlainWriter(w io.Writer, opts config.OutputOptions) *StreamingPlainWriter {
+	return &StreamingPlainWriter{
+		writer: bufio.NewWriterSize(w, 65536),
+		opts:   opts,
+		stats: &scanner.StreamingStats{
+			LanguageCounts: make(map[string]int),
+		},
+	}
+}
+
+// section starts a titled section between two rules
+func (w *StreamingPlainWriter) section(title string) error {
+	_, err := w.writer.WriteString(fmt.Sprintf("%s\n%s\n%s\n\n", plainRule, title, plainRule))
+	return err
+}
+
+// WriteHeader writes the preamble, summary and repository information
+func (w *StreamingPlainWriter) WriteHeader(repoPath string, scanTime string) error {
+	header := "This file is a merged representation of the entire codebase, combined into a single document by CodeEcho CLI.\n"
+	if w.opts.PartCount > 0 {
+		header += fmt.Sprintf("This is part %d of %d. Files are only split across parts when a single file exceeds the part limit; the directory structure is in part 1.\n",
+			w.opts.Part, w.opts.PartCount)
+	}
+
+	processing := "no processing applied"
+	if options := processingOptions(w.opts); len(options) > 0 {
+		processing = strings.Join(options, ", ")
+	}
+	header += fmt.Sprintf("The content has been processed with the following options: %s\n\n", processing)
+
+	if _, err := w.writer.WriteString(header); err != nil {
+		return err
+	}
+
+	// File summary section
+	if w.opts.IncludeSummary {
+		if err := w.section("File Summary"); err != nil {
+			return err
+		}
+
+		summary := `Purpose:
+This file contains a packed representation of the entire repository's contents.
+It is designed to be easily consumable by AI systems for analysis, code review,
+or other automated processes.
+
+File Format:
+The content is organized as follows:
+1. This summary section
+2. Repository information
+3. Directory structure (if enabled)
+4. Multiple file entries, each consisting of:
+  - A separator line with the file path (==== File: path ====)
+  - A line of file metadata
+  - Full contents of the file
+
+Usage Guidelines:
+- This file should be treated as read-only. Any changes should be made to the
+  original repository files, not this packed version.
+- When processing this file, use the file path to distinguish
+  between different files in the repository.
+- Be aware that this file may contain sensitive information. Handle it with
+  the same level of security as you would the original repository.
+
+Notes:
+- Some files may have been excluded based on .gitignore rules and CodeEcho's configuration
+- Binary files are not included in this packed representation
+- Files matching default ignore patterns are excluded
+`
+		if w.opts.RemoveComments || w.opts.RemoveEmptyLines || w.opts.Compress != "" {
+			summary += "- File processing has been applied - content may differ from original files\n"
+		}
+		summary += fmt.Sprintf("- Generated by CodeEcho CLI on %s\n\n", scanTime)
+
+		if _, err := w.writer.WriteString(summary); err != nil {
+			return err
+		}
+	}
+
+	// Repository info
+	if err := w.section("Repository Information"); err != nil {
+		return err
+	}
+	info := fmt.Sprintf("Repository: %s\nScan Time: %s\n", repoPath, scanTime)
+	if w.opts.CommitSHA != "" {
+		info += fmt.Sprintf("Revision: %s\nCommit: %s\nCommit Date: %s\n", w.opts.Revision, w.opts.CommitSHA, w.opts.CommitDate)
+	}
+	if w.opts.PartCount > 0 {
+		info += fmt.Sprintf("Part: %d of %d", w.opts.Part, w.opts.PartCount)
+		if w.opts.PartGroup != "" {
+			info += fmt.Sprintf(" (%s)", w.opts.PartGroup)
+		}
+		info += "\n"
+	}
+	if _, err := w.writer.WriteString(info + "\n"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (w *StreamingPlainWriter) WriteTree(paths []string) error {
+	if !w.opts.IncludeDirectoryTree || len(paths) == 0 {
+		return nil
+	}
+
+	// Convert paths to FileInfo structs (minimal data needed for tree)
+	fileInfos := make([]scanner.FileInfo, len(paths))
+	for i, path := range paths {
+		fileInfos[i] = scanner.FileInfo{RelativePath: path}
+	}
+
+	if err := w.section("Directory Structure"); err != nil {
+		return err
+	}
+	if _, err := w.writer.WriteString(GenerateDirectoryTree(fileInfos) + "\n"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// WriteFile writes a single file entry; its separator line sets it apart
+// from the previous one
+func (w *StreamingPlainWriter) WriteFile(file *scanner.FileInfo) error {
+	// Update stats
+	w.stats.TotalFiles++
+	w.stats.TotalSize += file.Size
+
+	if file.IsText {
+		w.stats.TextFiles++
+	} else {
+		w.stats.BinaryFiles++
+	}
+
+	if file.Language != "" {
+		w.stats.LanguageCounts[file.Language]++
+	}
+
+	// Separator and metadata
+	metadata := fmt.Sprintf("Size: %s", file.SizeFormatted)
+	if file.Language != "" {
+		metadata += fmt.Sprintf(" | Language: %s", file.Language)
+	}
+	if file.LineCount > 0 {
+		metadata += fmt.Sprintf(" | Lines: %d", file.LineCount)
+	}
+	if file.TokenCount > 0 {
+		metadata += fmt.Sprintf(" | Tokens: %d", file.TokenCount)
+	}
+	metadata += fmt.Sprintf(" | Modified: %s", file.ModTimeFormatted)
+	if file.Hash != "" {
+		metadata += fmt.Sprintf(" | Hash: %s", file.Hash)
+	}
+	if file.ChangeStatus != "" {
+		metadata += fmt.Sprintf(" | Status: %s", file.ChangeStatus)
+	}
+	if file.PreviousPath != "" {
+		metadata += fmt.Sprintf(" | Previous Path: %s", file.PreviousPath)
+	}
+	if file.Compression != "" {
+		metadata += fmt.Sprintf(" | Compression: %s", file.Compression)
+	}
+	if file.BudgetAction != "" {
+		metadata += fmt.Sprintf(" | Budget: %s", file.BudgetAction)
+	}
+	if file.Chunks > 0 {
+		metadata += fmt.Sprintf(" | Chunk: %d of %d", file.Chunk, file.Chunks)
+	}
+
+	if _, err := w.writer.WriteString(fmt.Sprintf("==== File: %s ====\n%s\n\n", file.RelativePath, metadata)); err != nil {
+		return err
+	}
+
+	// Content
+	content := "[Content not included]"
+	if file.ChangeStatus == "deleted" {
+		content = "[File deleted - no content]"
+	} else if file.BudgetAction == scanner.BudgetActionStructureOnly {
+		content = "[Content omitted to fit the token budget]"
+	} else if w.opts.IncludeContent && file.Content != "" && file.IsText {
+		content = renderContent(file.Content, w.opts)
+	} else if !file.IsText {
+		content = "[Binary file - content not included]"
+	}
+
+	if _, err := w.writer.WriteString(content + "\n\n"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// WriteFooter writes the final statistics and what the pack is missing
+func (w *StreamingPlainWriter) WriteFooter(stats *scanner.StreamingStats) error {
+	if err := w.section("Scan Statistics"); err != nil {
+		return err
+	}
+
+	statsText := fmt.Sprintf("Total Files: %d\nTotal Size: %s\nText Files: %d\nBinary Files: %d\n",
+		stats.TotalFiles, utils.FormatBytes(stats.TotalSize), stats.TextFiles, stats.BinaryFiles)
+	if stats.Tokenizer != "" {
+		statsText += fmt.Sprintf("Total Tokens: %d (%s)\n", stats.TotalTokens, stats.Tokenizer)
+	}
+	if stats.DeletedFiles > 0 {
+		statsText += fmt.Sprintf("Deleted Files: %d\n", stats.DeletedFiles)
+	}
+	if _, err := w.writer.WriteString(statsText + "\n"); err != nil {
+		return err
+	}
+
+	// Token budget decisions, so readers know what's missing
+	if budget := stats.Budget; budget != nil {
+		if err := w.section("Token Budget"); err != nil {
+			return err
+		}
+		budgetText := fmt.Sprintf("Max Tokens: %d | Strategy: %s | Original: %d | Planned: %d\n",
+			budget.MaxTokens, budget.Strategy, budget.OriginalTokens, budget.PlannedTokens)
+		for _, d := range budget.Decisions {
+			budgetText += fmt.Sprintf("- %s: %s, %d -> %d tokens (%s)\n", d.Path, d.Action, d.OriginalTokens, d.KeptTokens, d.Reason)
+		}
+		if _, err := w.writer.WriteString(budgetText + "\n"); err != nil {
+			return err
+		}
+	}
+
+	// Redacted secrets, so readers know why placeholders appear
+	if len(stats.Secrets) > 0 {
+		if err := w.section("Redacted Secrets"); err != nil {
+			return err
+		}
+		secretsText := fmt.Sprintf("%d secret(s) were replaced with [REDACTED:<rule>] placeholders.\n", len(stats.Secrets))
+		for _, s := range stats.Secrets {
+			secretsText += fmt.Sprintf("- %s:%d (%s)\n", s.Path, s.Line, s.Rule)
+		}
+		if _, err := w.writer.WriteString(secretsText + "\n"); err != nil {
+			return err
+		}
+	}
+
+	// Scan errors, so readers know the pack is incomplete
+	if w.opts.IncludeErrors && len(stats.Errors) > 0 {
+		if err := w.section("Errors"); err != nil {
+			return err
+		}
+		errorsText := fmt.Sprintf("%d error(s) occurred while scanning; the files below are missing or incomplete.\n", len(stats.Errors))
+		for _, e := range stats.Errors {
+			skipped := ""
+			if e.Skipped {
+				skipped = ", skipped"
+			}
+			errorsText += fmt.Sprintf("- %s (%s%s): %s\n", e.Path, e.Phase, skipped, e.Error)
+		}
+		if _, err := w.writer.WriteString(errorsText + "\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close flushes the buffer
+func (w *StreamingPlainWriter) Close() error {
+	return w.writer.Flush()
+}
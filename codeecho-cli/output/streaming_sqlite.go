@@ -0,0 +1,332 @@
+package output
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	_ "modernc.org/sqlite" // Pure Go driver (no cgo), built with FTS5
+
+	"github.com/opskraken/codeecho-cli/config"
+	"github.com/opskraken/codeecho-cli/scanner"
+)
+
+// SQLiteSchemaVersion is the schema_version row of scan_meta. Bump it when
+// a table or column changes.
+const SQLiteSchemaVersion = "1"
+
+// sqliteSchema holds one pack. files_fts indexes the path and content of
+// every file, e.g. SELECT relative_path FROM files_fts WHERE files_fts MATCH 'mutex'.
+const sqliteSchema = `
+CREATE TABLE scan_meta (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+
+CREATE TABLE files (
+	id                 INTEGER PRIMARY KEY,
+	path               TEXT NOT NULL,
+	relative_path      TEXT NOT NULL,
+	size               INTEGER NOT NULL,
+	size_formatted     TEXT NOT NULL,
+	mod_time           TEXT NOT NULL,
+	mod_time_formatted TEXT NOT NULL,
+	content            TEXT, -- NULL when not packed
+	language           TEXT NOT NULL,
+	line_count         INTEGER NOT NULL,
+	token_count        INTEGER NOT NULL,
+	extension          TEXT NOT NULL,
+	is_text            INTEGER NOT NULL,
+	change_status      TEXT NOT NULL,
+	previous_path      TEXT NOT NULL,
+	hash               TEXT NOT NULL,
+	compression        TEXT NOT NULL,
+	budget_action      TEXT NOT NULL,
+	chunk              INTEGER NOT NULL,
+	chunks             INTEGER NOT NULL
+);
+CREATE INDEX files_relative_path ON files (relative_path);
+CREATE INDEX files_language ON files (language);
+
+CREATE VIRTUAL TABLE files_fts USING fts5 (relative_path, content, content = 'files', content_rowid = 'id');
+
+CREATE TABLE languages (
+	language TEXT PRIMARY KEY,
+	files    INTEGER NOT NULL,
+	size     INTEGER NOT NULL,
+	lines    INTEGER NOT NULL,
+	tokens   INTEGER NOT NULL
+);
+
+CREATE TABLE errors (
+	path    TEXT NOT NULL,
+	phase   TEXT NOT NULL,
+	error   TEXT NOT NULL,
+	skipped INTEGER NOT NULL
+);
+
+CREATE TABLE secrets (
+	path TEXT NOT NULL,
+	line INTEGER NOT NULL,
+	rule TEXT NOT NULL
+);
+
+CREATE TABLE budget_decisions (
+	path            TEXT NOT NULL,
+	action          TEXT NOT NULL,
+	reason          TEXT NOT NULL,
+	original_tokens INTEGER NOT NULL,
+	kept_tokens     INTEGER NOT NULL
+);
+`
+
+const (
+	sqliteInsertFile = `INSERT INTO files (path, relative_path, size, size_formatted, mod_time, mod_time_formatted,
+	content, language, line_count, token_count, extension, is_text, change_status, previous_path, hash,
+	compression, budget_action, chunk, chunks) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	sqliteInsertFTS = `INSERT INTO files_fts (rowid, relative_path, content) VALUES (?, ?, ?)`
+)
+
+// StreamingSQLiteWriter writes a pack as a SQLite database, to query
+// scans with SQL. Rows are inserted in one transaction as files arrive,
+// into a temporary database that Close copies to the output; SQLite
+// spills to that file, so memory stays bounded. A database whose footer
+// was never written is rolled back and not copied.
+type StreamingSQLiteWriter struct {
+	out   io.Writer
+	opts  config.OutputOptions
+	stats *scanner.StreamingStats
+
+	// Opened by WriteHeader, so creating a writer has no side effects
+	path       string
+	db         *sql.DB
+	tx         *sql.Tx
+	insertFile *sql.Stmt
+	insertFTS  *sql.Stmt
+	finished   bool // WriteFooter succeeded
+}
+
+// NewStreamingSQLiteWriter creates a new streaming SQLite writer
+func NewStreamingSQLiteWriter(w io.Writer, opts config.OutputOptions) *StreamingSQLiteWriter {
+	return &StreamingSQLiteWriter{
+		out:  w,
+		opts: opts,
+		stats: &scanner.StreamingStats{
+			LanguageCounts: make(map[string]int),
+		},
+	}
+}
+
+// open creates the temporary database and starts the transaction
+func (w *StreamingSQLiteWriter) open() error {
+	tmp, err := os.CreateTemp("", "codeecho-*.sqlite")
+	if err != nil {
+		return fmt.Errorf("failed to create database: %w", err)
+	}
+	tmp.Close()
+	w.path = tmp.Name()
+
+	if w.db, err = sql.Open("sqlite", w.path); err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	w.db.SetMaxOpenConns(1)
+
+	// The file is thrown away if the scan fails, so it needs no journal
+	if _, err := w.db.Exec("PRAGMA journal_mode = OFF; PRAGMA synchronous = OFF;" + sqliteSchema); err != nil {
+		return fmt.Errorf("failed to create tables: %w", err)
+	}
+
+	if w.tx, err = w.db.Begin(); err != nil {
+		return err
+	}
+	if w.insertFile, err = w.tx.Prepare(sqliteInsertFile); err != nil {
+		return err
+	}
+	w.insertFTS, err = w.tx.Prepare(sqliteInsertFTS)
+	return err
+}
+
+// meta sets a scan_meta row
+func (w *StreamingSQLiteWriter) meta(key, value string) error {
+	_, err := w.tx.Exec("INSERT OR REPLACE INTO scan_meta (key, value) VALUES (?, ?)", key, value)
+	return err
+}
+
+// WriteHeader opens the database and records the scan in scan_meta
+func (w *StreamingSQLiteWriter) WriteHeader(repoPath string, scanTime string) error {
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	meta := [][2]string{
+		{"schema_version", SQLiteSchemaVersion},
+		{"repo_path", repoPath},
+		{"scan_time", scanTime},
+		{"processed_by", "CodeEcho CLI"},
+		{"processing", strings.Join(processingOptions(w.opts), ", ")},
+	}
+	if w.opts.CommitSHA != "" {
+		meta = append(meta, [2]string{"revision", w.opts.Revision}, [2]string{"commit", w.opts.CommitSHA}, [2]string{"commit_date", w.opts.CommitDate})
+	}
+	for _, m := range meta {
+		if err := w.meta(m[0], m[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *StreamingSQLiteWriter) WriteTree(paths []string) error {
+	if !w.opts.IncludeDirectoryTree || len(paths) == 0 {
+		return nil
+	}
+
+	// Convert paths to FileInfo structs (minimal data needed for tree)
+	fileInfos := make([]scanner.FileInfo, len(paths))
+	for i, path := range paths {
+		fileInfos[i] = scanner.FileInfo{RelativePath: path}
+	}
+
+	return w.meta("directory_tree", GenerateDirectoryTree(fileInfos))
+}
+
+// WriteFile inserts a file and indexes its path and content
+func (w *StreamingSQLiteWriter) WriteFile(file *scanner.FileInfo) error {
+	// Update stats
+	w.stats.TotalFiles++
+	w.stats.TotalSize += file.Size
+
+	if file.IsText {
+		w.stats.TextFiles++
+	} else {
+		w.stats.BinaryFiles++
+	}
+
+	if file.Language != "" {
+		w.stats.LanguageCounts[file.Language]++
+	}
+
+	rendered := renderedFile(file, w.opts)
+	var content sql.NullString
+	if rendered.Content != "" {
+		content = sql.NullString{String: rendered.Content, Valid: true}
+	}
+
+	result, err := w.insertFile.Exec(file.Path, file.RelativePath, file.Size, file.SizeFormatted, file.ModTime, file.ModTimeFormatted,
+		content, file.Language, file.LineCount, file.TokenCount, file.Extension, file.IsText, file.ChangeStatus, file.PreviousPath, file.Hash,
+		file.Compression, file.BudgetAction, file.Chunk, file.Chunks)
+	if err != nil {
+		return fmt.Errorf("failed to insert %s: %w", file.RelativePath, err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	_, err = w.insertFTS.Exec(id, file.RelativePath, content)
+	return err
+}
+
+// WriteFooter records the statistics, languages and what the pack is
+// missing
+func (w *StreamingSQLiteWriter) WriteFooter(stats *scanner.StreamingStats) error {
+	meta := [][2]string{
+		{"total_files", strconv.Itoa(stats.TotalFiles)},
+		{"total_size", strconv.FormatInt(stats.TotalSize, 10)},
+		{"text_files", strconv.Itoa(stats.TextFiles)},
+		{"binary_files", strconv.Itoa(stats.BinaryFiles)},
+		{"deleted_files", strconv.Itoa(stats.DeletedFiles)},
+	}
+	if stats.Tokenizer != "" {
+		meta = append(meta, [2]string{"total_tokens", strconv.Itoa(stats.TotalTokens)}, [2]string{"tokenizer", stats.Tokenizer})
+	}
+	if budget := stats.Budget; budget != nil {
+		meta = append(meta,
+			[2]string{"budget_max_tokens", strconv.Itoa(budget.MaxTokens)},
+			[2]string{"budget_strategy", string(budget.Strategy)},
+			[2]string{"budget_original_tokens", strconv.Itoa(budget.OriginalTokens)},
+			[2]string{"budget_planned_tokens", strconv.Itoa(budget.PlannedTokens)})
+	}
+	for _, m := range meta {
+		if err := w.meta(m[0], m[1]); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.tx.Exec(`INSERT INTO languages (language, files, size, lines, tokens)
+		SELECT language, COUNT(*), SUM(size), SUM(line_count), SUM(token_count) FROM files
+		WHERE language != '' GROUP BY language`); err != nil {
+		return err
+	}
+
+	if budget := stats.Budget; budget != nil {
+		for _, d := range budget.Decisions {
+			if _, err := w.tx.Exec("INSERT INTO budget_decisions (path, action, reason, original_tokens, kept_tokens) VALUES (?, ?, ?, ?, ?)",
+				d.Path, d.Action, d.Reason, d.OriginalTokens, d.KeptTokens); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, s := range stats.Secrets {
+		if _, err := w.tx.Exec("INSERT INTO secrets (path, line, rule) VALUES (?, ?, ?)", s.Path, s.Line, s.Rule); err != nil {
+			return err
+		}
+	}
+
+	if w.opts.IncludeErrors {
+		for _, e := range stats.Errors {
+			if _, err := w.tx.Exec("INSERT INTO errors (path, phase, error, skipped) VALUES (?, ?, ?, ?)",
+				e.Path, e.Phase, fmt.Sprint(e.Error), e.Skipped); err != nil {
+				return err
+			}
+		}
+	}
+	w.finished = true
+	return nil
+}
+
+// Close commits the transaction and copies the database to the output.
+// When the scan failed before the footer, it rolls back and writes
+// nothing.
+func (w *StreamingSQLiteWriter) Close() error {
+	if w.path == "" {
+		return nil
+	}
+	defer os.Remove(w.path)
+	path, tx := w.path, w.tx
+	w.path, w.tx = "", nil
+
+	var err error
+	switch {
+	case tx == nil:
+		// WriteHeader failed, and has said so
+	case !w.finished:
+		// The scan failed; a pack without its footer isn't written
+		tx.Rollback()
+		tx = nil
+	default:
+		err = tx.Commit()
+	}
+	if w.db != nil {
+		if closeErr := w.db.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write database: %w", err)
+	}
+	if tx == nil {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w.out, f)
+	return err
+}
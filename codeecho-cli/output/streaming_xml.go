@@ -41,21 +41,19 @@ func (w *StreamingXMLWriter) WriteHeader(repoPath string, scanTime string) error
 		return err
 	}
 
-	if _, err := w.writer.WriteString("<!-- The content has been processed with the following options: "); err != nil {
-		return err
+	if w.opts.PartCount > 0 {
+		preamble := fmt.Sprintf("<!-- This is part %d of %d. Files are only split across parts when a single file exceeds the part limit; the directory structure is in part 1. -->\n",
+			w.opts.Part, w.opts.PartCount)
+		if _, err := w.writer.WriteString(preamble); err != nil {
+			return err
+		}
 	}
 
-	var options []string
-	if w.opts.RemoveComments {
-		options = append(options, "comments removed")
-	}
-	if w.opts.RemoveEmptyLines {
-		options = append(options, "empty lines removed")
-	}
-	if w.opts.CompressCode {
-		options = append(options, "code compressed")
+	if _, err := w.writer.WriteString("<!-- The content has been processed with the following options: "); err != nil {
+		return err
 	}
 
+	options := processingOptions(w.opts)
 	if len(options) > 0 {
 		if _, err := w.writer.WriteString(strings.Join(options, ", ")); err != nil {
 			return err
@@ -108,7 +106,7 @@ The content is organized as follows:
 			return err
 		}
 
-		if w.opts.RemoveComments || w.opts.RemoveEmptyLines || w.opts.CompressCode {
+		if w.opts.RemoveComments || w.opts.RemoveEmptyLines || w.opts.Compress != "" {
 			if _, err := w.writer.WriteString("- File processing has been applied - content may differ from original files\n"); err != nil {
 				return err
 			}
@@ -123,7 +121,26 @@ The content is organized as follows:
 	}
 
 	// Repository info (will update stats in footer)
-	if _, err := w.writer.WriteString(fmt.Sprintf("<repository_info>\n<repo_path>%s</repo_path>\n<scan_time>%s</scan_time>\n</repository_info>\n\n", escapeXML(repoPath), scanTime)); err != nil {
+	if _, err := w.writer.WriteString(fmt.Sprintf("<repository_info>\n<repo_path>%s</repo_path>\n<scan_time>%s</scan_time>\n", escapeXML(repoPath), scanTime)); err != nil {
+		return err
+	}
+	if w.opts.CommitSHA != "" {
+		revision := fmt.Sprintf("<revision>%s</revision>\n<commit>%s</commit>\n<commit_date>%s</commit_date>\n",
+			escapeXML(w.opts.Revision), w.opts.CommitSHA, w.opts.CommitDate)
+		if _, err := w.writer.WriteString(revision); err != nil {
+			return err
+		}
+	}
+	if w.opts.PartCount > 0 {
+		part := fmt.Sprintf("<part number=\"%d\" count=\"%d\"", w.opts.Part, w.opts.PartCount)
+		if w.opts.PartGroup != "" {
+			part += fmt.Sprintf(" group=\"%s\"", escapeXML(w.opts.PartGroup))
+		}
+		if _, err := w.writer.WriteString(part + " />\n"); err != nil {
+			return err
+		}
+	}
+	if _, err := w.writer.WriteString("</repository_info>\n\n"); err != nil {
 		return err
 	}
 
@@ -195,6 +212,12 @@ func (w *StreamingXMLWriter) WriteFile(file *scanner.FileInfo) error {
 		}
 	}
 
+	if file.TokenCount > 0 {
+		if _, err := w.writer.WriteString(fmt.Sprintf(` tokens="%d"`, file.TokenCount)); err != nil {
+			return err
+		}
+	}
+
 	if _, err := w.writer.WriteString(fmt.Sprintf(` size="%s"`, file.SizeFormatted)); err != nil {
 		return err
 	}
@@ -213,22 +236,59 @@ func (w *StreamingXMLWriter) WriteFile(file *scanner.FileInfo) error {
 		return err
 	}
 
+	if file.Hash != "" {
+		if _, err := w.writer.WriteString(fmt.Sprintf(` hash="%s"`, file.Hash)); err != nil {
+			return err
+		}
+	}
+
+	if file.Compression != "" {
+		if _, err := w.writer.WriteString(fmt.Sprintf(` compression="%s"`, file.Compression)); err != nil {
+			return err
+		}
+	}
+
+	if file.BudgetAction != "" {
+		if _, err := w.writer.WriteString(fmt.Sprintf(` budget="%s"`, file.BudgetAction)); err != nil {
+			return err
+		}
+	}
+
+	if file.Chunks > 0 {
+		if _, err := w.writer.WriteString(fmt.Sprintf(` chunk="%d" chunks="%d"`, file.Chunk, file.Chunks)); err != nil {
+			return err
+		}
+	}
+
+	if file.ChangeStatus != "" {
+		if _, err := w.writer.WriteString(fmt.Sprintf(` status="%s"`, file.ChangeStatus)); err != nil {
+			return err
+		}
+	}
+
+	if file.PreviousPath != "" {
+		if _, err := w.writer.WriteString(fmt.Sprintf(` previous_path="%s"`, escapeXML(file.PreviousPath))); err != nil {
+			return err
+		}
+	}
+
 	if _, err := w.writer.WriteString(">\n"); err != nil {
 		return err
 	}
 
 	// Write content
-	if w.opts.IncludeContent && file.Content != "" && file.IsText {
-		if w.opts.ShowLineNumbers {
-			numbered := addLineNumbers(file.Content)
-			if _, err := w.writer.WriteString(numbered); err != nil {
-				return err
-			}
-		} else {
-			escaped := escapeXML(file.Content)
-			if _, err := w.writer.WriteString(escaped); err != nil {
-				return err
-			}
+	if file.ChangeStatus == "deleted" {
+		if _, err := w.writer.WriteString("<!-- File deleted - no content -->"); err != nil {
+			return err
+		}
+	} else if file.BudgetAction == scanner.BudgetActionStructureOnly {
+		if _, err := w.writer.WriteString("<!-- Content omitted to fit the token budget -->"); err != nil {
+			return err
+		}
+	} else if w.opts.IncludeContent && file.Content != "" && file.IsText {
+		// CDATA keeps content readable; it needs no escaping
+		if _, err := w.writer.WriteString(cdata(renderContent(file.Content, w.opts))); err != nil {
+			return err
 		}
 	} else if !file.IsText {
 		if _, err := w.writer.WriteString("<!-- Binary file - content not included -->"); err != nil {
@@ -261,13 +321,71 @@ func (w *StreamingXMLWriter) WriteFooter(stats *scanner.StreamingStats) error {
 <total_size>%s</total_size>
 <text_files>%d</text_files>
 <binary_files>%d</binary_files>
-</scan_statistics>
 `, stats.TotalFiles, utils.FormatBytes(stats.TotalSize), stats.TextFiles, stats.BinaryFiles)
 
 	if _, err := w.writer.WriteString(statsXML); err != nil {
 		return err
 	}
 
+	if stats.Tokenizer != "" {
+		tokensXML := fmt.Sprintf("<total_tokens tokenizer=\"%s\">%d</total_tokens>\n", escapeXML(stats.Tokenizer), stats.TotalTokens)
+		if _, err := w.writer.WriteString(tokensXML); err != nil {
+			return err
+		}
+	}
+
+	if stats.DeletedFiles > 0 {
+		if _, err := w.writer.WriteString(fmt.Sprintf("<deleted_files>%d</deleted_files>\n", stats.DeletedFiles)); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.writer.WriteString("</scan_statistics>\n"); err != nil {
+		return err
+	}
+
+	// Token budget decisions, so readers know what's missing
+	if budget := stats.Budget; budget != nil {
+		budgetXML := fmt.Sprintf("\n<token_budget max_tokens=\"%d\" strategy=\"%s\" original_tokens=\"%d\" planned_tokens=\"%d\">\n",
+			budget.MaxTokens, budget.Strategy, budget.OriginalTokens, budget.PlannedTokens)
+		for _, d := range budget.Decisions {
+			budgetXML += fmt.Sprintf("<decision path=\"%s\" action=\"%s\" original_tokens=\"%d\" kept_tokens=\"%d\">%s</decision>\n",
+				escapeXML(d.Path), d.Action, d.OriginalTokens, d.KeptTokens, escapeXML(d.Reason))
+		}
+		budgetXML += "</token_budget>\n"
+
+		if _, err := w.writer.WriteString(budgetXML); err != nil {
+			return err
+		}
+	}
+
+	// Redacted secrets, so readers know why placeholders appear
+	if len(stats.Secrets) > 0 {
+		secretsXML := fmt.Sprintf("\n<redacted_secrets count=\"%d\">\n", len(stats.Secrets))
+		for _, s := range stats.Secrets {
+			secretsXML += fmt.Sprintf("<secret path=\"%s\" line=\"%d\" rule=\"%s\"/>\n", escapeXML(s.Path), s.Line, escapeXML(s.Rule))
+		}
+		secretsXML += "</redacted_secrets>\n"
+
+		if _, err := w.writer.WriteString(secretsXML); err != nil {
+			return err
+		}
+	}
+
+	// Scan errors, so readers know the pack is incomplete
+	if w.opts.IncludeErrors && len(stats.Errors) > 0 {
+		errorsXML := fmt.Sprintf("\n<errors count=\"%d\">\n", len(stats.Errors))
+		for _, e := range stats.Errors {
+			errorsXML += fmt.Sprintf("<error path=\"%s\" phase=\"%s\" skipped=\"%t\">%s</error>\n",
+				escapeXML(e.Path), escapeXML(e.Phase), e.Skipped, escapeXML(e.Error.Error()))
+		}
+		errorsXML += "</errors>\n"
+
+		if _, err := w.writer.WriteString(errorsXML); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -285,14 +403,3 @@ func escapeXML(s string) string {
 	s = strings.ReplaceAll(s, `'`, "&#39;")
 	return s
 }
-
-func addLineNumbers(content string) string {
-	lines := strings.Split(content, "\n")
-	var numberedLines []string
-
-	for i, line := range lines {
-		numberedLines = append(numberedLines, fmt.Sprintf("%4d: %s", i+1, line))
-	}
-
-	return strings.Join(numberedLines, "\n")
-}
@@ -0,0 +1,210 @@
+package output
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/opskraken/codeecho-cli/config"
+	"github.com/opskraken/codeecho-cli/scanner"
+	"github.com/opskraken/codeecho-cli/tokens"
+	"github.com/opskraken/codeecho-cli/utils"
+)
+
+// Blocks a --template file defines; only "file" is required
+const (
+	TemplateHeader = "header"
+	TemplateTree   = "tree"
+	TemplateFile   = "file"
+	TemplateFooter = "footer"
+)
+
+// Why a file's content is missing from TemplateFileData.Content
+const (
+	MissingDeleted     = "deleted"      // Deleted in the packed change set
+	MissingBudget      = "token-budget" // Dropped by --max-tokens
+	MissingBinary      = "binary"       // Binary files are never packed
+	MissingNotIncluded = "not-included" // --no-content, or an empty file
+)
+
+// TemplateHeaderData is the data of the "header" block
+type TemplateHeaderData struct {
+	RepoPath   string
+	ScanTime   string
+	Processing []string // Content processing applied, e.g. "comments removed"
+	Options    config.OutputOptions
+}
+
+// TemplateTreeData is the data of the "tree" block
+type TemplateTreeData struct {
+	Paths   []string
+	Tree    string      // Rendered as in the built-in formats
+	Nodes   []*TreeNode // Entries of the scan root
+	Options config.OutputOptions
+}
+
+// TemplateFileData is the data of the "file" block, once per file
+type TemplateFileData struct {
+	File    *scanner.FileInfo
+	Content string // After --line-numbers, --tab-width and --line-endings; empty when Missing is set
+	Missing string // Why there is no content, or ""
+	Options config.OutputOptions
+}
+
+// TemplateFooterData is the data of the "footer" block
+type TemplateFooterData struct {
+	Stats   *scanner.StreamingStats
+	Errors  []scanner.ScanError // Empty unless --include-errors
+	Options config.OutputOptions
+}
+
+// LoadTemplate parses a --template file. Token counts in the template use
+// counter, the tokenizer of the scan.
+func LoadTemplate(path string, counter tokens.Counter) (*template.Template, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+
+	tmpl, err := template.New(filepath.Base(path)).Funcs(templateFuncs(counter)).Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	if tmpl.Lookup(TemplateFile) == nil {
+		return nil, fmt.Errorf("template %s defines no %q block (use {{define %q}}...{{end}})", path, TemplateFile, TemplateFile)
+	}
+	return tmpl, nil
+}
+
+// templateFuncs are the helpers available to templates
+func templateFuncs(counter tokens.Counter) template.FuncMap {
+	return template.FuncMap{
+		"escape":      escapeXML,
+		"cdata":       cdata,
+		"json":        jsonString,
+		"fence":       codeFence,
+		"indent":      indentLines,
+		"lineNumbers": addLineNumbers,
+		"tokens":      counter.Count,
+		"formatBytes": utils.FormatBytes,
+		"lower":       strings.ToLower,
+		"join":        func(sep string, items []string) string { return strings.Join(items, sep) },
+	}
+}
+
+// indentLines prefixes every non-empty line of s with n spaces
+func indentLines(n int, s string) string {
+	prefix := strings.Repeat(" ", n)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// StreamingTemplateWriter renders the blocks of a user template, one
+// call at a time, so only the current file is held in memory
+type StreamingTemplateWriter struct {
+	writer *bufio.Writer
+	tmpl   *template.Template
+	opts   config.OutputOptions
+	stats  *scanner.StreamingStats
+}
+
+// NewStreamingTemplateWriter creates a writer for opts.Template
+func NewStreamingTemplateWriter(w io.Writer, opts config.OutputOptions) *StreamingTemplateWriter {
+	return &StreamingTemplateWriter{
+		writer: bufio.NewWriterSize(w, 65536),
+		tmpl:   opts.Template,
+		opts:   opts,
+		stats: &scanner.StreamingStats{
+			LanguageCounts: make(map[string]int),
+		},
+	}
+}
+
+// execute renders a block, skipping blocks the template doesn't define
+func (w *StreamingTemplateWriter) execute(block string, data interface{}) error {
+	if w.tmpl.Lookup(block) == nil {
+		return nil
+	}
+	// Execution errors already name the template, block and position
+	return w.tmpl.ExecuteTemplate(w.writer, block, data)
+}
+
+func (w *StreamingTemplateWriter) WriteHeader(repoPath string, scanTime string) error {
+	return w.execute(TemplateHeader, TemplateHeaderData{
+		RepoPath:   repoPath,
+		ScanTime:   scanTime,
+		Processing: processingOptions(w.opts),
+		Options:    w.opts,
+	})
+}
+
+func (w *StreamingTemplateWriter) WriteTree(paths []string) error {
+	if !w.opts.IncludeDirectoryTree || len(paths) == 0 {
+		return nil
+	}
+
+	// Convert paths to FileInfo structs (minimal data needed for tree)
+	fileInfos := make([]scanner.FileInfo, len(paths))
+	for i, path := range paths {
+		fileInfos[i] = scanner.FileInfo{RelativePath: path}
+	}
+
+	return w.execute(TemplateTree, TemplateTreeData{
+		Paths:   paths,
+		Tree:    GenerateDirectoryTree(fileInfos),
+		Nodes:   BuildDirectoryTree(paths),
+		Options: w.opts,
+	})
+}
+
+func (w *StreamingTemplateWriter) WriteFile(file *scanner.FileInfo) error {
+	// Update stats
+	w.stats.TotalFiles++
+	w.stats.TotalSize += file.Size
+
+	if file.IsText {
+		w.stats.TextFiles++
+	} else {
+		w.stats.BinaryFiles++
+	}
+
+	if file.Language != "" {
+		w.stats.LanguageCounts[file.Language]++
+	}
+
+	data := TemplateFileData{File: file, Options: w.opts}
+	switch {
+	case file.ChangeStatus == "deleted":
+		data.Missing = MissingDeleted
+	case file.BudgetAction == scanner.BudgetActionStructureOnly:
+		data.Missing = MissingBudget
+	case w.opts.IncludeContent && file.Content != "" && file.IsText:
+		data.Content = renderContent(file.Content, w.opts)
+	case !file.IsText:
+		data.Missing = MissingBinary
+	default:
+		data.Missing = MissingNotIncluded
+	}
+	return w.execute(TemplateFile, data)
+}
+
+func (w *StreamingTemplateWriter) WriteFooter(stats *scanner.StreamingStats) error {
+	data := TemplateFooterData{Stats: stats, Options: w.opts}
+	if w.opts.IncludeErrors {
+		data.Errors = stats.Errors
+	}
+	return w.execute(TemplateFooter, data)
+}
+
+func (w *StreamingTemplateWriter) Close() error {
+	return w.writer.Flush()
+}
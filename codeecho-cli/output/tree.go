@@ -53,3 +53,46 @@ func GenerateDirectoryTree(files []scanner.FileInfo) string {
 
 	return result.String()
 }
+
+// Kinds of TreeNode
+const (
+	TreeDirectory = "directory"
+	TreeFile      = "file"
+)
+
+// TreeNode is one entry of a nested directory tree
+type TreeNode struct {
+	Name     string      `json:"name"`
+	Path     string      `json:"path"` // Relative and slash-separated
+	Type     string      `json:"type"`
+	Children []*TreeNode `json:"children,omitempty"` // Directories only, in path order
+}
+
+// BuildDirectoryTree nests relative paths into the entries of the scan
+// root; directories are created on the way to their first file
+func BuildDirectoryTree(paths []string) []*TreeNode {
+	var roots []*TreeNode
+	dirs := make(map[string]*TreeNode)
+
+	for _, path := range paths {
+		parts := strings.Split(filepath.ToSlash(path), "/")
+		siblings := &roots
+
+		for i, name := range parts {
+			pathSoFar := strings.Join(parts[:i+1], "/")
+			if i == len(parts)-1 {
+				*siblings = append(*siblings, &TreeNode{Name: name, Path: pathSoFar, Type: TreeFile})
+				break
+			}
+
+			dir, ok := dirs[pathSoFar]
+			if !ok {
+				dir = &TreeNode{Name: name, Path: pathSoFar, Type: TreeDirectory}
+				dirs[pathSoFar] = dir
+				*siblings = append(*siblings, dir)
+			}
+			siblings = &dir.Children
+		}
+	}
+	return roots
+}
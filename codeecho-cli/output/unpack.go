@@ -0,0 +1,600 @@
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/opskraken/codeecho-cli/scanner"
+	"github.com/opskraken/codeecho-cli/utils"
+)
+
+// Pack is a pack parsed back from one of the StreamingWriter formats
+type Pack struct {
+	Name   string // File the pack was read from
+	Format string // "xml", "json", "jsonl" or "markdown"
+
+	// Processing is the pack-wide processing named in the header, e.g.
+	// "comments removed". Empty when none was applied, and for packs
+	// written before their format recorded it.
+	Processing string
+
+	Files   []scanner.FileInfo      // Only the fields the format records are set
+	Secrets []scanner.SecretFinding // Redacted secrets listed in the footer
+}
+
+// Reasons an unpacked file differs from the original, or wasn't written
+const (
+	UnpackCompressed    = "compressed"     // Function bodies elided by --compress signatures
+	UnpackTruncated     = "truncated"      // Middle cut by --max-tokens
+	UnpackRedacted      = "redacted"       // Secrets replaced with [REDACTED:rule]
+	UnpackStructureOnly = "structure-only" // Content dropped by --max-tokens; written empty
+	UnpackNoContent     = "no-content"     // Empty, or packed with --no-content; written empty
+	UnpackBinary        = "binary"         // Packs never hold binary content; not written
+	UnpackDeleted       = "deleted"        // Deleted in the packed change set; not written
+	UnpackMissingChunks = "missing-chunks" // Split across parts that weren't all given; not written
+)
+
+// UnpackEntry is one file to recreate from a set of packs
+type UnpackEntry struct {
+	Path    string // Clean, slash-separated and relative
+	Content string
+	Write   bool   // False when there is nothing to write
+	Issue   string // Why the result isn't the original file; empty when it is
+	Detail  string
+}
+
+// DetectPackFormat picks the pack format from the file extension, or
+// from the first bytes of the pack when the extension doesn't tell
+func DetectPackFormat(name string, head []byte) (string, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".xml":
+		return "xml", nil
+	case ".json":
+		return "json", nil
+	case ".jsonl":
+		return "jsonl", nil
+	case ".md", ".markdown":
+		return "markdown", nil
+	case ".html", ".htm":
+		return "", fmt.Errorf("%s is an HTML report, which can't be unpacked; pack with another format", name)
+	case ".sqlite", ".db":
+		return "", fmt.Errorf("%s is a SQLite pack, which can't be unpacked; query it with sqlite3 or pack with another format", name)
+	}
+
+	head = bytes.TrimLeft(head, " \t\r\n\ufeff")
+	switch {
+	case bytes.HasPrefix(head, []byte("<!DOCTYPE html")):
+		return "", fmt.Errorf("%s is an HTML report, which can't be unpacked; pack with another format", name)
+	case bytes.HasPrefix(head, []byte("SQLite format 3\x00")):
+		return "", fmt.Errorf("%s is a SQLite pack, which can't be unpacked; query it with sqlite3 or pack with another format", name)
+	case bytes.HasPrefix(head, []byte("<?xml")), bytes.HasPrefix(head, []byte("<")):
+		return "xml", nil
+	case bytes.HasPrefix(head, []byte(`{"type":`)):
+		return "jsonl", nil
+	case bytes.HasPrefix(head, []byte("{")):
+		return "json", nil
+	case bytes.HasPrefix(head, []byte("# CodeEcho")):
+		return "markdown", nil
+	}
+	return "", fmt.Errorf("can't tell the pack format of %s; use --format", name)
+}
+
+// ReadPack parses a pack written by the StreamingWriter for format
+func ReadPack(r io.Reader, name, format string) (*Pack, error) {
+	var pack *Pack
+	var err error
+
+	switch format {
+	case "xml":
+		pack, err = readXMLPack(r)
+	case "json":
+		pack, err = readJSONPack(r)
+	case "jsonl":
+		pack, err = readJSONLPack(r)
+	case "markdown", "md":
+		pack, err = readMarkdownPack(r)
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	pack.Name = name
+	for i := range pack.Files {
+		pack.Files[i].Content = RemoveLineNumbers(pack.Files[i].Content)
+	}
+	return pack, nil
+}
+
+var (
+	xmlAttrPattern     = regexp.MustCompile(`(\w+)="([^"]*)"`)
+	xmlOptionsPrefix   = "<!-- The content has been processed with the following options: "
+	xmlUnescapeReplace = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&quot;", `"`, "&#39;", "'", "&amp;", "&")
+)
+
+// UnescapeXML undoes escapeXML
+func UnescapeXML(s string) string {
+	return xmlUnescapeReplace.Replace(s)
+}
+
+// readXMLPack reads the <file> elements line by line rather than with
+// encoding/xml: older packs wrote line-numbered content unescaped, so a
+// pack isn't always well-formed XML. A line that is exactly </file> ends
+// every element, unless it is inside the element's CDATA section; only
+// the last line of a CDATA section ends with "]]>".
+func readXMLPack(r io.Reader) (*Pack, error) {
+	pack := &Pack{Format: "xml"}
+	reader := bufio.NewReaderSize(r, 65536)
+
+	var current *scanner.FileInfo
+	var body []string
+	inCDATA := false
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		eof := err == io.EOF
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case current != nil && !inCDATA && line == "</file>":
+			setXMLContent(current, body)
+			pack.Files = append(pack.Files, *current)
+			current, body = nil, nil
+		case current != nil:
+			if len(body) == 0 && strings.HasPrefix(line, cdataStart) {
+				inCDATA = true
+			}
+			body = append(body, line)
+			if inCDATA && strings.HasSuffix(line, cdataEnd) {
+				inCDATA = false
+			}
+		case strings.HasPrefix(line, `<file path="`) && strings.HasSuffix(line, ">"):
+			current = parseXMLFileTag(line)
+		case strings.HasPrefix(line, `<secret path="`):
+			pack.Secrets = append(pack.Secrets, parseXMLSecretTag(line))
+		case strings.HasPrefix(line, xmlOptionsPrefix):
+			options := strings.TrimSuffix(strings.TrimPrefix(line, xmlOptionsPrefix), " -->")
+			if options != "no processing applied" {
+				pack.Processing = options
+			}
+		}
+
+		if eof {
+			break
+		}
+	}
+
+	if current != nil {
+		return nil, fmt.Errorf("file element for %s is not closed", current.RelativePath)
+	}
+	return pack, nil
+}
+
+// parseXMLFileTag reads the attributes of a <file> opening tag
+func parseXMLFileTag(line string) *scanner.FileInfo {
+	file := &scanner.FileInfo{IsText: true}
+	for _, m := range xmlAttrPattern.FindAllStringSubmatch(line, -1) {
+		value := xmlUnescapeReplace.Replace(m[2])
+		switch m[1] {
+		case "path":
+			file.RelativePath = value
+		case "language":
+			file.Language = value
+		case "extension":
+			file.Extension = value
+		case "is_text":
+			file.IsText = value == "true"
+		case "hash":
+			file.Hash = value
+		case "compression":
+			file.Compression = value
+		case "budget":
+			file.BudgetAction = value
+		case "chunk":
+			file.Chunk, _ = strconv.Atoi(value)
+		case "chunks":
+			file.Chunks, _ = strconv.Atoi(value)
+		case "status":
+			file.ChangeStatus = value
+		case "previous_path":
+			file.PreviousPath = value
+		}
+	}
+	return file
+}
+
+// parseXMLSecretTag reads a <secret> element of the redacted secrets
+func parseXMLSecretTag(line string) scanner.SecretFinding {
+	var secret scanner.SecretFinding
+	for _, m := range xmlAttrPattern.FindAllStringSubmatch(line, -1) {
+		value := xmlUnescapeReplace.Replace(m[2])
+		switch m[1] {
+		case "path":
+			secret.Path = value
+		case "line":
+			secret.Line, _ = strconv.Atoi(value)
+		case "rule":
+			secret.Rule = value
+		}
+	}
+	return secret
+}
+
+// setXMLContent sets the content of a file element from its body lines.
+// A single comment line is a placeholder for missing content; content in
+// a CDATA section, escaped or numbered can't start with "<!--".
+func setXMLContent(file *scanner.FileInfo, body []string) {
+	if len(body) == 1 && strings.HasPrefix(body[0], "<!--") && strings.HasSuffix(body[0], "-->") {
+		return
+	}
+
+	content := strings.Join(body, "\n")
+	if unwrapped, ok := UnwrapCDATA(content); ok {
+		file.Content = unwrapped
+		return
+	}
+
+	// Packs written before CDATA sections
+	if !hasLineNumbers(content) {
+		// Numbered content is written as is; everything else is escaped
+		content = xmlUnescapeReplace.Replace(content)
+	}
+	file.Content = content
+}
+
+func readJSONPack(r io.Reader) (*Pack, error) {
+	var doc struct {
+		Options *jsonOptions            `json:"options"` // Missing in older packs
+		Files   []scanner.FileInfo      `json:"files"`
+		Secrets []scanner.SecretFinding `json:"redacted_secrets"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	pack := &Pack{Format: "json", Files: doc.Files, Secrets: doc.Secrets}
+	if doc.Options != nil {
+		pack.Processing = strings.Join(doc.Options.processing(), ", ")
+	}
+	return pack, nil
+}
+
+// readJSONLPack keeps the file records, the header's options and the
+// stats record's secrets, and skips the others, including record types
+// added after this reader
+func readJSONLPack(r io.Reader) (*Pack, error) {
+	pack := &Pack{Format: "jsonl"}
+	decoder := json.NewDecoder(r)
+	for record := 1; ; record++ {
+		var rec struct {
+			Type string `json:"type"`
+			scanner.FileInfo
+			Options *jsonOptions            `json:"options"`          // Header
+			Secrets []scanner.SecretFinding `json:"redacted_secrets"` // Stats
+		}
+		err := decoder.Decode(&rec)
+		if err == io.EOF {
+			return pack, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", record, err)
+		}
+
+		switch rec.Type {
+		case JSONLHeader:
+			if rec.Options != nil {
+				pack.Processing = strings.Join(rec.Options.processing(), ", ")
+			}
+		case JSONLFile:
+			pack.Files = append(pack.Files, rec.FileInfo)
+		case JSONLStats:
+			pack.Secrets = append(pack.Secrets, rec.Secrets...)
+		}
+	}
+}
+
+var (
+	// A file section starts with its heading and the metadata line
+	markdownFilePattern     = regexp.MustCompile(`(?m)^### (.*)\n\n(\*\*Size:\*\* .*)\n\n`)
+	markdownFileHeadPattern = regexp.MustCompile(`^### (.*)\n\n(\*\*Size:\*\* .*)\n\n`)
+	markdownSectionEnd      = "\n\n---\n\n"
+
+	markdownProcessingPattern = regexp.MustCompile(`(?m)^\*\*Processing:\*\* (.*)$`)
+	markdownSecretsHeading    = "\n## Redacted Secrets\n"
+)
+
+// readMarkdownPack walks the file sections in order. Fences are longer
+// than any backtick run in the content, but older packs always used three
+// backticks; a closing fence only counts when the next file section, the
+// footer or the end of the pack follows it.
+func readMarkdownPack(r io.Reader) (*Pack, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	text := string(data)
+	pack := &Pack{Format: "markdown"}
+
+	loc := markdownFilePattern.FindStringIndex(text)
+	header := text
+	if loc != nil {
+		header = text[:loc[0]]
+	}
+	if m := markdownProcessingPattern.FindStringSubmatch(header); m != nil && m[1] != "no processing applied" {
+		pack.Processing = m[1]
+	}
+	if loc == nil {
+		return pack, nil
+	}
+	rest := text[loc[0]:]
+
+	for {
+		m := markdownFileHeadPattern.FindStringSubmatch(rest)
+		if m == nil {
+			break
+		}
+		file := parseMarkdownMetadata(m[2])
+		file.RelativePath = m[1]
+		rest = rest[len(m[0]):]
+
+		if strings.HasPrefix(rest, "```") {
+			fence := rest[:len(rest)-len(strings.TrimLeft(rest, "`"))]
+			closing := "\n" + fence + markdownSectionEnd
+			start := strings.IndexByte(rest, '\n') + 1
+			if start == 0 {
+				return nil, fmt.Errorf("code block for %s is not closed", file.RelativePath)
+			}
+			end := markdownFenceEnd(rest, start, closing)
+			if end < 0 {
+				return nil, fmt.Errorf("code block for %s is not closed", file.RelativePath)
+			}
+			file.Content = rest[start:end]
+			rest = rest[end+len(closing):]
+		} else {
+			// A placeholder line such as *Binary file - content not displayed*
+			end := strings.Index(rest, markdownSectionEnd)
+			if end < 0 {
+				return nil, fmt.Errorf("section for %s is not closed", file.RelativePath)
+			}
+			rest = rest[end+len(markdownSectionEnd):]
+		}
+
+		pack.Files = append(pack.Files, *file)
+	}
+
+	// What follows the files is the footer, starting with a heading
+	footer := "\n" + rest
+	if i := strings.Index(footer, markdownSecretsHeading); i >= 0 {
+		pack.Secrets = parseMarkdownSecrets(footer[i+len(markdownSecretsHeading):])
+	}
+	return pack, nil
+}
+
+// parseMarkdownSecrets reads the "| File | Line | Rule |" table of the
+// redacted secrets section
+func parseMarkdownSecrets(section string) []scanner.SecretFinding {
+	var secrets []scanner.SecretFinding
+	inTable := false
+	for _, line := range strings.Split(section, "\n") {
+		if !strings.HasPrefix(line, "| ") {
+			if inTable {
+				break
+			}
+			continue
+		}
+		inTable = true
+
+		// Split from the right: the path may contain " | "
+		cells := strings.Split(strings.TrimSuffix(strings.TrimPrefix(line, "| "), " |"), " | ")
+		if len(cells) < 3 {
+			continue
+		}
+		n := len(cells)
+		lineNumber, err := strconv.Atoi(cells[n-2])
+		if err != nil {
+			continue // The heading or separator row
+		}
+		secrets = append(secrets, scanner.SecretFinding{
+			Path: strings.Join(cells[:n-2], " | "),
+			Line: lineNumber,
+			Rule: cells[n-1],
+		})
+	}
+	return secrets
+}
+
+// markdownFenceEnd finds closing, the fence that ends the code block
+// starting at start and the section after it, or returns -1
+func markdownFenceEnd(rest string, start int, closing string) int {
+	from := start
+	for {
+		i := strings.Index(rest[from:], closing)
+		if i < 0 {
+			return -1
+		}
+		end := from + i
+		next := rest[end+len(closing):]
+		if next == "" || strings.HasPrefix(next, "## ") || markdownFileHeadPattern.MatchString(next) {
+			return end
+		}
+		from = end + 1
+	}
+}
+
+// parseMarkdownMetadata reads a "**Key:** value | **Key:** value" line
+func parseMarkdownMetadata(line string) *scanner.FileInfo {
+	file := &scanner.FileInfo{IsText: true}
+	for _, field := range strings.Split(line, " | ") {
+		key, value, ok := strings.Cut(strings.TrimPrefix(field, "**"), ":** ")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Language":
+			file.Language = value
+		case "Extension":
+			file.Extension = value
+		case "Text File":
+			file.IsText = value == "true"
+		case "Hash":
+			file.Hash = value
+		case "Status":
+			file.ChangeStatus = value
+		case "Compression":
+			file.Compression, _, _ = strings.Cut(value, " ")
+		case "Budget":
+			file.BudgetAction = value
+		case "Chunk":
+			fmt.Sscanf(value, "%d of %d", &file.Chunk, &file.Chunks)
+		case "Previous Path":
+			file.PreviousPath = value
+		}
+	}
+	return file
+}
+
+// hasLineNumbers reports whether every line carries the prefix that
+// addLineNumbers gives it
+func hasLineNumbers(content string) bool {
+	if content == "" {
+		return false
+	}
+	for i, line := range strings.Split(content, "\n") {
+		if !strings.HasPrefix(line, fmt.Sprintf("%4d: ", i+1)) {
+			return false
+		}
+	}
+	return true
+}
+
+// RemoveLineNumbers undoes addLineNumbers, leaving content without
+// numbers untouched
+func RemoveLineNumbers(content string) string {
+	if !hasLineNumbers(content) {
+		return content
+	}
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, fmt.Sprintf("%4d: ", i+1))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// PlanUnpack decides what to write for every file in packs: chunks of a
+// file split across parts are joined, and files that can't be restored
+// faithfully are flagged. Any absolute path or ".." component fails the
+// whole plan, so nothing is written from a pack that tries to escape.
+func PlanUnpack(packs []*Pack) ([]UnpackEntry, error) {
+	var entries []UnpackEntry
+	index := make(map[string]int)
+	chunks := make(map[string][]scanner.FileInfo)
+
+	// Secrets are listed in the footer of the part that holds them
+	redacted := make(map[string]bool)
+	for _, pack := range packs {
+		for _, secret := range pack.Secrets {
+			if rel, err := utils.SafeRelativePath(secret.Path); err == nil {
+				redacted[rel] = true
+			}
+		}
+	}
+
+	for _, pack := range packs {
+		for _, file := range pack.Files {
+			rel, err := utils.SafeRelativePath(file.RelativePath)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", pack.Name, err)
+			}
+
+			if file.Chunks > 0 {
+				if _, ok := chunks[rel]; !ok {
+					index[rel] = len(entries)
+					entries = append(entries, UnpackEntry{Path: rel})
+				}
+				chunks[rel] = append(chunks[rel], file)
+				continue
+			}
+
+			entry := unpackEntry(rel, file, redacted[rel])
+			if i, ok := index[rel]; ok {
+				if entries[i] != entry {
+					return nil, fmt.Errorf("%s: %s is packed more than once with different content", pack.Name, rel)
+				}
+				continue
+			}
+			index[rel] = len(entries)
+			entries = append(entries, entry)
+		}
+	}
+
+	for rel, pieces := range chunks {
+		entries[index[rel]] = joinChunks(rel, pieces, redacted[rel])
+	}
+	return entries, nil
+}
+
+// joinChunks rebuilds a file split across parts. Chunks are cut from the
+// processed content, so concatenating them restores it.
+func joinChunks(rel string, pieces []scanner.FileInfo, redacted bool) UnpackEntry {
+	sort.Slice(pieces, func(i, j int) bool { return pieces[i].Chunk < pieces[j].Chunk })
+
+	total := pieces[0].Chunks
+	var content strings.Builder
+	found := 0
+	for i, piece := range pieces {
+		if i > 0 && piece.Chunk == pieces[i-1].Chunk {
+			continue
+		}
+		found++
+		content.WriteString(piece.Content)
+	}
+	if found != total {
+		return UnpackEntry{
+			Path:   rel,
+			Issue:  UnpackMissingChunks,
+			Detail: fmt.Sprintf("%d of %d chunks found; pass every part", found, total),
+		}
+	}
+
+	file := pieces[0]
+	file.Content = content.String()
+	file.Chunk, file.Chunks = 0, 0
+	return unpackEntry(rel, file, redacted)
+}
+
+// unpackEntry decides what to write for a single packed file. Redacted
+// comes from the pack's list of secrets; content that merely mentions a
+// placeholder is restored as is.
+func unpackEntry(rel string, file scanner.FileInfo, redacted bool) UnpackEntry {
+	entry := UnpackEntry{Path: rel, Content: file.Content, Write: true}
+
+	switch {
+	case file.ChangeStatus == "deleted":
+		entry.Write, entry.Issue = false, UnpackDeleted
+	case !file.IsText:
+		entry.Write, entry.Issue = false, UnpackBinary
+	case file.BudgetAction == scanner.BudgetActionStructureOnly:
+		entry.Issue, entry.Detail = UnpackStructureOnly, "content omitted to fit the token budget"
+	case file.BudgetAction == scanner.BudgetActionTruncated:
+		entry.Issue, entry.Detail = UnpackTruncated, "middle of the file cut to fit the token budget"
+	case file.Compression != "":
+		entry.Issue, entry.Detail = UnpackCompressed, file.Compression
+	case redacted:
+		entry.Issue, entry.Detail = UnpackRedacted, "secrets replaced with placeholders"
+	case file.Content == "":
+		entry.Issue, entry.Detail = UnpackNoContent, "packed without content, or empty"
+	}
+	return entry
+}
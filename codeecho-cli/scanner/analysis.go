@@ -84,14 +84,15 @@ func (a *AnalysisScanner) Scan() (*ScanResult, error) {
 	// First pass: Count total files
 	a.reportProgress("counting", "calculating total files...", 0, 0)
 	totalFiles := 0
+	countFilter := newPathFilter(a.rootPath, a.opts)
 	filepath.WalkDir(a.rootPath, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return nil
 		}
-		if !d.IsDir() && shouldIncludeFile(path, a.opts.IncludeExts) {
-			if d.IsDir() && shouldExcludeDir(d.Name(), a.opts.ExcludeDirs) {
-				return filepath.SkipDir
-			}
+		if d.IsDir() && countFilter.skipDir(path, d) {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && countFilter.includeFile(path) {
 			totalFiles++
 		}
 		return nil
@@ -99,19 +100,20 @@ func (a *AnalysisScanner) Scan() (*ScanResult, error) {
 
 	// Second pass: Process files
 	processedFiles := 0
+	filter := newPathFilter(a.rootPath, a.opts)
 	err := filepath.WalkDir(a.rootPath, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			a.recordError(path, "scan", err)
 			return nil // Continue
 		}
 
-		// Skip excluded directories
-		if d.IsDir() && shouldExcludeDir(d.Name(), a.opts.ExcludeDirs) {
+		// Skip excluded and ignored directories
+		if d.IsDir() && filter.skipDir(path, d) {
 			return filepath.SkipDir
 		}
 
 		// Process files only
-		if !d.IsDir() && shouldIncludeFile(path, a.opts.IncludeExts) {
+		if !d.IsDir() && filter.includeFile(path) {
 			relativePath := utils.GetRelativePath(a.rootPath, path)
 			a.reportProgress("scanning", relativePath, processedFiles, totalFiles)
 
@@ -150,15 +152,14 @@ func (a *AnalysisScanner) Scan() (*ScanResult, error) {
 						fileInfo.IsText = true
 					}
 
-					processedContent := processFileContent(string(content), fileInfo.Language, a.opts)
-					fileInfo.Content = processedContent
-					fileInfo.LineCount = utils.CountLines(processedContent)
+					processFileContent(&fileInfo, string(content), a.opts)
 				}
 			}
 
 			result.Files = append(result.Files, fileInfo)
 			result.TotalFiles++
 			result.TotalSize += info.Size()
+			result.TotalTokens += fileInfo.TokenCount
 
 			if fileInfo.IsText {
 				result.TextFiles++
@@ -0,0 +1,547 @@
+package scanner
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// BudgetStrategy decides how a pack is brought under --max-tokens
+type BudgetStrategy string
+
+const (
+	BudgetDrop      BudgetStrategy = "drop"      // Leave out the lowest-priority files
+	BudgetTruncate  BudgetStrategy = "truncate"  // Keep the head and tail of large files
+	BudgetStructure BudgetStrategy = "structure" // Keep overflow files as metadata only
+)
+
+// Budget actions recorded on FileInfo.BudgetAction and in the report
+const (
+	BudgetActionOmitted       = "omitted"
+	BudgetActionTruncated     = "truncated"
+	BudgetActionStructureOnly = "structure-only"
+)
+
+// minTruncatedTokens is the smallest a file is truncated to before the
+// truncate strategy gives up on it and drops it instead
+const minTruncatedTokens = 200
+
+// truncationMarkerTokens is allowed for the line marking where a
+// truncated file was cut, on top of its kept content
+const truncationMarkerTokens = 20
+
+// ParseBudgetStrategy validates a --budget-strategy value
+func ParseBudgetStrategy(s string) (BudgetStrategy, error) {
+	switch strategy := BudgetStrategy(strings.ToLower(s)); strategy {
+	case BudgetDrop, BudgetTruncate, BudgetStructure:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("unknown budget strategy %q (supported: drop, truncate, structure)", s)
+}
+
+// BudgetDecision records what happened to one file and why
+type BudgetDecision struct {
+	Path           string `json:"path"`
+	Action         string `json:"action"`
+	Reason         string `json:"reason"`
+	OriginalTokens int    `json:"original_tokens"`
+	KeptTokens     int    `json:"kept_tokens"`
+}
+
+// BudgetReport is rendered in the footer of every output format
+type BudgetReport struct {
+	MaxTokens      int              `json:"max_tokens"`
+	Strategy       BudgetStrategy   `json:"strategy"`
+	OriginalTokens int              `json:"original_tokens"` // Pack tokens before trimming
+	PlannedTokens  int              `json:"planned_tokens"`  // Pack tokens after trimming
+	Decisions      []BudgetDecision `json:"decisions"`
+}
+
+// OverBudget reports whether the untrimmed pack exceeds the budget
+func (r *BudgetReport) OverBudget() bool {
+	return r.OriginalTokens > r.MaxTokens
+}
+
+// PackMeter measures a pack in tokens as its format renders it
+type PackMeter interface {
+	// FileTokens returns the tokens of a file's entry, what its content
+	// adds to that, and the tokens of the entry as written when only its
+	// structure is kept
+	FileTokens(file *FileInfo) (total, content, structure int, err error)
+
+	// FixedTokens returns the tokens of everything but the file entries:
+	// the header, the directory tree of paths and the footer for stats
+	FixedTokens(paths []string, stats *StreamingStats) (int, error)
+}
+
+// budgetFile is what the planner remembers about each file (no content)
+type budgetFile struct {
+	path      string
+	tokens    int // Content tokens
+	cost      int // Tokens of the rendered entry
+	content   int // What the content adds to cost
+	structure int // Tokens of the entry kept as structure
+	priority  int
+
+	size     int64
+	isText   bool
+	language string
+}
+
+// scaled converts content tokens to what they cost rendered
+func (f budgetFile) scaled(tokens int) int {
+	if f.tokens == 0 {
+		return 0
+	}
+	return (f.content*tokens + f.tokens - 1) / f.tokens
+}
+
+// keptCost is what the file's entry costs truncated to keptTokens
+func (f budgetFile) keptCost(keptTokens int) int {
+	if f.tokens == 0 {
+		return f.cost
+	}
+	return f.cost - f.content + truncationMarkerTokens + f.scaled(keptTokens)
+}
+
+// BudgetPlanner collects token counts during a first pass and decides
+// which files to keep. Use Observe as the file handler of that pass.
+type BudgetPlanner struct {
+	maxTokens int
+	strategy  BudgetStrategy
+	meter     PackMeter // nil counts file contents only
+	files     []budgetFile
+	deleted   []budgetFile // Listed whatever the budget
+}
+
+// NewBudgetPlanner plans a budget of maxTokens for the pack meter
+// measures. Without a meter only file contents are counted.
+func NewBudgetPlanner(maxTokens int, strategy BudgetStrategy, meter PackMeter) *BudgetPlanner {
+	return &BudgetPlanner{maxTokens: maxTokens, strategy: strategy, meter: meter}
+}
+
+// Observe records what a file costs; content is not retained
+func (p *BudgetPlanner) Observe(file *FileInfo) error {
+	f := budgetFile{
+		path:     file.RelativePath,
+		tokens:   file.TokenCount,
+		cost:     file.TokenCount,
+		content:  file.TokenCount,
+		priority: filePriority(file.RelativePath),
+		size:     file.Size,
+		isText:   file.IsText,
+		language: file.Language,
+	}
+	if p.meter != nil {
+		var err error
+		if f.cost, f.content, f.structure, err = p.meter.FileTokens(file); err != nil {
+			return err
+		}
+	}
+
+	if file.ChangeStatus == "deleted" {
+		p.deleted = append(p.deleted, f)
+		return nil
+	}
+	p.files = append(p.files, f)
+	return nil
+}
+
+// maxPlanRounds bounds how often a plan is redone with less room
+const maxPlanRounds = 8
+
+// Plan decides what to omit, truncate or reduce to structure. Trimming
+// lists files in the footer, which costs tokens too, so the plan is
+// redone with less room until the whole pack fits.
+func (p *BudgetPlanner) Plan() (*BudgetPlan, error) {
+	report := &BudgetReport{
+		MaxTokens: p.maxTokens,
+		Strategy:  p.strategy,
+	}
+	plan := &BudgetPlan{Report: report, decisions: make(map[string]BudgetDecision)}
+
+	original, err := p.packTokens(plan)
+	if err != nil {
+		return nil, err
+	}
+	report.OriginalTokens = original
+	report.PlannedTokens = original
+	if !report.OverBudget() {
+		return plan, nil
+	}
+
+	// Room for file entries, after the header, tree and footer
+	room := p.maxTokens - original
+	for _, f := range p.files {
+		room += f.cost
+	}
+
+	for round := 0; round < maxPlanRounds; round++ {
+		report.Decisions = nil
+		plan.decisions = make(map[string]BudgetDecision)
+
+		var used int
+		switch p.strategy {
+		case BudgetTruncate:
+			used = p.planTruncate(plan, room)
+		default:
+			used = p.planKeep(plan, room)
+		}
+
+		planned, err := p.packTokens(plan)
+		if err != nil {
+			return nil, err
+		}
+		report.PlannedTokens = planned
+		if planned <= p.maxTokens || used <= 0 {
+			break
+		}
+		room = used - max(planned-p.maxTokens, 1)
+	}
+
+	plan.meter = p.meter
+	plan.estimated = make(map[string]budgetFile)
+	for _, f := range p.files {
+		if d, ok := plan.decisions[f.path]; ok && d.Action == BudgetActionTruncated {
+			plan.estimated[f.path] = f
+		}
+	}
+
+	sort.Slice(report.Decisions, func(i, j int) bool {
+		return report.Decisions[i].Path < report.Decisions[j].Path
+	})
+	return plan, nil
+}
+
+// packTokens measures the pack the plan leaves
+func (p *BudgetPlanner) packTokens(plan *BudgetPlan) (int, error) {
+	stats := &StreamingStats{
+		LanguageCounts: make(map[string]int),
+		DeletedFiles:   len(p.deleted),
+		Budget:         plan.Report,
+	}
+	var paths []string
+	total := 0
+
+	for _, f := range p.deleted {
+		total += f.cost
+	}
+	for _, f := range p.files {
+		cost, tokens := f.cost, f.tokens
+		if d, ok := plan.decisions[f.path]; ok {
+			switch d.Action {
+			case BudgetActionOmitted:
+				continue
+			case BudgetActionStructureOnly:
+				cost, tokens = f.structure, 0
+			case BudgetActionTruncated:
+				cost, tokens = f.keptCost(d.KeptTokens), d.KeptTokens
+			}
+		}
+
+		total += cost
+		paths = append(paths, f.path)
+		stats.TotalFiles++
+		stats.TotalSize += f.size
+		stats.TotalTokens += tokens
+		if f.isText {
+			stats.TextFiles++
+		} else {
+			stats.BinaryFiles++
+		}
+		if f.language != "" {
+			stats.LanguageCounts[f.language]++
+		}
+	}
+
+	if p.meter == nil {
+		return total, nil
+	}
+	fixed, err := p.meter.FixedTokens(paths, stats)
+	if err != nil {
+		return 0, err
+	}
+	return total + fixed, nil
+}
+
+// planKeep fills room greedily, highest priority and smallest files
+// first. Whatever doesn't fit is omitted or kept as structure, whose
+// entries stay in the pack without their content. It returns the room
+// the kept entries take.
+func (p *BudgetPlanner) planKeep(plan *BudgetPlan, room int) int {
+	files := append([]budgetFile(nil), p.files...)
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].priority != files[j].priority {
+			return files[i].priority > files[j].priority
+		}
+		return files[i].cost < files[j].cost
+	})
+
+	action := BudgetActionOmitted
+	used := 0
+	if p.strategy == BudgetStructure {
+		action = BudgetActionStructureOnly
+		for _, f := range files {
+			used += f.structure
+		}
+	}
+
+	for _, f := range files {
+		cost := f.cost
+		if action == BudgetActionStructureOnly {
+			cost = f.cost - f.structure
+		}
+		if used+cost <= room {
+			used += cost
+			continue
+		}
+		plan.add(BudgetDecision{
+			Path:           f.path,
+			Action:         action,
+			Reason:         fmt.Sprintf("%s priority; %d tokens did not fit in the remaining %d", priorityName(f.priority), cost, max(room-used, 0)),
+			OriginalTokens: f.tokens,
+		})
+	}
+	return used
+}
+
+// planTruncate trims the lowest-priority, largest files first, down to
+// minTruncatedTokens each, and drops files only when that isn't enough.
+// It returns the room the remaining entries take.
+func (p *BudgetPlanner) planTruncate(plan *BudgetPlan, room int) int {
+	files := append([]budgetFile(nil), p.files...)
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].priority != files[j].priority {
+			return files[i].priority < files[j].priority
+		}
+		return files[i].cost > files[j].cost
+	})
+
+	excess := -room
+	for _, f := range files {
+		excess += f.cost
+	}
+
+	for _, f := range files {
+		if excess <= 0 {
+			return room + excess
+		}
+		if f.tokens <= minTruncatedTokens {
+			continue
+		}
+
+		// Content tokens to cut, scaled from the rendered cost
+		cut := (excess*f.tokens + f.content - 1) / max(f.content, 1)
+		target := max(f.tokens-cut, minTruncatedTokens)
+		excess -= f.cost - f.keptCost(target)
+		plan.add(BudgetDecision{
+			Path:           f.path,
+			Action:         BudgetActionTruncated,
+			Reason:         fmt.Sprintf("%s priority; truncated to head and tail to fit the budget", priorityName(f.priority)),
+			OriginalTokens: f.tokens,
+			KeptTokens:     target,
+		})
+	}
+
+	// Truncation alone wasn't enough: drop files in the same order
+	for _, f := range files {
+		if excess <= 0 {
+			return room + excess
+		}
+		kept := f.cost
+		if d, ok := plan.decisions[f.path]; ok {
+			if d.Action == BudgetActionOmitted {
+				continue
+			}
+			kept = f.keptCost(d.KeptTokens)
+		}
+		excess -= kept
+		plan.add(BudgetDecision{
+			Path:           f.path,
+			Action:         BudgetActionOmitted,
+			Reason:         fmt.Sprintf("%s priority; budget exhausted even after truncating large files", priorityName(f.priority)),
+			OriginalTokens: f.tokens,
+		})
+	}
+	return room + excess
+}
+
+// BudgetPlan is applied by the scanners during the writing pass
+type BudgetPlan struct {
+	Report    *BudgetReport
+	decisions map[string]BudgetDecision
+	estimated map[string]budgetFile // Truncated files, until settled
+	meter     PackMeter
+}
+
+func (p *BudgetPlan) add(d BudgetDecision) {
+	if _, exists := p.decisions[d.Path]; exists {
+		for i := range p.Report.Decisions {
+			if p.Report.Decisions[i].Path == d.Path {
+				p.Report.Decisions[i] = d
+			}
+		}
+	} else {
+		p.Report.Decisions = append(p.Report.Decisions, d)
+	}
+	p.decisions[d.Path] = d
+}
+
+// settle corrects the report once a truncated file was written. The
+// plan could only estimate what truncating to whole lines keeps.
+func (p *BudgetPlan) settle(file *FileInfo) error {
+	if p == nil || file.BudgetAction != BudgetActionTruncated {
+		return nil
+	}
+	f, ok := p.estimated[file.RelativePath]
+	if !ok {
+		return nil
+	}
+	delete(p.estimated, file.RelativePath)
+
+	written := file.TokenCount
+	if p.meter != nil {
+		var err error
+		if written, _, _, err = p.meter.FileTokens(file); err != nil {
+			return err
+		}
+	}
+
+	for i := range p.Report.Decisions {
+		d := &p.Report.Decisions[i]
+		if d.Path == file.RelativePath {
+			p.Report.PlannedTokens -= f.keptCost(d.KeptTokens) - written
+			d.KeptTokens = file.TokenCount
+		}
+	}
+	return nil
+}
+
+// omits reports whether a file is left out of the pack entirely
+func (p *BudgetPlan) omits(relativePath string) bool {
+	if p == nil {
+		return false
+	}
+	d, ok := p.decisions[relativePath]
+	return ok && d.Action == BudgetActionOmitted
+}
+
+// decision returns what the plan does to a file, if anything
+func (p *BudgetPlan) decision(relativePath string) (BudgetDecision, bool) {
+	if p == nil {
+		return BudgetDecision{}, false
+	}
+	d, ok := p.decisions[relativePath]
+	return d, ok
+}
+
+// apply trims a processed file according to the plan.
+// It returns false when the file must be left out.
+func (p *BudgetPlan) apply(file *FileInfo, opts ScanOptions) bool {
+	if p == nil {
+		return true
+	}
+	d, ok := p.decisions[file.RelativePath]
+	if !ok {
+		return true
+	}
+
+	switch d.Action {
+	case BudgetActionOmitted:
+		return false
+	case BudgetActionStructureOnly:
+		file.Content = ""
+		file.LineCount = 0
+		file.TokenCount = 0
+	case BudgetActionTruncated:
+		file.Content = truncateContent(file.Content, d.KeptTokens, opts)
+		file.TokenCount = countTokens(file.Content, opts)
+	}
+	file.BudgetAction = d.Action
+	return true
+}
+
+// truncateContent keeps as many head and tail lines as fit in maxTokens,
+// with a marker line where the middle was cut
+func truncateContent(content string, maxTokens int, opts ScanOptions) string {
+	if countTokens(content, opts) <= maxTokens {
+		return content
+	}
+
+	lines := strings.Split(content, "\n")
+	build := func(keep int) string {
+		head := (keep + 1) / 2
+		tail := keep - head
+		marker := fmt.Sprintf("... [%d lines truncated by CodeEcho to fit the token budget] ...", len(lines)-keep)
+
+		parts := make([]string, 0, keep+1)
+		parts = append(parts, lines[:head]...)
+		parts = append(parts, marker)
+		parts = append(parts, lines[len(lines)-tail:]...)
+		return strings.Join(parts, "\n")
+	}
+
+	// Largest number of kept lines that still fits
+	lo, hi := 0, len(lines)-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if countTokens(build(mid), opts) <= maxTokens {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return build(lo)
+}
+
+// File priorities, lowest is dropped first
+const (
+	priorityGenerated = iota
+	priorityFixture
+	priorityTest
+	priorityDocs
+	prioritySource
+	priorityEntrypoint
+)
+
+func priorityName(priority int) string {
+	return [...]string{"generated/lock file", "fixture", "test", "docs/config", "source", "entrypoint"}[priority]
+}
+
+// filePriority ranks how useful a file is to a model reading the pack
+func filePriority(relativePath string) int {
+	slashPath := strings.ToLower(filepath.ToSlash(relativePath))
+	name := filepath.Base(slashPath)
+	ext := filepath.Ext(name)
+
+	switch name {
+	case "readme.md", "main.go", "go.mod", "package.json", "cargo.toml", "pyproject.toml", "index.js", "index.ts":
+		return priorityEntrypoint
+	case "go.sum", "package-lock.json", "yarn.lock", "pnpm-lock.yaml", "cargo.lock", "poetry.lock", "composer.lock":
+		return priorityGenerated
+	}
+
+	if strings.Contains(name, ".min.") || strings.HasSuffix(name, ".lock") ||
+		strings.HasSuffix(name, ".pb.go") || strings.Contains(name, "_generated.") {
+		return priorityGenerated
+	}
+
+	for _, dir := range []string{"testdata/", "fixtures/", "__fixtures__/", "__snapshots__/"} {
+		if strings.HasPrefix(slashPath, dir) || strings.Contains(slashPath, "/"+dir) {
+			return priorityFixture
+		}
+	}
+
+	if strings.HasSuffix(name, "_test.go") || strings.Contains(name, ".test.") || strings.Contains(name, ".spec.") ||
+		strings.HasPrefix(name, "test_") || strings.HasPrefix(slashPath, "test/") || strings.HasPrefix(slashPath, "tests/") ||
+		strings.Contains(slashPath, "/test/") || strings.Contains(slashPath, "/tests/") {
+		return priorityTest
+	}
+
+	switch ext {
+	case ".md", ".txt", ".rst", ".json", ".yml", ".yaml", ".toml", ".xml", ".ini", ".cfg":
+		return priorityDocs
+	}
+	return prioritySource
+}
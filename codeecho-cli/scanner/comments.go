@@ -0,0 +1,1081 @@
+package scanner
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Comment removal works on a small per-language lexer rather than regexes:
+// it skips string literals (raw strings, template literals, heredocs, ...)
+// so only real comments are removed, and it tells doc comments apart from
+// implementation comments so --keep-doc-comments can leave them in place.
+
+// blockComment delimits a block comment
+type blockComment struct {
+	open, close string
+	nested      bool // Block comments nest (Rust, Swift, Haskell, ...)
+	lineStart   bool // Delimiters only count at the start of a line (Ruby =begin/=end)
+}
+
+// quoteStyle delimits a string literal
+type quoteStyle struct {
+	open, close string
+	escape      bool // Backslash escapes the next character
+	doubled     bool // A doubled close delimiter stays in the string ('' in SQL)
+	multiline   bool // The literal may span lines
+}
+
+// lexFeature enables syntax that doesn't fit the tables
+type lexFeature uint
+
+const (
+	lexTemplates        lexFeature = 1 << iota // JS template literals with ${...}
+	lexRegex                                   // JS regular expression literals
+	lexRustRaw                                 // Rust raw strings, char literals and lifetimes
+	lexCppRaw                                  // C++ raw strings R"delim(...)delim"
+	lexLuaLong                                 // Lua long brackets [[...]] and --[[...]]
+	lexDollarQuotes                            // PostgreSQL $tag$...$tag$ strings
+	lexYAMLBlocks                              // YAML block scalars (| and >)
+	lexQuoteAtWordStart                        // Quotes only open a string at the start of a scalar (YAML)
+	lexWordStart                               // Line comments must start a word (shell "#")
+	lexLineStart                               // Line comments only at the start of a line (Dockerfile, INI)
+	lexHeredocSpace                            // Heredoc openers may be followed by spaces (shell)
+	lexGoDoc                                   // godoc comments, compiler directives and cgo preambles
+	lexDocstrings                              // Python docstrings
+)
+
+// commentStyle is the lexical syntax of a language as far as comments go
+type commentStyle struct {
+	line     []string       // Line comment markers
+	lineNot  []string       // Look like line comments but aren't (PHP "#[")
+	block    []blockComment // Block comment delimiters
+	quotes   []quoteStyle   // String literals, longest opener first
+	heredoc  string         // Heredoc opener ("<<" or "<<<")
+	docLine  []string       // Line comment prefixes that mark doc comments
+	docBlock []string       // Block comment openers that mark doc comments
+	features lexFeature
+}
+
+var (
+	slashComments = []string{"//"}
+	cBlock        = []blockComment{{open: "/*", close: "*/"}}
+	nestedCBlock  = []blockComment{{open: "/*", close: "*/", nested: true}}
+	cQuotes       = []quoteStyle{{open: `"`, close: `"`, escape: true}, {open: "'", close: "'", escape: true}}
+	javadoc       = []string{"/**"}
+
+	jsStyle = &commentStyle{line: slashComments, block: cBlock, quotes: cQuotes, docBlock: javadoc, features: lexTemplates | lexRegex}
+	cStyle  = &commentStyle{line: slashComments, block: cBlock, quotes: cQuotes, docLine: []string{"///", "//!"}, docBlock: []string{"/**", "/*!"}}
+	shStyle = &commentStyle{
+		line:     []string{"#"},
+		quotes:   []quoteStyle{{open: `"`, close: `"`, escape: true, multiline: true}, {open: "'", close: "'", multiline: true}},
+		heredoc:  "<<",
+		features: lexWordStart | lexHeredocSpace,
+	}
+	htmlStyle = &commentStyle{block: []blockComment{{open: "<!--", close: "-->"}}}
+	cssStyle  = &commentStyle{block: cBlock, quotes: cQuotes}
+	lessStyle = &commentStyle{line: slashComments, block: cBlock, quotes: cQuotes, features: lexWordStart}
+)
+
+// commentStyles maps detected languages to their comment syntax
+var commentStyles = map[string]*commentStyle{
+	"go": {
+		line:  slashComments,
+		block: cBlock,
+		quotes: []quoteStyle{
+			{open: "`", close: "`", multiline: true},
+			{open: `"`, close: `"`, escape: true},
+			{open: "'", close: "'", escape: true},
+		},
+		features: lexGoDoc,
+	},
+	"javascript": jsStyle,
+	"typescript": jsStyle,
+	"jsx":        jsStyle,
+	"tsx":        jsStyle,
+	"java": {
+		line:     slashComments,
+		block:    cBlock,
+		quotes:   append([]quoteStyle{{open: `"""`, close: `"""`, escape: true, multiline: true}}, cQuotes...),
+		docBlock: javadoc,
+	},
+	"c": cStyle,
+	"cpp": {
+		line: slashComments, block: cBlock, quotes: cQuotes,
+		docLine: cStyle.docLine, docBlock: cStyle.docBlock, features: lexCppRaw,
+	},
+	"csharp": {
+		line:  slashComments,
+		block: cBlock,
+		quotes: append([]quoteStyle{
+			{open: `"""`, close: `"""`, multiline: true},
+			{open: `@"`, close: `"`, doubled: true, multiline: true},
+		}, cQuotes...),
+		docLine:  []string{"///"},
+		docBlock: javadoc,
+	},
+	"rust": {
+		line:     slashComments,
+		block:    nestedCBlock,
+		quotes:   []quoteStyle{{open: `"`, close: `"`, escape: true, multiline: true}},
+		docLine:  []string{"///", "//!"},
+		docBlock: []string{"/**", "/*!"},
+		features: lexRustRaw,
+	},
+	"swift": {
+		line:     slashComments,
+		block:    nestedCBlock,
+		quotes:   []quoteStyle{{open: `"""`, close: `"""`, escape: true, multiline: true}, {open: `"`, close: `"`, escape: true}},
+		docLine:  []string{"///"},
+		docBlock: javadoc,
+	},
+	"kotlin": {
+		line:     slashComments,
+		block:    nestedCBlock,
+		quotes:   append([]quoteStyle{{open: `"""`, close: `"""`, multiline: true}}, cQuotes...),
+		docBlock: javadoc,
+	},
+	"scala": {
+		line:     slashComments,
+		block:    nestedCBlock,
+		quotes:   append([]quoteStyle{{open: `"""`, close: `"""`, multiline: true}}, cQuotes...),
+		docBlock: javadoc,
+	},
+	"groovy": {
+		line:  slashComments,
+		block: cBlock,
+		quotes: append([]quoteStyle{
+			{open: `"""`, close: `"""`, escape: true, multiline: true},
+			{open: `'''`, close: `'''`, escape: true, multiline: true},
+		}, cQuotes...),
+		docBlock: javadoc,
+	},
+	"dart": {
+		line:  slashComments,
+		block: nestedCBlock,
+		quotes: append([]quoteStyle{
+			{open: `"""`, close: `"""`, escape: true, multiline: true},
+			{open: `'''`, close: `'''`, escape: true, multiline: true},
+		}, cQuotes...),
+		docLine:  []string{"///"},
+		docBlock: javadoc,
+	},
+	"zig": {
+		line:    slashComments,
+		quotes:  cQuotes,
+		docLine: []string{"///", "//!"},
+	},
+	"protobuf": {line: slashComments, block: cBlock, quotes: cQuotes},
+	"php": {
+		line:     []string{"//", "#"},
+		lineNot:  []string{"#["},
+		block:    cBlock,
+		quotes:   []quoteStyle{{open: `"`, close: `"`, escape: true, multiline: true}, {open: "'", close: "'", escape: true, multiline: true}},
+		heredoc:  "<<<",
+		docBlock: javadoc,
+	},
+	"python": {
+		line: []string{"#"},
+		quotes: []quoteStyle{
+			{open: `"""`, close: `"""`, escape: true, multiline: true},
+			{open: `'''`, close: `'''`, escape: true, multiline: true},
+			{open: `"`, close: `"`, escape: true},
+			{open: "'", close: "'", escape: true},
+		},
+		features: lexDocstrings,
+	},
+	"ruby": {
+		line:    []string{"#"},
+		block:   []blockComment{{open: "=begin", close: "=end", lineStart: true}},
+		quotes:  []quoteStyle{{open: `"`, close: `"`, escape: true, multiline: true}, {open: "'", close: "'", escape: true, multiline: true}},
+		heredoc: "<<",
+	},
+	"perl": {
+		line: []string{"#"},
+		block: []blockComment{
+			{open: "=pod", close: "=cut", lineStart: true},
+			{open: "=head1", close: "=cut", lineStart: true},
+			{open: "=head2", close: "=cut", lineStart: true},
+			{open: "=over", close: "=cut", lineStart: true},
+			{open: "=begin", close: "=cut", lineStart: true},
+		},
+		quotes:   []quoteStyle{{open: `"`, close: `"`, escape: true, multiline: true}, {open: "'", close: "'", escape: true, multiline: true}},
+		heredoc:  "<<",
+		docBlock: []string{"="},
+		features: lexWordStart,
+	},
+	"shell": shStyle,
+	"bash":  shStyle,
+	"powershell": {
+		line:  []string{"#"},
+		block: []blockComment{{open: "<#", close: "#>"}},
+		quotes: []quoteStyle{
+			{open: `@"`, close: `"@`, multiline: true},
+			{open: `@'`, close: `'@`, multiline: true},
+			{open: `"`, close: `"`, doubled: true, multiline: true},
+			{open: "'", close: "'", doubled: true, multiline: true},
+		},
+	},
+	"sql": {
+		line:  []string{"--"},
+		block: cBlock,
+		quotes: []quoteStyle{
+			{open: "'", close: "'", doubled: true, multiline: true},
+			{open: `"`, close: `"`, doubled: true, multiline: true},
+			{open: "`", close: "`", doubled: true, multiline: true},
+		},
+		features: lexDollarQuotes,
+	},
+	"lua": {
+		line:     []string{"--"},
+		quotes:   cQuotes,
+		docLine:  []string{"---"},
+		features: lexLuaLong,
+	},
+	"haskell": {
+		line:     []string{"--"},
+		lineNot:  []string{"-->"},
+		block:    []blockComment{{open: "{-", close: "-}", nested: true}},
+		quotes:   []quoteStyle{{open: `"`, close: `"`, escape: true}},
+		docLine:  []string{"-- |", "-- ^"},
+		docBlock: []string{"{- |"},
+	},
+	"elixir": {
+		line: []string{"#"},
+		quotes: []quoteStyle{
+			{open: `"""`, close: `"""`, escape: true, multiline: true},
+			{open: `'''`, close: `'''`, escape: true, multiline: true},
+			{open: `"`, close: `"`, escape: true, multiline: true},
+			{open: "'", close: "'", escape: true, multiline: true},
+		},
+	},
+	"clojure": {line: []string{";"}, quotes: []quoteStyle{{open: `"`, close: `"`, escape: true, multiline: true}}},
+	"erlang":  {line: []string{"%"}, quotes: []quoteStyle{{open: `"`, close: `"`, escape: true}}},
+	"r": {
+		line:    []string{"#"},
+		quotes:  []quoteStyle{{open: `"`, close: `"`, escape: true, multiline: true}, {open: "'", close: "'", escape: true, multiline: true}},
+		docLine: []string{"#'"},
+	},
+	"nim": {
+		line:   []string{"#"},
+		block:  []blockComment{{open: "#[", close: "]#", nested: true}},
+		quotes: []quoteStyle{{open: `"""`, close: `"""`, multiline: true}, {open: `"`, close: `"`, escape: true}},
+	},
+	"yaml": {
+		line: []string{"#"},
+		quotes: []quoteStyle{
+			{open: "'", close: "'", doubled: true, multiline: true},
+			{open: `"`, close: `"`, escape: true, multiline: true},
+		},
+		features: lexWordStart | lexQuoteAtWordStart | lexYAMLBlocks,
+	},
+	"toml": {
+		line: []string{"#"},
+		quotes: []quoteStyle{
+			{open: `"""`, close: `"""`, escape: true, multiline: true},
+			{open: `'''`, close: `'''`, multiline: true},
+			{open: `"`, close: `"`, escape: true},
+			{open: "'", close: "'"},
+		},
+	},
+	"ini":        {line: []string{";", "#"}, features: lexLineStart},
+	"dockerfile": {line: []string{"#"}, lineNot: []string{"# syntax=", "# escape=", "# check="}, features: lexLineStart},
+	"makefile":   {line: []string{"#"}, features: lexWordStart},
+	"cmake":      {line: []string{"#"}, quotes: []quoteStyle{{open: `"`, close: `"`, escape: true, multiline: true}}, features: lexWordStart},
+	"hcl": {
+		line:    []string{"#", "//"},
+		block:   cBlock,
+		quotes:  []quoteStyle{{open: `"`, close: `"`, escape: true}},
+		heredoc: "<<",
+	},
+	"graphql": {
+		line:   []string{"#"},
+		quotes: []quoteStyle{{open: `"""`, close: `"""`, multiline: true}, {open: `"`, close: `"`, escape: true}},
+	},
+	"css":    cssStyle,
+	"scss":   lessStyle,
+	"less":   lessStyle,
+	"html":   htmlStyle,
+	"xml":    htmlStyle,
+	"vue":    htmlStyle,
+	"svelte": htmlStyle,
+}
+
+// commentSpan is a comment (or Python docstring) found in the source
+type commentSpan struct {
+	start, end int
+	doc        bool // Doc comment: godoc, JSDoc, docstring, ...
+	docstring  bool // A Python docstring, which is a statement, not a comment
+}
+
+// stringSpan is a string literal, kept for docstring detection
+type stringSpan struct {
+	start, end int
+}
+
+// heredoc is an opened heredoc whose body starts on the next line
+type heredoc struct {
+	delim string
+}
+
+type commentLexer struct {
+	src   string
+	style *commentStyle
+	pos   int
+
+	spans    []commentSpan
+	strings  []stringSpan
+	literals []stringSpan // Every literal, including templates, regexes and heredoc bodies
+	heredocs []heredoc
+	yamlDoc  int // Indent of the line that opened a YAML block scalar, -1 if none
+}
+
+// stripComments removes comments from content. With keepDocs, doc
+// comments stay and only implementation comments are removed.
+func stripComments(content, language string, keepDocs bool) string {
+	style, ok := commentStyles[language]
+	if !ok {
+		return content
+	}
+
+	spans := findComments(content, style)
+	if keepDocs {
+		kept := spans[:0]
+		for _, span := range spans {
+			if !span.doc {
+				kept = append(kept, span)
+			}
+		}
+		spans = kept
+	}
+	return removeSpans(content, spans)
+}
+
+// findComments lexes src and returns its comments in source order
+func findComments(src string, style *commentStyle) []commentSpan {
+	l := &commentLexer{src: src, style: style, yamlDoc: -1}
+
+	// A shebang is an interpreter directive, not a comment
+	if strings.HasPrefix(src, "#!") && !strings.HasPrefix(src, "#![") {
+		l.pos = lineEnd(src, 0)
+	}
+	l.code(false)
+
+	if style.features&lexGoDoc != 0 {
+		l.markGoDocs()
+	}
+	if style.features&lexDocstrings != 0 {
+		l.findDocstrings()
+	}
+
+	sort.Slice(l.spans, func(i, j int) bool { return l.spans[i].start < l.spans[j].start })
+	return l.spans
+}
+
+// maskLiterals blanks out the comments and literals of src, keeping line
+// breaks, so structure can be found by looking for plain punctuation.
+// It returns false when the language has no lexer.
+func maskLiterals(src, language string) (string, bool) {
+	style, ok := commentStyles[language]
+	if !ok {
+		return src, false
+	}
+
+	l := &commentLexer{src: src, style: style, yamlDoc: -1}
+	l.code(false)
+
+	masked := []byte(src)
+	blank := func(start, end int) {
+		for i := start; i < end; i++ {
+			if masked[i] != '\n' {
+				masked[i] = ' '
+			}
+		}
+	}
+	for _, span := range l.spans {
+		blank(span.start, span.end)
+	}
+	for _, span := range l.literals {
+		blank(span.start, span.end)
+	}
+	return string(masked), true
+}
+
+func (l *commentLexer) has(feature lexFeature) bool {
+	return l.style.features&feature != 0
+}
+
+// code lexes source code up to the end of input or, inside a template
+// literal substitution, up to the matching "}"
+func (l *commentLexer) code(inTemplate bool) {
+	depth := 0
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; {
+		case c == '\n':
+			l.pos++
+			l.afterNewline()
+			continue
+		case inTemplate && c == '{':
+			depth++
+		case inTemplate && c == '}':
+			if depth == 0 {
+				l.pos++
+				return
+			}
+			depth--
+		}
+
+		if l.blockComment() || l.lineComment() {
+			continue
+		}
+		start := l.pos
+		if l.stringLiteral() || l.heredocStart() || l.yamlBlockStart() {
+			l.literals = append(l.literals, stringSpan{start: start, end: l.pos})
+			continue
+		}
+		l.pos++
+	}
+}
+
+// afterNewline skips heredoc bodies and YAML block scalars, whose
+// contents look like code but are literal text
+func (l *commentLexer) afterNewline() {
+	start := l.pos
+	defer func() {
+		if l.pos > start {
+			l.literals = append(l.literals, stringSpan{start: start, end: l.pos})
+		}
+	}()
+
+	for _, doc := range l.heredocs {
+		for l.pos < len(l.src) {
+			end := lineEnd(l.src, l.pos)
+			line := strings.TrimLeft(l.src[l.pos:end], " \t")
+			l.pos = min(end+1, len(l.src))
+			if strings.HasPrefix(line, doc.delim) && !isIdentByte(byteAt(line, len(doc.delim))) {
+				break
+			}
+		}
+	}
+	l.heredocs = nil
+
+	if l.yamlDoc >= 0 {
+		for l.pos < len(l.src) {
+			end := lineEnd(l.src, l.pos)
+			line := l.src[l.pos:end]
+			if strings.TrimSpace(line) != "" && indentWidth(line) <= l.yamlDoc {
+				break
+			}
+			l.pos = min(end+1, len(l.src))
+		}
+		l.yamlDoc = -1
+	}
+}
+
+func (l *commentLexer) blockComment() bool {
+	rest := l.src[l.pos:]
+
+	// Lua: --[[ ... ]] and --[==[ ... ]==]
+	if l.has(lexLuaLong) && strings.HasPrefix(rest, "--[") {
+		if level, ok := longBracket(rest[2:]); ok {
+			end := min(indexFrom(l.src, "]"+strings.Repeat("=", level)+"]", l.pos+4+level)+level+2, len(l.src))
+			l.addComment(l.pos, end, false)
+			return true
+		}
+	}
+
+	for _, b := range l.style.block {
+		if !strings.HasPrefix(rest, b.open) || (b.lineStart && !l.atColumnZero(l.pos)) {
+			continue
+		}
+		end := l.blockEnd(b, l.pos+len(b.open))
+		l.addComment(l.pos, end, hasDocPrefix(rest, l.style.docBlock))
+		return true
+	}
+	return false
+}
+
+// blockEnd finds the end of a block comment whose body starts at i
+func (l *commentLexer) blockEnd(b blockComment, i int) int {
+	depth := 1
+	for i < len(l.src) {
+		rest := l.src[i:]
+		switch {
+		case b.nested && strings.HasPrefix(rest, b.open):
+			depth++
+			i += len(b.open)
+		case strings.HasPrefix(rest, b.close) && (!b.lineStart || l.atColumnZero(i)):
+			i += len(b.close)
+			if depth--; depth == 0 {
+				if b.lineStart {
+					return lineEnd(l.src, i)
+				}
+				return i
+			}
+		default:
+			i++
+		}
+	}
+	return len(l.src)
+}
+
+func (l *commentLexer) lineComment() bool {
+	rest := l.src[l.pos:]
+	for _, marker := range l.style.line {
+		if !strings.HasPrefix(rest, marker) {
+			continue
+		}
+		for _, not := range l.style.lineNot {
+			if strings.HasPrefix(rest, not) {
+				return false
+			}
+		}
+		if l.has(lexWordStart) && l.pos > 0 && !strings.ContainsRune(" \t\r\n;&|()", rune(l.src[l.pos-1])) {
+			continue
+		}
+		if l.has(lexLineStart) && !l.atLineStart(l.pos) {
+			continue
+		}
+
+		l.addComment(l.pos, lineEnd(l.src, l.pos), hasDocPrefix(rest, l.style.docLine))
+		return true
+	}
+	return false
+}
+
+func (l *commentLexer) addComment(start, end int, doc bool) {
+	l.spans = append(l.spans, commentSpan{start: start, end: end, doc: doc})
+	l.pos = end
+}
+
+func (l *commentLexer) stringLiteral() bool {
+	rest := l.src[l.pos:]
+	c := rest[0]
+
+	switch {
+	case l.has(lexTemplates) && c == '`':
+		l.pos++
+		l.template()
+		return true
+	case l.has(lexRegex) && c == '/':
+		return l.regexLiteral()
+	case l.has(lexRustRaw) && (c == 'r' || c == 'b' || c == '\''):
+		return l.rustLiteral()
+	case l.has(lexCppRaw) && c == 'R' && strings.HasPrefix(rest, `R"`):
+		return l.cppRawString()
+	case l.has(lexLuaLong) && c == '[':
+		if level, ok := longBracket(rest); ok {
+			l.pos = min(indexFrom(l.src, "]"+strings.Repeat("=", level)+"]", l.pos+2+level), len(l.src))
+			return true
+		}
+	case l.has(lexDollarQuotes) && c == '$':
+		return l.dollarQuote()
+	}
+
+	if l.has(lexQuoteAtWordStart) && l.pos > 0 && !strings.ContainsRune(" \t\r\n[{,", rune(l.src[l.pos-1])) {
+		return false
+	}
+
+	for _, q := range l.style.quotes {
+		if strings.HasPrefix(rest, q.open) {
+			start := l.pos
+			l.pos = l.quoteEnd(q, l.pos+len(q.open))
+			l.strings = append(l.strings, stringSpan{start: start, end: l.pos})
+			return true
+		}
+	}
+	return false
+}
+
+// quoteEnd finds the end of a string literal whose body starts at i.
+// Unterminated single-line strings end at the line break.
+func (l *commentLexer) quoteEnd(q quoteStyle, i int) int {
+	for i < len(l.src) {
+		switch {
+		case q.escape && l.src[i] == '\\':
+			i += 2
+			continue
+		case strings.HasPrefix(l.src[i:], q.close):
+			i += len(q.close)
+			if q.doubled && strings.HasPrefix(l.src[i:], q.close) {
+				i += len(q.close)
+				continue
+			}
+			return i
+		case l.src[i] == '\n' && !q.multiline:
+			return i
+		}
+		i++
+	}
+	return len(l.src)
+}
+
+// template skips a JS template literal, lexing ${...} substitutions as code
+func (l *commentLexer) template() {
+	for l.pos < len(l.src) {
+		switch {
+		case l.src[l.pos] == '\\':
+			l.pos += 2
+		case l.src[l.pos] == '`':
+			l.pos++
+			return
+		case strings.HasPrefix(l.src[l.pos:], "${"):
+			l.pos += 2
+			l.code(true)
+		default:
+			l.pos++
+		}
+	}
+}
+
+// regexLiteral skips a JS regular expression when "/" can't be division
+func (l *commentLexer) regexLiteral() bool {
+	if next := byteAt(l.src, l.pos+1); next == '/' || next == '*' {
+		return false
+	}
+
+	// What precedes the slash decides: an operand means division
+	i := l.pos - 1
+	for i >= 0 && (l.src[i] == ' ' || l.src[i] == '\t') {
+		i--
+	}
+	if i >= 0 && !strings.ContainsRune("(,=:[!&|?{};+-*%<>~^\n", rune(l.src[i])) {
+		wordEnd := i + 1
+		for i >= 0 && isIdentByte(l.src[i]) {
+			i--
+		}
+		switch l.src[i+1 : wordEnd] {
+		case "return", "typeof", "case", "do", "else", "in", "of", "new", "delete", "void", "throw", "yield", "await":
+		default:
+			return false
+		}
+	}
+
+	inClass := false
+	for i := l.pos + 1; i < len(l.src); i++ {
+		switch l.src[i] {
+		case '\\':
+			i++
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '/':
+			if !inClass {
+				l.pos = i + 1
+				return true
+			}
+		case '\n':
+			return false
+		}
+	}
+	return false
+}
+
+// rustLiteral handles raw strings (r#"..."#, br"...") and tells char
+// literals ('a', '\n') apart from lifetimes ('a)
+func (l *commentLexer) rustLiteral() bool {
+	rest := l.src[l.pos:]
+	if rest[0] == '\'' {
+		if byteAt(rest, 1) == '\\' {
+			l.pos = l.quoteEnd(quoteStyle{close: "'", escape: true}, l.pos+1)
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(rest[1:])
+		if byteAt(rest, 1+size) == '\'' {
+			l.pos += 2 + size
+			return true
+		}
+		l.pos++ // Lifetime
+		return true
+	}
+
+	if l.pos > 0 && isIdentByte(l.src[l.pos-1]) {
+		return false
+	}
+	i := 0
+	if rest[0] == 'b' {
+		i++
+	}
+	if byteAt(rest, i) != 'r' {
+		return false
+	}
+	i++
+	hashes := 0
+	for byteAt(rest, i+hashes) == '#' {
+		hashes++
+	}
+	if byteAt(rest, i+hashes) != '"' {
+		return false
+	}
+
+	l.pos = min(indexFrom(l.src, `"`+strings.Repeat("#", hashes), l.pos+i+hashes+1)+1+hashes, len(l.src))
+	return true
+}
+
+// cppRawString skips R"delim( ... )delim" (with optional u8/u/U/L prefix)
+func (l *commentLexer) cppRawString() bool {
+	start := l.pos
+	for start > 0 && isIdentByte(l.src[start-1]) {
+		start--
+	}
+	switch l.src[start:l.pos] {
+	case "", "u8", "u", "U", "L":
+	default:
+		return false
+	}
+
+	open := strings.IndexByte(l.src[l.pos+2:], '(')
+	if open < 0 || open > 16 {
+		return false
+	}
+	delim := l.src[l.pos+2 : l.pos+2+open]
+	l.pos = min(indexFrom(l.src, ")"+delim+`"`, l.pos+3+open)+len(delim)+2, len(l.src))
+	return true
+}
+
+// dollarQuote skips a PostgreSQL $tag$ ... $tag$ string
+func (l *commentLexer) dollarQuote() bool {
+	if l.pos > 0 && isIdentByte(l.src[l.pos-1]) {
+		return false
+	}
+	i := l.pos + 1
+	for i < len(l.src) && isIdentByte(l.src[i]) {
+		i++
+	}
+	if byteAt(l.src, i) != '$' {
+		return false
+	}
+	tag := l.src[l.pos : i+1]
+	if len(tag) > 2 && tag[1] >= '0' && tag[1] <= '9' {
+		return false
+	}
+	l.pos = min(indexFrom(l.src, tag, i+1)+len(tag), len(l.src))
+	return true
+}
+
+// heredocStart records a heredoc (<<EOF, <<-'EOF', <<~EOS, <<<EOT)
+// whose body is skipped from the next line on
+func (l *commentLexer) heredocStart() bool {
+	opener := l.style.heredoc
+	if opener == "" || !strings.HasPrefix(l.src[l.pos:], opener) || byteAt(l.src, l.pos-1) == '<' {
+		return false
+	}
+
+	i := l.pos + len(opener)
+	if byteAt(l.src, i) == '<' {
+		return false // Shell here-string (<<<)
+	}
+	if c := byteAt(l.src, i); c == '-' || c == '~' {
+		i++
+	}
+	if l.has(lexHeredocSpace) {
+		for byteAt(l.src, i) == ' ' || byteAt(l.src, i) == '\t' {
+			i++
+		}
+	}
+
+	quote := byteAt(l.src, i)
+	if quote == '\'' || quote == '"' {
+		i++
+	} else {
+		quote = 0
+	}
+
+	start := i
+	if c := byteAt(l.src, i); !(c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z') {
+		return false
+	}
+	for i < len(l.src) && isIdentByte(l.src[i]) {
+		i++
+	}
+	delim := l.src[start:i]
+	if quote != 0 {
+		if byteAt(l.src, i) != quote {
+			return false
+		}
+		i++
+	}
+
+	l.heredocs = append(l.heredocs, heredoc{delim: delim})
+	l.pos = i
+	return true
+}
+
+// yamlBlockStart notices "key: |" and "- >-" block scalar indicators
+func (l *commentLexer) yamlBlockStart() bool {
+	if !l.has(lexYAMLBlocks) {
+		return false
+	}
+	c := l.src[l.pos]
+	if c != '|' && c != '>' {
+		return false
+	}
+
+	lineStart := strings.LastIndexByte(l.src[:l.pos], '\n') + 1
+	before := strings.TrimRight(l.src[lineStart:l.pos], " \t")
+	if before != "" && !strings.HasSuffix(before, ":") && !strings.HasSuffix(before, "-") {
+		return false
+	}
+
+	i := l.pos + 1
+	for i < len(l.src) && strings.IndexByte("+-0123456789", l.src[i]) >= 0 {
+		i++
+	}
+	for byteAt(l.src, i) == ' ' || byteAt(l.src, i) == '\t' {
+		i++
+	}
+	if c := byteAt(l.src, i); c != 0 && c != '\n' && c != '\r' && c != '#' {
+		return false
+	}
+
+	l.yamlDoc = indentWidth(l.src[lineStart:])
+	l.pos = i
+	return true
+}
+
+// goDirectives are comments the Go toolchain reads; they are never removed
+var goDirectives = []string{"//go:", "//line ", "// +build", "//export ", "//extern "}
+
+// markGoDocs marks comment groups attached to declarations as doc
+// comments and drops directives and cgo preambles from the spans
+func (l *commentLexer) markGoDocs() {
+	kept := l.spans[:0]
+	for _, span := range l.spans {
+		if !hasAnyPrefix(l.src[span.start:], goDirectives) {
+			kept = append(kept, span)
+		}
+	}
+	l.spans = kept
+
+	for i := 0; i < len(l.spans); {
+		// A group is a run of comments on consecutive lines of their own
+		j := i
+		if l.ownsLine(l.spans[i]) {
+			for j+1 < len(l.spans) && l.ownsLine(l.spans[j+1]) &&
+				strings.Count(l.src[l.spans[j].end:l.spans[j+1].start], "\n") == 1 &&
+				strings.TrimSpace(l.src[l.spans[j].end:l.spans[j+1].start]) == "" {
+				j++
+			}
+		} else {
+			i++
+			continue
+		}
+
+		next := l.src[min(lineEnd(l.src, l.spans[j].end)+1, len(l.src)):]
+		next = next[:lineEnd(next, 0)]
+		trimmed := strings.TrimSpace(next)
+
+		if strings.HasPrefix(trimmed, `import "C"`) {
+			// The cgo preamble is C code
+			l.spans = append(l.spans[:i], l.spans[j+1:]...)
+			continue
+		}
+
+		doc := false
+		if l.atColumnZero(l.spans[i].start) {
+			doc = hasAnyPrefix(trimmed, []string{"package ", "func ", "type ", "var ", "const "})
+		} else if r, _ := utf8.DecodeRuneInString(trimmed); r >= 'A' && r <= 'Z' {
+			doc = true // Exported struct field, interface method or grouped declaration
+		}
+		for k := i; k <= j; k++ {
+			l.spans[k].doc = doc
+		}
+		i = j + 1
+	}
+}
+
+// findDocstrings marks string statements opening a module, class or
+// function body as docstrings, which comment removal treats as comments
+func (l *commentLexer) findDocstrings() {
+	for _, s := range l.strings {
+		start := s.start
+		for start > 0 && s.start-start < 2 && strings.IndexByte("rRuUbBfF", l.src[start-1]) >= 0 {
+			start--
+		}
+		span := commentSpan{start: start, end: s.end, doc: true, docstring: true}
+		if !l.ownsLine(span) {
+			continue
+		}
+
+		prev := l.previousCodeLine(start)
+		if prev == "" || strings.HasSuffix(prev, ":") {
+			l.spans = append(l.spans, span)
+		}
+	}
+}
+
+// previousCodeLine returns the nearest non-blank, non-comment line before
+// i, without its trailing comment
+func (l *commentLexer) previousCodeLine(i int) string {
+	end := strings.LastIndexByte(l.src[:i], '\n')
+	for end > 0 {
+		start := strings.LastIndexByte(l.src[:end], '\n') + 1
+		code := end
+		for _, span := range l.spans {
+			if span.start >= start && span.start < code {
+				code = span.start
+			}
+		}
+		line := strings.TrimSpace(l.src[start:code])
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return line
+		}
+		end = start - 1
+	}
+	return ""
+}
+
+// ownsLine reports whether only whitespace surrounds span on its lines
+func (l *commentLexer) ownsLine(span commentSpan) bool {
+	return l.atLineStart(span.start) && strings.TrimSpace(l.src[span.end:lineEnd(l.src, span.end)]) == ""
+}
+
+func (l *commentLexer) atLineStart(i int) bool {
+	lineStart := strings.LastIndexByte(l.src[:i], '\n') + 1
+	return strings.TrimSpace(l.src[lineStart:i]) == ""
+}
+
+func (l *commentLexer) atColumnZero(i int) bool {
+	return i == 0 || l.src[i-1] == '\n'
+}
+
+// removeSpans deletes spans from content. Comments on lines of their own
+// take the whole line with them; trailing comments take the whitespace
+// before them; inline block comments between tokens leave a space.
+func removeSpans(content string, spans []commentSpan) string {
+	if len(spans) == 0 {
+		return content
+	}
+
+	out := make([]byte, 0, len(content))
+	pos := 0
+	for _, span := range spans {
+		if span.start < pos {
+			continue
+		}
+
+		lineStart := strings.LastIndexByte(content[:span.start], '\n') + 1
+		end := lineEnd(content, span.end)
+		before := content[lineStart:span.start]
+		after := content[span.end:end]
+
+		if lineStart >= pos && strings.TrimSpace(before) == "" && strings.TrimSpace(after) == "" {
+			out = append(out, content[pos:lineStart]...)
+			if span.docstring && needsPass(content, before, end) {
+				newline := "\n"
+				if end > 0 && end < len(content) && content[end-1] == '\r' {
+					newline = "\r\n"
+				}
+				out = append(out, before+"pass"+newline...)
+			}
+			pos = min(end+1, len(content))
+			continue
+		}
+
+		out = append(out, content[pos:span.start]...)
+		pos = span.end
+		switch {
+		case strings.TrimSpace(after) == "":
+			for len(out) > 0 && (out[len(out)-1] == ' ' || out[len(out)-1] == '\t') {
+				out = out[:len(out)-1]
+			}
+		case len(out) == 0:
+		case !isSpaceByte(out[len(out)-1]) && !isSpaceByte(content[span.end]):
+			out = append(out, ' ')
+		case out[len(out)-1] == ' ' && content[span.end] == ' ':
+			pos++ // Don't leave a double space behind
+		}
+	}
+	return string(append(out, content[pos:]...))
+}
+
+// needsPass reports whether removing a docstring at indent leaves its
+// block empty, which Python rejects
+func needsPass(content, indent string, end int) bool {
+	if indent == "" {
+		return false
+	}
+	for i := end + 1; i < len(content); {
+		lineEndAt := lineEnd(content, i)
+		line := content[i:lineEndAt]
+		if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			return indentWidth(line) < len(indent)
+		}
+		i = lineEndAt + 1
+	}
+	return true
+}
+
+// longBracket matches a Lua long bracket opener ([[ or [==[) at s
+func longBracket(s string) (int, bool) {
+	if byteAt(s, 0) != '[' {
+		return 0, false
+	}
+	level := 1
+	for byteAt(s, level) == '=' {
+		level++
+	}
+	if byteAt(s, level) != '[' {
+		return 0, false
+	}
+	return level - 1, true
+}
+
+func hasDocPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		// "////" and "/**/" are separators and empty comments, not docs
+		if strings.HasPrefix(s, prefix) {
+			next := byteAt(s, len(prefix))
+			return next != prefix[len(prefix)-1] && next != '/'
+		}
+	}
+	return false
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// indexFrom returns the index of substr in s at or after i (len(s) if absent)
+func indexFrom(s, substr string, i int) int {
+	if i >= len(s) {
+		return len(s)
+	}
+	if j := strings.Index(s[i:], substr); j >= 0 {
+		return i + j
+	}
+	return len(s)
+}
+
+// lineEnd returns the index of the newline ending the line at i (or len(s))
+func lineEnd(s string, i int) int {
+	if j := strings.IndexByte(s[i:], '\n'); j >= 0 {
+		return i + j
+	}
+	return len(s)
+}
+
+func indentWidth(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+func byteAt(s string, i int) byte {
+	if i < 0 || i >= len(s) {
+		return 0
+	}
+	return s[i]
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
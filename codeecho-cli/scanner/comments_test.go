@@ -0,0 +1,351 @@
+package scanner
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+type stripTest struct {
+	name     string
+	in       string
+	want     string
+	keepDocs bool
+}
+
+// testStripComments runs stripComments on each case for one language
+func testStripComments(t *testing.T, language string, tests []stripTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripComments(tt.in, language, tt.keepDocs); got != tt.want {
+				t.Errorf("stripComments(%q, keepDocs=%t)\n got: %q\nwant: %q", tt.in, tt.keepDocs, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripCommentsGo(t *testing.T) {
+	testStripComments(t, "go", []stripTest{
+		{
+			name: "line and block comments",
+			in:   "package a\n\n// Implementation note\nvar x = 1 // trailing\nvar y = /* inline */ 2\n",
+			want: "package a\n\nvar x = 1\nvar y = 2\n",
+		},
+		{
+			name: "markers in strings",
+			in:   "package a\n\nvar s = \"// not a comment /* nor this */\"\nvar r = '/' // slash\n",
+			want: "package a\n\nvar s = \"// not a comment /* nor this */\"\nvar r = '/'\n",
+		},
+		{
+			name: "raw string",
+			in:   "package a\n\nvar q = `\n// still the string\n/* and this */\n`\n",
+			want: "package a\n\nvar q = `\n// still the string\n/* and this */\n`\n",
+		},
+		{
+			name: "escaped quote",
+			in:   "package a\n\nvar s = \"a \\\" // b\" // c\n",
+			want: "package a\n\nvar s = \"a \\\" // b\"\n",
+		},
+		{
+			name: "directives stay",
+			in:   "//go:build linux\n\npackage a\n\n//go:generate stringer -type=T\n// T is a type\ntype T int\n",
+			want: "//go:build linux\n\npackage a\n\n//go:generate stringer -type=T\ntype T int\n",
+		},
+		{
+			name:     "doc comments kept",
+			in:       "package a\n\n// F does things.\nfunc F() {\n\t// step one\n\tg()\n}\n",
+			want:     "package a\n\n// F does things.\nfunc F() {\n\tg()\n}\n",
+			keepDocs: true,
+		},
+		{
+			name: "doc comments removed",
+			in:   "package a\n\n// F does things.\nfunc F() {\n\t// step one\n\tg()\n}\n",
+			want: "package a\n\nfunc F() {\n\tg()\n}\n",
+		},
+		{
+			name:     "cgo preamble",
+			in:       "package a\n\n// #include <stdio.h>\nimport \"C\"\n",
+			want:     "package a\n\n// #include <stdio.h>\nimport \"C\"\n",
+			keepDocs: true,
+		},
+	})
+}
+
+func TestStripCommentsJavaScript(t *testing.T) {
+	testStripComments(t, "javascript", []stripTest{
+		{
+			name: "markers in strings",
+			in:   "const url = \"http://example.com\"; // home\nconst c = '/* x */';\n",
+			want: "const url = \"http://example.com\";\nconst c = '/* x */';\n",
+		},
+		{
+			name: "template literal",
+			in:   "const t = `// kept ${a /* gone */ + b} /* kept */`;\n",
+			want: "const t = `// kept ${a + b} /* kept */`;\n",
+		},
+		{
+			name: "nested template",
+			in:   "const t = `a ${f(`// inner`)} b`; // end\n",
+			want: "const t = `a ${f(`// inner`)} b`;\n",
+		},
+		{
+			name: "regex literal",
+			in:   "const re = /\\/\\/ not a comment/g; // comment\nconst s = x.replace(/\\/*$/, '');\n",
+			want: "const re = /\\/\\/ not a comment/g;\nconst s = x.replace(/\\/*$/, '');\n",
+		},
+		{
+			name: "division is not a regex",
+			in:   "const r = a / b; // half\nconst q = c / d / e;\n",
+			want: "const r = a / b;\nconst q = c / d / e;\n",
+		},
+		{
+			name:     "JSDoc kept",
+			in:       "/**\n * Adds numbers.\n */\nfunction add(a, b) {\n  /* sum */\n  return a + b;\n}\n",
+			want:     "/**\n * Adds numbers.\n */\nfunction add(a, b) {\n  return a + b;\n}\n",
+			keepDocs: true,
+		},
+	})
+}
+
+func TestStripCommentsPython(t *testing.T) {
+	testStripComments(t, "python", []stripTest{
+		{
+			name: "hash in strings",
+			in:   "s = \"# not a comment\"  # comment\nt = '#' + \"x\"\n",
+			want: "s = \"# not a comment\"\nt = '#' + \"x\"\n",
+		},
+		{
+			name: "triple-quoted string with markers",
+			in:   "SQL = \"\"\"\nSELECT 1 -- # kept\n\"\"\"\n",
+			want: "SQL = \"\"\"\nSELECT 1 -- # kept\n\"\"\"\n",
+		},
+		{
+			name: "module and function docstrings",
+			in:   "\"\"\"Module doc.\"\"\"\n\ndef f():\n    \"\"\"Function doc.\"\"\"\n    return 1\n",
+			want: "\ndef f():\n    return 1\n",
+		},
+		{
+			name:     "docstrings kept",
+			in:       "def f():\n    \"\"\"Function doc.\"\"\"\n    # step\n    return 1\n",
+			want:     "def f():\n    \"\"\"Function doc.\"\"\"\n    return 1\n",
+			keepDocs: true,
+		},
+		{
+			name: "docstring-only function gets pass",
+			in:   "def f():\n    \"\"\"Only a docstring.\"\"\"\n\n\ndef g():\n    return 1\n",
+			want: "def f():\n    pass\n\n\ndef g():\n    return 1\n",
+		},
+		{
+			name: "docstring-only method gets pass",
+			in:   "class C:\n    def m(self):\n        \"\"\"Doc.\"\"\"\n\n    def n(self):\n        return 1\n",
+			want: "class C:\n    def m(self):\n        pass\n\n    def n(self):\n        return 1\n",
+		},
+		{
+			name: "docstring and comments only",
+			in:   "class E(Exception):\n    '''Raised on error.'''\n    # nothing else\n",
+			want: "class E(Exception):\n    pass\n",
+		},
+		{
+			name: "docstring at end of file",
+			in:   "def f():\n    r\"\"\"Raw doc.\"\"\"",
+			want: "def f():\n    pass\n",
+		},
+		{
+			name: "tab-indented docstring-only function",
+			in:   "def f():\n\t\"\"\"Doc.\"\"\"\ndef g():\n\treturn 1\n",
+			want: "def f():\n\tpass\ndef g():\n\treturn 1\n",
+		},
+		{
+			name: "def line with trailing comment",
+			in:   "def f():  # helper\n    \"\"\"Doc.\"\"\"\n",
+			want: "def f():\n    pass\n",
+		},
+		{
+			name: "CRLF docstring-only function",
+			in:   "def f():\r\n    \"\"\"Doc.\"\"\"\r\n\r\ndef g():\r\n    return 1\r\n",
+			want: "def f():\r\n    pass\r\n\r\ndef g():\r\n    return 1\r\n",
+		},
+		{
+			name: "multi-line signature",
+			in:   "def f(a,\n      b):\n    \"\"\"Doc.\"\"\"\n",
+			want: "def f(a,\n      b):\n    pass\n",
+		},
+		{
+			name: "string statement after code stays",
+			in:   "def f():\n    x = 1\n    \"\"\"Not a docstring.\"\"\"\n    return x\n",
+			want: "def f():\n    x = 1\n    \"\"\"Not a docstring.\"\"\"\n    return x\n",
+		},
+		{
+			name: "shebang stays",
+			in:   "#!/usr/bin/env python3\n# comment\nprint(1)\n",
+			want: "#!/usr/bin/env python3\nprint(1)\n",
+		},
+	})
+}
+
+// checkPythonCompiles fails the test when src isn't valid Python, and
+// skips it without python3
+func checkPythonCompiles(t *testing.T, src string) {
+	t.Helper()
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("python3 not found")
+	}
+	cmd := exec.Command(python, "-c", "import ast, sys; ast.parse(sys.stdin.read())")
+	cmd.Stdin = strings.NewReader(src)
+	if msg, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("not valid Python: %v\n%s\nsource:\n%s", err, msg, src)
+	}
+}
+
+// Output that strips docstrings must still compile
+func TestStripCommentsPythonCompiles(t *testing.T) {
+	sources := []string{
+		"def f():\n    \"\"\"Only a docstring.\"\"\"\n",
+		"class C:\n    \"\"\"Doc.\"\"\"\n\n    def m(self):\n        '''Doc.'''\n        # comment\n",
+		"if True:\n    def f():\n        \"\"\"Doc.\"\"\"\nelse:\n    pass\n",
+		"def f():  # helper\n    \"\"\"Doc.\"\"\"\n",
+		"def f():\n\t\"\"\"Doc.\"\"\"\n",
+	}
+	for _, src := range sources {
+		checkPythonCompiles(t, stripComments(src, "python", false))
+	}
+}
+
+func TestStripCommentsRust(t *testing.T) {
+	testStripComments(t, "rust", []stripTest{
+		{
+			name: "nested block comment",
+			in:   "/* outer /* inner */ still comment */\nfn main() {}\n",
+			want: "fn main() {}\n",
+		},
+		{
+			name: "raw string",
+			in:   "let s = r#\"// \"quoted\" /* */\"#; // comment\n",
+			want: "let s = r#\"// \"quoted\" /* */\"#;\n",
+		},
+		{
+			name: "char literal and lifetime",
+			in:   "fn f<'a>(x: &'a str) -> char { '/' } // comment\nlet q = '\"'; // quote\n",
+			want: "fn f<'a>(x: &'a str) -> char { '/' }\nlet q = '\"';\n",
+		},
+		{
+			name:     "doc comments kept",
+			in:       "//! Crate doc.\n/// Item doc.\n// note\nfn f() {}\n",
+			want:     "//! Crate doc.\n/// Item doc.\nfn f() {}\n",
+			keepDocs: true,
+		},
+	})
+}
+
+func TestStripCommentsCpp(t *testing.T) {
+	testStripComments(t, "cpp", []stripTest{
+		{
+			name: "raw string",
+			in:   "auto s = R\"x(// not /* a */ comment)x\"; // comment\n",
+			want: "auto s = R\"x(// not /* a */ comment)x\";\n",
+		},
+		{
+			name: "block comments don't nest",
+			in:   "/* a /* b */ int x; // c\n",
+			want: " int x;\n",
+		},
+	})
+}
+
+func TestStripCommentsHeredocs(t *testing.T) {
+	testStripComments(t, "shell", []stripTest{
+		{
+			name: "heredoc body",
+			in:   "cat <<EOF\n# kept\nEOF\n# removed\necho hi # trailing\n",
+			want: "cat <<EOF\n# kept\nEOF\necho hi\n",
+		},
+		{
+			name: "quoted heredoc with spaces",
+			in:   "cat << 'END'\n# kept $x\nEND\n",
+			want: "cat << 'END'\n# kept $x\nEND\n",
+		},
+		{
+			name: "hash inside a word",
+			in:   "echo a#b ${#arr[@]} # comment\n",
+			want: "echo a#b ${#arr[@]}\n",
+		},
+	})
+
+	testStripComments(t, "ruby", []stripTest{
+		{
+			name: "squiggly heredoc",
+			in:   "s = <<~SQL\n  # kept\nSQL\n# removed\n",
+			want: "s = <<~SQL\n  # kept\nSQL\n",
+		},
+		{
+			name: "begin and end block",
+			in:   "=begin\ndocs\n=end\nputs 1\n",
+			want: "puts 1\n",
+		},
+	})
+
+	testStripComments(t, "php", []stripTest{
+		{
+			name: "heredoc and attribute",
+			in:   "<?php\n#[Attr]\n$s = <<<EOT\n// kept\nEOT;\n# removed\n",
+			want: "<?php\n#[Attr]\n$s = <<<EOT\n// kept\nEOT;\n",
+		},
+	})
+}
+
+func TestStripCommentsOtherLanguages(t *testing.T) {
+	testStripComments(t, "haskell", []stripTest{
+		{
+			name: "nested block comment",
+			in:   "{- a {- b -} c -}\nmain = pure () -- done\n",
+			want: "main = pure ()\n",
+		},
+		{
+			name:     "haddock kept",
+			in:       "-- | Doc.\n-- note\nf = 1\n",
+			want:     "-- | Doc.\nf = 1\n",
+			keepDocs: true,
+		},
+	})
+
+	testStripComments(t, "sql", []stripTest{
+		{
+			name: "dollar quoting and doubled quotes",
+			in:   "SELECT 'it''s -- kept', $$ -- kept $$; -- removed\n",
+			want: "SELECT 'it''s -- kept', $$ -- kept $$;\n",
+		},
+	})
+
+	testStripComments(t, "lua", []stripTest{
+		{
+			name: "long brackets",
+			in:   "--[[ block\ncomment ]]\nlocal s = [[ -- kept ]] -- removed\n",
+			want: "local s = [[ -- kept ]]\n",
+		},
+	})
+
+	testStripComments(t, "yaml", []stripTest{
+		{
+			name: "block scalar and quoted hash",
+			in:   "run: |\n  echo # kept\nurl: \"a#b\" # removed\nkey: a#b\n",
+			want: "run: |\n  echo # kept\nurl: \"a#b\"\nkey: a#b\n",
+		},
+	})
+
+	testStripComments(t, "html", []stripTest{
+		{
+			name: "html comment",
+			in:   "<p>a</p>\n<!-- gone -->\n<p>b</p>\n",
+			want: "<p>a</p>\n<p>b</p>\n",
+		},
+	})
+}
+
+func TestStripCommentsUnknownLanguage(t *testing.T) {
+	in := "// stays\n# stays\n"
+	if got := stripComments(in, "", false); got != in {
+		t.Errorf("stripComments changed an unknown language: %q", got)
+	}
+}
@@ -0,0 +1,449 @@
+package scanner
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"strings"
+)
+
+// CompressMode selects how --compress shrinks file contents
+type CompressMode string
+
+const (
+	CompressNone       CompressMode = ""
+	CompressWhitespace CompressMode = "whitespace" // Trim whitespace, minify JSON
+	CompressSignatures CompressMode = "signatures" // Keep declarations, elide function bodies
+)
+
+// ParseCompressMode validates a --compress value
+func ParseCompressMode(s string) (CompressMode, error) {
+	switch mode := CompressMode(strings.ToLower(s)); mode {
+	case CompressNone, CompressWhitespace, CompressSignatures:
+		return mode, nil
+	case "none":
+		return CompressNone, nil
+	}
+	return "", fmt.Errorf("unknown compression mode %q (supported: whitespace, signatures)", s)
+}
+
+// bodyElision replaces an elided brace-delimited body
+const bodyElision = "{ ... }"
+
+// braceLanguages are handled by the brace-aware signature extractor
+var braceLanguages = map[string]bool{
+	"go": true, "javascript": true, "typescript": true, "jsx": true, "tsx": true,
+	"java": true, "c": true, "cpp": true, "csharp": true, "rust": true, "swift": true,
+	"kotlin": true, "scala": true, "groovy": true, "dart": true, "php": true, "zig": true,
+}
+
+// containerKeywords open blocks whose members are declarations, so the
+// extractor descends into them instead of eliding them
+var containerKeywords = map[string]bool{
+	"class": true, "interface": true, "struct": true, "enum": true, "union": true,
+	"namespace": true, "module": true, "impl": true, "trait": true, "mod": true,
+	"object": true, "extension": true, "protocol": true, "record": true, "actor": true,
+	"mixin": true, "extern": true, "type": true,
+}
+
+// compressSignatures reduces content to its declarations. It reports
+// false, with content unchanged, when the language isn't supported or
+// there was nothing to elide.
+func compressSignatures(content, language string) (string, bool) {
+	compressed, ok := languageSignatures(content, language)
+	if !ok || compressed == content {
+		return content, false
+	}
+	return compressed, true
+}
+
+func languageSignatures(content, language string) (string, bool) {
+	switch {
+	case language == "go":
+		if compressed, err := goSignatures(content); err == nil {
+			return compressed, true
+		}
+		// Fall back to the heuristic for files that don't parse
+		return braceSignatures(content, language)
+	case braceLanguages[language]:
+		return braceSignatures(content, language)
+	case language == "python":
+		return pythonSignatures(content)
+	case language == "ruby":
+		return rubySignatures(content)
+	}
+	return content, false
+}
+
+// goSignatures prints a Go file without function bodies. Package clause,
+// imports, types, constants and variables are kept along with their doc
+// comments; comments inside the removed bodies are dropped. Function
+// literals need a body, so theirs is printed as bodyElision. A file
+// without bodies is returned as is rather than reformatted.
+func goSignatures(content string) (string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.ParseComments)
+	if err != nil {
+		return "", err
+	}
+
+	type span struct{ start, end token.Pos }
+	var bodies []span
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if n.Body != nil {
+				bodies = append(bodies, span{n.Body.Lbrace, n.Body.Rbrace})
+				n.Body = nil
+			}
+			return false
+		case *ast.FuncLit:
+			bodies = append(bodies, span{n.Body.Lbrace, n.Body.Rbrace})
+			n.Body = &ast.BlockStmt{
+				Lbrace: n.Body.Lbrace,
+				List:   []ast.Stmt{&ast.ExprStmt{X: &ast.Ident{Name: "...", NamePos: n.Body.Lbrace}}},
+				Rbrace: n.Body.Lbrace,
+			}
+			return false
+		}
+		return true
+	})
+	if len(bodies) == 0 {
+		return content, nil
+	}
+
+	comments := file.Comments[:0]
+	for _, group := range file.Comments {
+		inBody := false
+		for _, body := range bodies {
+			if group.Pos() > body.start && group.End() <= body.end {
+				inBody = true
+				break
+			}
+		}
+		if !inBody {
+			comments = append(comments, group)
+		}
+	}
+	file.Comments = comments
+
+	var buf bytes.Buffer
+	cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	if err := cfg.Fprint(&buf, fset, file); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// braceSignatures elides the bodies of functions, methods and control
+// statements in brace-delimited languages. Other blocks (classes,
+// interfaces, namespaces, object and type literals, import lists) are
+// kept, and the extractor descends into them.
+func braceSignatures(content, language string) (string, bool) {
+	masked, ok := maskLiterals(content, language)
+	if !ok {
+		return content, false
+	}
+
+	var out strings.Builder
+	copied := 0    // content[:copied] has been written to out
+	stmtStart := 0 // Start of the statement the next "{" belongs to
+
+	for i := 0; i < len(masked); i++ {
+		switch masked[i] {
+		case ';', '}':
+			stmtStart = i + 1
+		case '{':
+			if header := masked[stmtStart:i]; isContainerHeader(header) || !isBodyHeader(header) {
+				stmtStart = i + 1
+				continue
+			}
+
+			end := matchingBrace(masked, i)
+			if strings.TrimSpace(masked[i+1:end]) != "" {
+				out.WriteString(content[copied:i])
+				out.WriteString(bodyElision)
+				copied = min(end+1, len(content))
+			}
+			i = end
+			stmtStart = i + 1
+		}
+	}
+	out.WriteString(content[copied:])
+	return out.String(), true
+}
+
+// isContainerHeader reports whether the code before a "{" declares a
+// container such as a class: a container keyword appears outside any
+// parentheses and before any assignment
+func isContainerHeader(header string) bool {
+	var words strings.Builder
+	parens := 0
+	for i := 0; i < len(header); i++ {
+		switch c := header[i]; {
+		case c == '(':
+			parens++
+		case c == ')':
+			parens = max(parens-1, 0)
+		case parens > 0:
+		case c == '=':
+			i = len(header)
+		case isIdentByte(c):
+			words.WriteByte(c)
+			continue
+		}
+		words.WriteByte(' ')
+	}
+
+	for _, word := range strings.Fields(words.String()) {
+		if containerKeywords[word] {
+			return true
+		}
+	}
+	return false
+}
+
+// bodyKeywords open a statement block without a parameter list
+var bodyKeywords = map[string]bool{
+	"else": true, "try": true, "finally": true, "do": true, "loop": true,
+	"unsafe": true, "defer": true, "get": true, "set": true, "static": true,
+}
+
+// isBodyHeader reports whether the code before a "{" opens a function or
+// statement body: it has a parameter list or condition in parentheses,
+// is an arrow function, or is a keyword such as else or try
+func isBodyHeader(header string) bool {
+	header = strings.TrimSpace(header)
+	if strings.HasSuffix(header, "=>") {
+		return true
+	}
+	if fields := strings.Fields(header); len(fields) > 0 && bodyKeywords[fields[len(fields)-1]] {
+		return true
+	}
+
+	parens, closed := 0, false
+	for i := 0; i < len(header); i++ {
+		switch header[i] {
+		case '(':
+			parens++
+		case ')':
+			if parens--; parens == 0 {
+				closed = true
+			}
+		}
+	}
+	return closed && parens == 0
+}
+
+// matchingBrace returns the index of the "}" closing the "{" at open,
+// or the last index when it is unbalanced
+func matchingBrace(masked string, open int) int {
+	depth := 0
+	for i := open; i < len(masked); i++ {
+		switch masked[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(masked) - 1
+}
+
+// sourceLine is one line of a file and its masked counterpart
+type sourceLine struct {
+	text   string
+	masked string
+}
+
+func splitSourceLines(content, masked string) []sourceLine {
+	texts := strings.Split(content, "\n")
+	maskedLines := strings.Split(masked, "\n")
+	lines := make([]sourceLine, len(texts))
+	for i := range texts {
+		lines[i] = sourceLine{text: texts[i], masked: maskedLines[i]}
+	}
+	return lines
+}
+
+// isCode reports whether the line has code outside comments and literals
+func (l sourceLine) isCode() bool {
+	return strings.TrimSpace(l.masked) != ""
+}
+
+// startsBlockBoundary reports whether a line at or left of indent ends
+// the body of a block opened at indent: code, or a comment introducing
+// what follows
+func (l sourceLine) startsBlockBoundary(indent int, commentPrefix string) bool {
+	if strings.TrimSpace(l.text) == "" || indentWidth(l.text) > indent {
+		return false
+	}
+	return l.isCode() || strings.HasPrefix(strings.TrimSpace(l.text), commentPrefix)
+}
+
+// pythonSignatures keeps classes, decorators, module and class level
+// statements and def lines with their docstrings; function bodies become
+// "..."
+func pythonSignatures(content string) (string, bool) {
+	masked, ok := maskLiterals(content, "python")
+	if !ok {
+		return content, false
+	}
+	lines := splitSourceLines(content, masked)
+
+	var out []string
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line.masked)
+		if !strings.HasPrefix(trimmed, "def ") && !strings.HasPrefix(trimmed, "async def ") {
+			out = append(out, line.text)
+			continue
+		}
+
+		// The signature runs until the ":" that closes it
+		indent := indentWidth(line.text)
+		depth, colon := 0, -1
+		sigEnd := i
+		for ; sigEnd < len(lines); sigEnd++ {
+			if colon, depth = signatureColon(lines[sigEnd].masked, depth); colon >= 0 {
+				break
+			}
+		}
+		if sigEnd == len(lines) {
+			// Not a block (or unbalanced): keep the rest as is
+			for ; i < len(lines); i++ {
+				out = append(out, lines[i].text)
+			}
+			break
+		}
+		for j := i; j <= sigEnd; j++ {
+			out = append(out, lines[j].text)
+		}
+
+		// One-line body ("def f(): return 1") after the colon
+		if strings.TrimSpace(lines[sigEnd].masked[colon+1:]) != "" {
+			i = sigEnd
+			continue
+		}
+
+		bodyEnd := sigEnd + 1
+		for bodyEnd < len(lines) && !lines[bodyEnd].startsBlockBoundary(indent, "#") {
+			bodyEnd++
+		}
+		// Blank lines before the next statement stay outside the body
+		trailing := bodyEnd
+		for trailing > sigEnd+1 && strings.TrimSpace(lines[trailing-1].text) == "" {
+			trailing--
+		}
+
+		// Keep a docstring: the body's first line is a string literal
+		bodyIndent := strings.Repeat(" ", indent+4)
+		j := sigEnd + 1
+		for j < trailing && strings.TrimSpace(lines[j].text) == "" {
+			j++
+		}
+		if j < trailing {
+			bodyIndent = lines[j].text[:indentWidth(lines[j].text)]
+			if quote := docstringQuote(strings.TrimSpace(lines[j].text)); quote != "" {
+				for seen := 0; j < trailing && seen < 2; j++ {
+					seen += strings.Count(lines[j].text, quote)
+					out = append(out, lines[j].text)
+				}
+			}
+		}
+		out = append(out, bodyIndent+"...")
+
+		for k := trailing; k < bodyEnd; k++ {
+			out = append(out, lines[k].text)
+		}
+		i = bodyEnd - 1
+	}
+	return strings.Join(out, "\n"), true
+}
+
+// signatureColon returns the index of the first ":" in a line of a
+// masked Python signature outside brackets, or -1, and the bracket depth
+// at the end of the line given the depth at its start
+func signatureColon(line string, depth int) (int, int) {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case ':':
+			if depth <= 0 {
+				return i, depth
+			}
+		}
+	}
+	return -1, depth
+}
+
+// docstringQuote returns the quote that opens a string literal at the
+// start of line, or "" when the line doesn't start with one
+func docstringQuote(line string) string {
+	line = strings.TrimLeft(line, "rRuUbBfF")
+	for _, quote := range []string{`"""`, "'''", `"`, "'"} {
+		if strings.HasPrefix(line, quote) {
+			return quote
+		}
+	}
+	return ""
+}
+
+// rubySignatures keeps classes, modules and def lines; method bodies are
+// dropped, leaving an empty method
+func rubySignatures(content string) (string, bool) {
+	masked, ok := maskLiterals(content, "ruby")
+	if !ok {
+		return content, false
+	}
+	lines := splitSourceLines(content, masked)
+
+	var out []string
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line.masked)
+		out = append(out, line.text)
+		if !strings.HasPrefix(trimmed, "def ") || rubyDefIsSingleLine(trimmed) {
+			continue
+		}
+
+		// The body runs until the "end" at the def's indentation
+		indent := indentWidth(line.text)
+		end := i + 1
+		for end < len(lines) {
+			l := lines[end]
+			if l.isCode() && indentWidth(l.text) <= indent {
+				break
+			}
+			end++
+		}
+		if end == len(lines) || strings.TrimSpace(lines[end].masked) != "end" {
+			continue // Couldn't find the matching end; leave the body alone
+		}
+		out = append(out, lines[end].text)
+		i = end
+	}
+	return strings.Join(out, "\n"), true
+}
+
+// rubyDefIsSingleLine reports whether a def line is a complete method
+// ("def x; 1; end" or the endless "def x = 1")
+func rubyDefIsSingleLine(line string) bool {
+	if strings.HasSuffix(line, " end") || strings.HasSuffix(line, ";end") {
+		return true
+	}
+	head := line
+	if paren := strings.LastIndex(head, ")"); paren >= 0 {
+		head = head[paren:]
+	}
+	return strings.Contains(head, " = ")
+}
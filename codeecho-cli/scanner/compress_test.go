@@ -0,0 +1,60 @@
+package scanner
+
+import "testing"
+
+func TestPythonSignatures(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "one-line method before a function",
+			in:   "class A:\n    def g(self): return 1\n\ndef h():\n    x = 1\n    return x\n",
+			want: "class A:\n    def g(self): return 1\n\ndef h():\n    ...\n",
+		},
+		{
+			name: "one-line async functions",
+			in:   "async def f(): await g()\nasync def h():\n    await g()\n",
+			want: "async def f(): await g()\nasync def h():\n    ...\n",
+		},
+		{
+			name: "multi-line signature",
+			in:   "def f(a,\n      b=(1, 2)):\n    return a\n",
+			want: "def f(a,\n      b=(1, 2)):\n    ...\n",
+		},
+		{
+			name: "colons inside brackets",
+			in:   "def f(a: dict[str, int] = {'k': 1}, key=lambda x: x) -> list[int]:\n    return [a]\n",
+			want: "def f(a: dict[str, int] = {'k': 1}, key=lambda x: x) -> list[int]:\n    ...\n",
+		},
+		{
+			name: "colons in a comment and a docstring",
+			in:   "def f():  # note: here\n    \"\"\"Doc: yes.\"\"\"\n    return 1\n",
+			want: "def f():  # note: here\n    \"\"\"Doc: yes.\"\"\"\n    ...\n",
+		},
+		{
+			name: "nested function",
+			in:   "def outer():\n    def inner():\n        return 1\n    return inner\n\nx = outer()\n",
+			want: "def outer():\n    ...\n\nx = outer()\n",
+		},
+		{
+			name: "already elided",
+			in:   "def f(): ...\n",
+			want: "def f(): ...\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := pythonSignatures(tt.in)
+			if !ok {
+				t.Fatal("pythonSignatures failed")
+			}
+			if got != tt.want {
+				t.Errorf("got:  %q\nwant: %q", got, tt.want)
+			}
+			checkPythonCompiles(t, got)
+		})
+	}
+}
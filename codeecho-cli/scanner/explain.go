@@ -0,0 +1,73 @@
+package scanner
+
+// Reasons reported by a dry run for each path a scan considers
+const (
+	ReasonIncluded      = "included"
+	ReasonBinary        = "binary"         // Listed in the pack without content
+	ReasonDeleted       = "deleted"        // Listed as deleted in a change set
+	ReasonTruncated     = "truncated"      // Trimmed by --max-tokens
+	ReasonStructureOnly = "structure-only" // Content dropped by --max-tokens
+
+	ReasonExcludedDir    = "excluded-dir"    // Directory name is in --exclude-dirs
+	ReasonExtension      = "extension"       // Extension is not in --include-exts
+	ReasonIncludePattern = "include-pattern" // Matches none of the --include globs
+	ReasonIgnorePattern  = "ignore-pattern"  // Matches an --ignore glob
+	ReasonIgnoreFile     = "ignore-file"     // .gitignore, .codeechoignore or git exclude rule
+	ReasonUnchanged      = "unchanged"       // Not part of the --since/--staged/--working-tree change set
+	ReasonOverBudget     = "over-budget"     // Omitted by --max-tokens
+)
+
+// PathDecision explains why a path is or isn't part of a scan.
+// Excluded directories are reported once; nothing below them is walked.
+type PathDecision struct {
+	Path     string `json:"path"`
+	Dir      bool   `json:"dir,omitempty"`
+	Included bool   `json:"included"`
+	Reason   string `json:"reason"`
+	Detail   string `json:"detail,omitempty"` // Rule, pattern or budget note behind Reason
+	Size     int64  `json:"size"`             // 0 for directories and for excluded paths of a --ref scan
+	Tokens   int    `json:"tokens"`           // Tokens of the packed content
+}
+
+// DecisionHandler receives a decision for every path a scan walks over
+type DecisionHandler func(PathDecision)
+
+// excludedDecision reports a path one of the filter rules left out
+func excludedDecision(relativePath string, dir bool, size int64, e exclusion) *PathDecision {
+	return &PathDecision{
+		Path:   relativePath,
+		Dir:    dir,
+		Reason: e.reason,
+		Detail: e.detail,
+		Size:   size,
+	}
+}
+
+// fileDecision reports a file that passed the filters and was loaded.
+// kept is false when the budget plan leaves it out of the pack.
+func fileDecision(file *FileInfo, kept bool, budget *BudgetPlan) *PathDecision {
+	decision := &PathDecision{
+		Path:     file.RelativePath,
+		Included: kept,
+		Reason:   ReasonIncluded,
+		Size:     file.Size,
+		Tokens:   file.TokenCount,
+	}
+
+	switch {
+	case !file.IsText:
+		decision.Reason = ReasonBinary
+		decision.Detail = "listed without content"
+	case file.BudgetAction == BudgetActionTruncated:
+		decision.Reason = ReasonTruncated
+	case file.BudgetAction == BudgetActionStructureOnly:
+		decision.Reason = ReasonStructureOnly
+	case !kept:
+		decision.Reason = ReasonOverBudget
+	}
+
+	if d, ok := budget.decision(file.RelativePath); ok {
+		decision.Detail = d.Reason
+	}
+	return decision
+}
@@ -1,6 +1,195 @@
 package scanner
 
-import "strings"
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// pathFilter holds the include/exclude rules for one walk.
+// Every scanner goes through it so they all agree on what is in a scan.
+type pathFilter struct {
+	rootPath string
+	opts     ScanOptions
+	ignore   *ignoreMatcher
+}
+
+func newPathFilter(rootPath string, opts ScanOptions) *pathFilter {
+	return &pathFilter{
+		rootPath: rootPath,
+		opts:     opts,
+		ignore:   newIgnoreMatcher(rootPath, opts.UseGitignore),
+	}
+}
+
+// exclusion says which rule keeps a path out of a scan. The zero value
+// means the path is in.
+type exclusion struct {
+	reason string // One of the Reason* constants
+	detail string // The directory name, pattern or ignore rule responsible
+}
+
+func (e exclusion) excluded() bool {
+	return e.reason != ""
+}
+
+// skipDir reports whether the walk should not descend into a directory.
+// Directories that are entered get their ignore files loaded, so rules
+// apply to everything below them.
+func (f *pathFilter) skipDir(path string, d fs.DirEntry) bool {
+	return f.explainDir(path, d).excluded()
+}
+
+// explainDir is skipDir with the reason a directory is skipped
+func (f *pathFilter) explainDir(path string, d fs.DirEntry) exclusion {
+	return f.explainDirName(path, d.Name())
+}
+
+// explainDirName is explainDir for a directory that may not exist
+func (f *pathFilter) explainDirName(path, name string) exclusion {
+	if e := f.explainDirRules(path, name); e.excluded() {
+		return e
+	}
+	f.ignore.loadDir(path)
+	return exclusion{}
+}
+
+// explainDirRules applies the directory rules without loading the
+// directory's own ignore files
+func (f *pathFilter) explainDirRules(path, name string) exclusion {
+	if shouldExcludeDir(name, f.opts.ExcludeDirs) {
+		return exclusion{ReasonExcludedDir, name}
+	}
+	if path != f.rootPath {
+		if rule := f.ignore.matchRule(path, true); rule != nil {
+			return exclusion{ReasonIgnoreFile, f.ruleSource(rule)}
+		}
+		if e := explainRelDir(f.relPath(path), name, f.opts); e.excluded() {
+			return e
+		}
+	}
+	return exclusion{}
+}
+
+// includeFile reports whether a (non-directory) walk entry belongs in the scan
+func (f *pathFilter) includeFile(path string) bool {
+	return !f.explainFile(path).excluded()
+}
+
+// explainFile is includeFile with the reason a file is left out
+func (f *pathFilter) explainFile(path string) exclusion {
+	if e := explainRelFile(f.relPath(path), f.opts); e.excluded() {
+		return e
+	}
+	if rule := f.ignore.matchRule(path, false); rule != nil {
+		return exclusion{ReasonIgnoreFile, f.ruleSource(rule)}
+	}
+	return exclusion{}
+}
+
+// explainMissing is explainFile for a path the walk never reached, such
+// as a deleted file: its parent directories are checked as the walk
+// would have, so nothing below an excluded directory gets in
+func (f *pathFilter) explainMissing(path string) exclusion {
+	parts := strings.Split(f.relPath(path), "/")
+	dir := f.rootPath
+	for _, name := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, name)
+		if e := f.explainDirName(dir, name); e.excluded() {
+			return e
+		}
+	}
+	return f.explainFile(path)
+}
+
+// ruleSource describes an ignore rule as file:line: pattern, with the
+// file relative to the scan root when it is inside it
+func (f *pathFilter) ruleSource(rule *ignoreRule) string {
+	file := rule.file
+	if rel, err := filepath.Rel(f.rootPath, file); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		file = filepath.ToSlash(rel)
+	}
+	return fmt.Sprintf("%s:%d: %s", file, rule.line, rule.text)
+}
+
+// explainRelDir applies the name and glob rules to a directory given by
+// its slash-separated path relative to the scan root
+func explainRelDir(rel, name string, opts ScanOptions) exclusion {
+	if shouldExcludeDir(name, opts.ExcludeDirs) {
+		return exclusion{ReasonExcludedDir, name}
+	}
+	if pattern, ok := firstMatchingPattern(rel, opts.IgnorePatterns); ok {
+		return exclusion{ReasonIgnorePattern, pattern}
+	}
+	return exclusion{}
+}
+
+// explainRelFile applies the extension and glob rules to a file given by
+// its slash-separated path relative to the scan root
+func explainRelFile(rel string, opts ScanOptions) exclusion {
+	if !shouldIncludeFile(rel, opts.IncludeExts) {
+		return exclusion{ReasonExtension, "not in --include-exts"}
+	}
+	if len(opts.IncludePatterns) > 0 && !matchAnyPattern(rel, opts.IncludePatterns) {
+		return exclusion{ReasonIncludePattern, "matches no --include pattern"}
+	}
+	if pattern, ok := firstMatchingPattern(rel, opts.IgnorePatterns); ok {
+		return exclusion{ReasonIgnorePattern, pattern}
+	}
+	return exclusion{}
+}
+
+// relPath returns the slash-separated path relative to the scan root,
+// which is what --include/--ignore patterns are written against
+func (f *pathFilter) relPath(path string) string {
+	rel, err := filepath.Rel(f.rootPath, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// ValidatePatterns checks that every pattern is a valid doublestar glob
+func ValidatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if !doublestar.ValidatePattern(normalizePattern(pattern)) {
+			return fmt.Errorf("invalid glob pattern: %q", pattern)
+		}
+	}
+	return nil
+}
+
+// matchAnyPattern reports whether rel matches one of the doublestar globs.
+// A pattern that matches a directory also matches everything below it.
+func matchAnyPattern(rel string, patterns []string) bool {
+	_, ok := firstMatchingPattern(rel, patterns)
+	return ok
+}
+
+// firstMatchingPattern returns the first of patterns that matches rel
+func firstMatchingPattern(rel string, patterns []string) (string, bool) {
+	for _, pattern := range patterns {
+		normalized := normalizePattern(pattern)
+		if ok, _ := doublestar.Match(normalized, rel); ok {
+			return pattern, true
+		}
+		if ok, _ := doublestar.Match(normalized+"/**", rel); ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// normalizePattern strips a leading "./" or "/" so patterns are always
+// relative to the scan root
+func normalizePattern(pattern string) string {
+	pattern = filepath.ToSlash(pattern)
+	pattern = strings.TrimPrefix(pattern, "./")
+	return strings.TrimPrefix(pattern, "/")
+}
 
 func shouldExcludeDir(dirName string, excludeDirs []string) bool {
 	for _, excluded := range excludeDirs {
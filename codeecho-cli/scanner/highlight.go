@@ -0,0 +1,222 @@
+package scanner
+
+import (
+	"sort"
+	"strings"
+)
+
+// Syntax highlighting reuses the comment lexer: it already knows where the
+// comments and literals of a language are, which is most of what a reader
+// needs. Keywords and numbers are found in the code between them.
+
+// Kinds of SyntaxSpan
+const (
+	SyntaxComment = "comment"
+	SyntaxString  = "string"
+	SyntaxKeyword = "keyword"
+	SyntaxNumber  = "number"
+)
+
+// SyntaxSpan is a highlighted range of content, in bytes
+type SyntaxSpan struct {
+	Start, End int
+	Kind       string
+}
+
+// highlightStyles lex languages that have no comments to remove
+var highlightStyles = map[string]*commentStyle{
+	"json": {quotes: []quoteStyle{{open: `"`, close: `"`, escape: true}}},
+}
+
+// keywords of the languages whose keywords are highlighted
+var keywords = map[string][]string{
+	"go": {
+		"break", "case", "chan", "const", "continue", "default", "defer", "else", "fallthrough", "for",
+		"func", "go", "goto", "if", "import", "interface", "map", "package", "range", "return",
+		"select", "struct", "switch", "type", "var", "nil", "true", "false", "iota",
+	},
+	"javascript": jsKeywords,
+	"jsx":        jsKeywords,
+	"typescript": tsKeywords,
+	"tsx":        tsKeywords,
+	"python": {
+		"False", "None", "True", "and", "as", "assert", "async", "await", "break", "class", "continue",
+		"def", "del", "elif", "else", "except", "finally", "for", "from", "global", "if", "import",
+		"in", "is", "lambda", "nonlocal", "not", "or", "pass", "raise", "return", "try", "while",
+		"with", "yield", "match", "case", "self",
+	},
+	"java": {
+		"abstract", "boolean", "break", "byte", "case", "catch", "char", "class", "continue", "default",
+		"do", "double", "else", "enum", "extends", "final", "finally", "float", "for", "if",
+		"implements", "import", "instanceof", "int", "interface", "long", "new", "package", "private",
+		"protected", "public", "record", "return", "short", "static", "super", "switch", "synchronized",
+		"this", "throw", "throws", "try", "var", "void", "volatile", "while", "null", "true", "false",
+	},
+	"c":   cKeywords,
+	"cpp": append(append([]string{}, cKeywords...), cppKeywords...),
+	"csharp": {
+		"abstract", "as", "async", "await", "base", "bool", "break", "case", "catch", "class", "const",
+		"continue", "default", "delegate", "do", "double", "else", "enum", "event", "false", "finally",
+		"float", "for", "foreach", "if", "in", "int", "interface", "internal", "is", "long", "namespace",
+		"new", "null", "object", "out", "override", "private", "protected", "public", "readonly", "record",
+		"ref", "return", "sealed", "static", "string", "struct", "switch", "this", "throw", "true",
+		"try", "using", "var", "virtual", "void", "while",
+	},
+	"rust": {
+		"as", "async", "await", "break", "const", "continue", "crate", "dyn", "else", "enum", "extern",
+		"false", "fn", "for", "if", "impl", "in", "let", "loop", "match", "mod", "move", "mut", "pub",
+		"ref", "return", "self", "Self", "static", "struct", "super", "trait", "true", "type", "unsafe",
+		"use", "where", "while",
+	},
+	"ruby": {
+		"BEGIN", "END", "alias", "and", "begin", "break", "case", "class", "def", "do",
+		"else", "elsif", "end", "ensure", "false", "for", "if", "in", "module", "next", "nil", "not",
+		"or", "redo", "rescue", "retry", "return", "self", "super", "then", "true", "undef", "unless",
+		"until", "when", "while", "yield",
+	},
+	"php": {
+		"abstract", "array", "as", "break", "case", "catch", "class", "const", "continue", "default",
+		"do", "echo", "else", "elseif", "extends", "false", "final", "finally", "fn", "for", "foreach",
+		"function", "if", "implements", "interface", "namespace", "new", "null", "private", "protected",
+		"public", "require", "require_once", "return", "static", "switch", "this", "throw", "trait",
+		"true", "try", "use", "while",
+	},
+	"kotlin": {
+		"as", "break", "class", "continue", "do", "else", "false", "for", "fun", "if", "import", "in",
+		"interface", "is", "null", "object", "override", "package", "private", "public", "return",
+		"super", "this", "throw", "true", "try", "typealias", "val", "var", "when", "while",
+	},
+	"swift": {
+		"as", "break", "case", "catch", "class", "continue", "default", "defer", "do", "else", "enum",
+		"extension", "false", "for", "func", "guard", "if", "import", "in", "init", "let", "nil",
+		"private", "protocol", "public", "return", "self", "static", "struct", "switch", "throw",
+		"throws", "true", "try", "var", "while",
+	},
+	"shell": shKeywords,
+	"bash":  shKeywords,
+	"json":  {"true", "false", "null"},
+}
+
+var (
+	jsKeywords = []string{
+		"async", "await", "break", "case", "catch", "class", "const", "continue", "debugger", "default",
+		"delete", "do", "else", "export", "extends", "false", "finally", "for", "from", "function", "if",
+		"import", "in", "instanceof", "let", "new", "null", "of", "return", "static", "super", "switch",
+		"this", "throw", "true", "try", "typeof", "undefined", "var", "void", "while", "yield",
+	}
+	tsKeywords = append(append([]string{}, jsKeywords...),
+		"abstract", "any", "as", "boolean", "declare", "enum", "implements", "interface", "keyof",
+		"namespace", "never", "number", "private", "protected", "public", "readonly", "string", "type",
+		"unknown",
+	)
+	cKeywords = []string{
+		"auto", "break", "case", "char", "const", "continue", "default", "do", "double", "else", "enum",
+		"extern", "float", "for", "goto", "if", "inline", "int", "long", "register", "return", "short",
+		"signed", "sizeof", "static", "struct", "switch", "typedef", "union", "unsigned", "void",
+		"volatile", "while", "NULL",
+	}
+	cppKeywords = []string{
+		"auto", "bool", "catch", "class", "constexpr", "delete", "false", "friend", "namespace", "new",
+		"nullptr", "operator", "private", "protected", "public", "template", "this", "throw", "true",
+		"try", "typename", "using", "virtual",
+	}
+	shKeywords = []string{
+		"case", "do", "done", "elif", "else", "esac", "export", "fi", "for", "function", "if", "in",
+		"local", "return", "then", "until", "while",
+	}
+)
+
+// keywordSets indexes keywords by language
+var keywordSets = func() map[string]map[string]bool {
+	sets := make(map[string]map[string]bool, len(keywords))
+	for language, words := range keywords {
+		set := make(map[string]bool, len(words))
+		for _, word := range words {
+			set[word] = true
+		}
+		sets[language] = set
+	}
+	return sets
+}()
+
+// Highlight returns the comments, literals, keywords and numbers of
+// content in source order. Spans don't overlap; a literal inside another
+// (a string in a template literal substitution) is part of the outer one.
+// Languages without a lexer have no spans.
+func Highlight(content, language string) []SyntaxSpan {
+	style, ok := commentStyles[language]
+	if !ok {
+		if style, ok = highlightStyles[language]; !ok {
+			return nil
+		}
+	}
+
+	l := &commentLexer{src: content, style: style, yamlDoc: -1}
+	var spans []SyntaxSpan
+	if strings.HasPrefix(content, "#!") && !strings.HasPrefix(content, "#![") {
+		l.pos = lineEnd(content, 0)
+		spans = append(spans, SyntaxSpan{Start: 0, End: l.pos, Kind: SyntaxComment})
+	}
+	l.code(false)
+	if style.features&lexDocstrings != 0 {
+		l.findDocstrings()
+	}
+
+	for _, span := range l.spans {
+		kind := SyntaxComment
+		if span.docstring {
+			kind = SyntaxString
+		}
+		spans = append(spans, SyntaxSpan{Start: span.start, End: span.end, Kind: kind})
+	}
+	for _, span := range l.literals {
+		spans = append(spans, SyntaxSpan{Start: span.start, End: span.end, Kind: SyntaxString})
+	}
+
+	// Outer spans first, so the inner ones can be dropped
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i].Start != spans[j].Start {
+			return spans[i].Start < spans[j].Start
+		}
+		return spans[i].End > spans[j].End
+	})
+
+	var result []SyntaxSpan
+	pos := 0
+	for _, span := range spans {
+		if span.Start < pos || span.End <= span.Start {
+			continue
+		}
+		result = append(result, words(content, pos, span.Start, keywordSets[language])...)
+		result = append(result, span)
+		pos = span.End
+	}
+	return append(result, words(content, pos, len(content), keywordSets[language])...)
+}
+
+// words finds the keywords and numbers of code between start and end
+func words(src string, start, end int, keywords map[string]bool) []SyntaxSpan {
+	var spans []SyntaxSpan
+	for i := start; i < end; {
+		if !isIdentByte(src[i]) {
+			i++
+			continue
+		}
+
+		j := i
+		for j < end && isIdentByte(src[j]) {
+			j++
+		}
+		// Decimal points and exponent signs belong to the number
+		if src[i] >= '0' && src[i] <= '9' {
+			for j < end && (isIdentByte(src[j]) || src[j] == '.' || (src[j] == '-' || src[j] == '+') && strings.ContainsRune("eE", rune(src[j-1]))) {
+				j++
+			}
+			spans = append(spans, SyntaxSpan{Start: i, End: j, Kind: SyntaxNumber})
+		} else if keywords[src[i:j]] {
+			spans = append(spans, SyntaxSpan{Start: i, End: j, Kind: SyntaxKeyword})
+		}
+		i = j
+	}
+	return spans
+}
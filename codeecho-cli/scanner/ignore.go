@@ -0,0 +1,360 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Names of the per-directory ignore files picked up during a walk.
+// .codeechoignore uses gitignore syntax and is applied after .gitignore,
+// so it can override (or re-include) anything git ignores.
+const (
+	gitignoreFile      = ".gitignore"
+	codeechoIgnoreFile = ".codeechoignore"
+)
+
+// ignoreRule is a single compiled line from a gitignore-style file
+type ignoreRule struct {
+	base     string   // Absolute slash-separated directory the rule is relative to
+	segments []string // Pattern split on "/" ("**" matches any number of segments)
+	negate   bool     // Line started with "!"
+	dirOnly  bool     // Line ended with "/"
+
+	// Where the rule came from, for explaining why a path is ignored
+	file string
+	line int
+	text string
+}
+
+// ignoreMatcher implements gitignore semantics for a scan.
+// Rules are kept in precedence order (global excludes, .git/info/exclude,
+// then per-directory files from the outermost inwards); the last matching
+// rule wins, exactly like git.
+type ignoreMatcher struct {
+	useGitignore bool
+	rules        []ignoreRule
+	loaded       map[string]bool // Directories whose ignore files were read
+}
+
+// newIgnoreMatcher prepares a matcher for rootPath.
+// When useGitignore is set, repository-wide sources (global excludes file,
+// .git/info/exclude and .gitignore files between the work tree root and
+// rootPath) are loaded up front. .codeechoignore files are always honored.
+func newIgnoreMatcher(rootPath string, useGitignore bool) *ignoreMatcher {
+	absRoot, err := filepath.Abs(rootPath)
+	if err != nil {
+		absRoot = rootPath
+	}
+
+	workTree, gitDir := findGitRepository(absRoot)
+	m := newRepositoryIgnoreMatcher(workTree, gitDir, useGitignore)
+
+	// Ancestors of the scan root still contribute their ignore files
+	if workTree != "" {
+		for _, dir := range ancestorsBetween(workTree, absRoot) {
+			m.loadDir(dir)
+		}
+	}
+
+	return m
+}
+
+// newRepositoryIgnoreMatcher loads only the sources that don't live in
+// the work tree (global excludes and .git/info/exclude), for scans that
+// read per-directory ignore files from somewhere else, such as a commit
+func newRepositoryIgnoreMatcher(workTree, gitDir string, useGitignore bool) *ignoreMatcher {
+	m := &ignoreMatcher{
+		useGitignore: useGitignore,
+		loaded:       make(map[string]bool),
+	}
+
+	if useGitignore && workTree != "" {
+		if excludesFile := globalExcludesFile(gitDir); excludesFile != "" {
+			m.loadFile(excludesFile, workTree)
+		}
+		m.loadFile(filepath.Join(gitDir, "info", "exclude"), workTree)
+	}
+	return m
+}
+
+// loadDir reads the ignore files of dir (once). Walks call it when they
+// enter a directory, so nested rules are in place before its children
+// are matched.
+func (m *ignoreMatcher) loadDir(dir string) {
+	m.loadDirFrom(dir, os.ReadFile)
+}
+
+// loadDirFrom is loadDir with the files read by read, which fails for
+// files that don't exist
+func (m *ignoreMatcher) loadDirFrom(dir string, read func(file string) ([]byte, error)) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		absDir = dir
+	}
+	if m.loaded[absDir] {
+		return
+	}
+	m.loaded[absDir] = true
+
+	if m.useGitignore {
+		m.loadFileFrom(filepath.Join(absDir, gitignoreFile), absDir, read)
+	}
+	m.loadFileFrom(filepath.Join(absDir, codeechoIgnoreFile), absDir, read)
+}
+
+// loadFile appends the rules from an ignore file, silently skipping
+// files that don't exist or can't be read
+func (m *ignoreMatcher) loadFile(file, baseDir string) {
+	m.loadFileFrom(file, baseDir, os.ReadFile)
+}
+
+func (m *ignoreMatcher) loadFileFrom(file, baseDir string, read func(file string) ([]byte, error)) {
+	data, err := read(file)
+	if err != nil {
+		return
+	}
+
+	base := filepath.ToSlash(baseDir)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; sc.Scan(); line++ {
+		if rule, ok := parseIgnoreLine(sc.Text(), base); ok {
+			rule.file, rule.line = file, line
+			rule.text = strings.TrimSpace(sc.Text())
+			m.rules = append(m.rules, rule)
+		}
+	}
+}
+
+// match reports whether the path is ignored by the loaded rules.
+// Callers are expected to prune ignored directories, so only the path
+// itself (not its parents) is checked here.
+func (m *ignoreMatcher) match(p string, isDir bool) bool {
+	return m.matchRule(p, isDir) != nil
+}
+
+// matchRule returns the rule that ignores the path, or nil when it isn't
+// ignored (no rule matched, or the last match was a negation)
+func (m *ignoreMatcher) matchRule(p string, isDir bool) *ignoreRule {
+	absPath, err := filepath.Abs(p)
+	if err != nil {
+		absPath = p
+	}
+	slashPath := filepath.ToSlash(absPath)
+
+	var ignoredBy *ignoreRule
+	for i := range m.rules {
+		rule := &m.rules[i]
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if !strings.HasPrefix(slashPath, rule.base+"/") {
+			continue
+		}
+		rel := strings.TrimPrefix(slashPath, rule.base+"/")
+		if matchSegments(rule.segments, strings.Split(rel, "/")) {
+			ignoredBy = rule
+			if rule.negate {
+				ignoredBy = nil
+			}
+		}
+	}
+	return ignoredBy
+}
+
+// parseIgnoreLine compiles one line of a gitignore file.
+// See gitignore(5) for the syntax being implemented.
+func parseIgnoreLine(line, base string) (ignoreRule, bool) {
+	line = strings.TrimSuffix(line, "\r")
+
+	// Trailing spaces are ignored unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{base: strings.TrimSuffix(base, "/")}
+
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	// A slash at the start or in the middle anchors the pattern to base;
+	// otherwise it matches at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	segments := strings.Split(line, "/")
+	for i, seg := range segments {
+		segments[i] = translateGlob(seg)
+	}
+	if !anchored {
+		segments = append([]string{"**"}, segments...)
+	}
+	rule.segments = segments
+
+	return rule, true
+}
+
+// translateGlob converts gitignore glob syntax to path.Match syntax
+func translateGlob(seg string) string {
+	if seg == "**" {
+		return seg
+	}
+	// Any other run of stars behaves like a single "*" within a segment
+	for strings.Contains(seg, "**") {
+		seg = strings.ReplaceAll(seg, "**", "*")
+	}
+	return strings.ReplaceAll(seg, "[!", "[^")
+}
+
+// matchSegments matches pattern segments against path segments.
+// "**" matches zero or more whole segments; a trailing "**" only
+// matches something inside the directory, not the directory itself.
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return len(parts) > 0
+			}
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], parts[0]); err != nil || !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// findGitRepository walks up from dir looking for a .git entry.
+// It returns the work tree root and the git directory, or empty strings
+// when dir is not inside a repository.
+func findGitRepository(dir string) (workTree, gitDir string) {
+	for current := dir; ; {
+		candidate := filepath.Join(current, ".git")
+		if info, err := os.Stat(candidate); err == nil {
+			if info.IsDir() {
+				return current, candidate
+			}
+			// Worktrees and submodules use a "gitdir: <path>" file
+			if data, err := os.ReadFile(candidate); err == nil {
+				target := strings.TrimSpace(strings.TrimPrefix(string(data), "gitdir:"))
+				if !filepath.IsAbs(target) {
+					target = filepath.Join(current, target)
+				}
+				return current, target
+			}
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return "", ""
+		}
+		current = parent
+	}
+}
+
+// ancestorsBetween returns the directories from top down to (but not
+// including) dir, outermost first
+func ancestorsBetween(top, dir string) []string {
+	var dirs []string
+	for current := dir; current != top; {
+		parent := filepath.Dir(current)
+		if parent == current {
+			return nil // dir is not below top
+		}
+		current = parent
+		dirs = append([]string{current}, dirs...)
+	}
+	return dirs
+}
+
+// globalExcludesFile resolves core.excludesFile the way git does:
+// repository config, then user config, then the XDG default location
+func globalExcludesFile(gitDir string) string {
+	home, _ := os.UserHomeDir()
+	xdgConfig := os.Getenv("XDG_CONFIG_HOME")
+	if xdgConfig == "" && home != "" {
+		xdgConfig = filepath.Join(home, ".config")
+	}
+
+	configFiles := []string{filepath.Join(gitDir, "config")}
+	if home != "" {
+		configFiles = append(configFiles, filepath.Join(home, ".gitconfig"))
+	}
+	if xdgConfig != "" {
+		configFiles = append(configFiles, filepath.Join(xdgConfig, "git", "config"))
+	}
+
+	for _, file := range configFiles {
+		if value := readGitConfigValue(file, "core", "excludesfile"); value != "" {
+			if strings.HasPrefix(value, "~/") && home != "" {
+				value = filepath.Join(home, value[2:])
+			}
+			return value
+		}
+	}
+
+	if xdgConfig != "" {
+		return filepath.Join(xdgConfig, "git", "ignore")
+	}
+	return ""
+}
+
+// readGitConfigValue does a minimal INI-style lookup of section.key.
+// Keys are case-insensitive, matching git's own config rules.
+func readGitConfigValue(file, section, key string) string {
+	f, err := os.Open(file)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	inSection := false
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			name := strings.Trim(line, "[]")
+			inSection = strings.EqualFold(strings.TrimSpace(name), section)
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		name, value, found := strings.Cut(line, "=")
+		if found && strings.EqualFold(strings.TrimSpace(name), key) {
+			return strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return ""
+}
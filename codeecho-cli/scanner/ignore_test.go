@@ -0,0 +1,245 @@
+package scanner
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseIgnoreLine(t *testing.T) {
+	tests := []struct {
+		line string
+		ok   bool
+		want ignoreRule
+	}{
+		{line: "", ok: false},
+		{line: "   ", ok: false},
+		{line: "# comment", ok: false},
+		{line: "/", ok: false},
+		{line: "*.log", ok: true, want: ignoreRule{segments: []string{"**", "*.log"}}},
+		{line: "*.log   ", ok: true, want: ignoreRule{segments: []string{"**", "*.log"}}},
+		{line: `trailing\ `, ok: true, want: ignoreRule{segments: []string{"**", `trailing\ `}}},
+		{line: "*.log\r", ok: true, want: ignoreRule{segments: []string{"**", "*.log"}}},
+		{line: "!keep.log", ok: true, want: ignoreRule{segments: []string{"**", "keep.log"}, negate: true}},
+		{line: `\!bang`, ok: true, want: ignoreRule{segments: []string{"**", "!bang"}}},
+		{line: `\#hash`, ok: true, want: ignoreRule{segments: []string{"**", "#hash"}}},
+		{line: "build/", ok: true, want: ignoreRule{segments: []string{"**", "build"}, dirOnly: true}},
+		{line: "/build", ok: true, want: ignoreRule{segments: []string{"build"}}},
+		{line: "/build/", ok: true, want: ignoreRule{segments: []string{"build"}, dirOnly: true}},
+		{line: "docs/*.md", ok: true, want: ignoreRule{segments: []string{"docs", "*.md"}}},
+		{line: "**/logs", ok: true, want: ignoreRule{segments: []string{"**", "logs"}}},
+		{line: "logs/**", ok: true, want: ignoreRule{segments: []string{"logs", "**"}}},
+		{line: "a/**/b", ok: true, want: ignoreRule{segments: []string{"a", "**", "b"}}},
+		{line: "a***b", ok: true, want: ignoreRule{segments: []string{"**", "a*b"}}},
+		{line: "[!a]*", ok: true, want: ignoreRule{segments: []string{"**", "[^a]*"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, ok := parseIgnoreLine(tt.line, "/repo/")
+			if ok != tt.ok {
+				t.Fatalf("got ok %t, want %t", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			tt.want.base = "/repo"
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchSegments(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"**/*.log", "a.log", true},
+		{"**/*.log", "x/y/a.log", true},
+		{"**/*.log", "a.txt", false},
+		{"docs/*.md", "docs/a.md", true},
+		{"docs/*.md", "docs/x/a.md", false},
+		{"docs/*.md", "src/docs/a.md", false},
+		{"logs/**", "logs", false},
+		{"logs/**", "logs/a", true},
+		{"logs/**", "logs/a/b", true},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**/b", "a/x/y/c", false},
+		{"**", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			var parts []string
+			if tt.path != "" {
+				parts = strings.Split(tt.path, "/")
+			}
+			if got := matchSegments(strings.Split(tt.pattern, "/"), parts); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+// ignored reports whether a walk would leave out rel (a slash-separated
+// path below root; a trailing "/" marks a directory). Like a walk, it
+// loads each directory's ignore files on the way down and stops at the
+// first ignored parent.
+func ignored(m *ignoreMatcher, root, rel string) bool {
+	isDir := strings.HasSuffix(rel, "/")
+	parts := strings.Split(strings.TrimSuffix(rel, "/"), "/")
+
+	dir := root
+	m.loadDir(dir)
+	for i, part := range parts {
+		dir = filepath.Join(dir, part)
+		last := i == len(parts)-1
+		if m.match(dir, !last || isDir) {
+			return true
+		}
+		if !last {
+			m.loadDir(dir)
+		}
+	}
+	return false
+}
+
+func TestIgnoreMatcher(t *testing.T) {
+	// Keep the user's global excludes out of the test
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+
+	root := t.TempDir()
+	files := map[string]string{
+		".git/info/exclude":     "secret.txt\n",
+		".gitignore":            "*.log\nbuild/\n/top.txt\ndocs/*.md\n!docs/keep.md\ncache/**\n",
+		"sub/.gitignore":        "!*.log\n/local\n",
+		"sub/deeper/.gitignore": "# reset nothing\n*.tmp\n",
+		".codeechoignore":       "vendor/\n!build/\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path string
+		want bool
+		git  bool // Check against git (false where .codeechoignore decides)
+	}{
+		{"a.log", true, true},
+		{"x/y/a.log", true, true},
+		{"a.txt", false, true},
+		{"sub/a.log", false, true},
+		{"sub/deeper/a.log", false, true},
+		{"sub/deeper/a.tmp", true, true},
+		{"a.tmp", false, true},
+		{"sub/local", true, true},
+		{"sub/x/local", false, true},
+		{"local", false, true},
+		{"top.txt", true, true},
+		{"sub/top.txt", false, true},
+		{"docs/a.md", true, true},
+		{"docs/keep.md", false, true},
+		{"docs/x/a.md", false, true},
+		{"cache/", false, true},
+		{"cache/a", true, true},
+		{"cache/x/y", true, true},
+		{"secret.txt", true, true},
+		{"sub/secret.txt", true, true},
+		{"build", false, true}, // A file, not the directory
+		{"vendor/", true, false},
+		{"vendor/x.go", true, false},
+		{"build/", false, false},
+		{"build/out.bin", false, false},
+	}
+
+	m := newIgnoreMatcher(root, true)
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := ignored(m, root, tt.path); got != tt.want {
+				t.Errorf("got ignored %t, want %t", got, tt.want)
+			}
+		})
+	}
+
+	// Check the gitignore semantics against git itself
+	if _, err := exec.LookPath("git"); err != nil {
+		return
+	}
+	if out, err := exec.Command("git", "init", "-q", root).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+	// git init keeps the existing exclude file, but be sure
+	exclude := filepath.Join(root, ".git", "info", "exclude")
+	if err := os.WriteFile(exclude, []byte(files[".git/info/exclude"]), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		if !tt.git {
+			continue
+		}
+		t.Run("git "+tt.path, func(t *testing.T) {
+			// git reads a trailing "/" literally; it needs the directory
+			path := strings.TrimSuffix(tt.path, "/")
+			if path != tt.path {
+				if err := os.MkdirAll(filepath.Join(root, path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cmd := exec.Command("git", "check-ignore", "-q", "--no-index", path)
+			cmd.Dir = root
+			err := cmd.Run()
+			if exit, ok := err.(*exec.ExitError); err != nil && (!ok || exit.ExitCode() != 1) {
+				t.Fatalf("git check-ignore: %v", err)
+			}
+			if gitIgnored := err == nil; gitIgnored != tt.want {
+				t.Errorf("git says ignored %t, want %t", gitIgnored, tt.want)
+			}
+		})
+	}
+}
+
+func TestIgnoreMatcherWithoutGitignore(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, ".git", "info"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		".git/info/exclude": "secret.txt\n",
+		".gitignore":        "*.log\n",
+		".codeechoignore":   "*.tmp\n",
+	} {
+		if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(name)), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := newIgnoreMatcher(root, false)
+	for path, want := range map[string]bool{
+		"a.log":      false,
+		"secret.txt": false,
+		"a.tmp":      true,
+	} {
+		if got := ignored(m, root, path); got != want {
+			t.Errorf("%s: got ignored %t, want %t", path, got, want)
+		}
+	}
+}
@@ -31,11 +31,75 @@ func detectLanguage(path string) string {
 		".yaml": "yaml",
 		".toml": "toml",
 		".xml":  "xml",
+
+		".mjs":        "javascript",
+		".cjs":        "javascript",
+		".mts":        "typescript",
+		".cts":        "typescript",
+		".cc":         "cpp",
+		".cxx":        "cpp",
+		".hpp":        "cpp",
+		".hh":         "cpp",
+		".cs":         "csharp",
+		".swift":      "swift",
+		".kt":         "kotlin",
+		".kts":        "kotlin",
+		".scala":      "scala",
+		".groovy":     "groovy",
+		".gradle":     "groovy",
+		".dart":       "dart",
+		".zig":        "zig",
+		".proto":      "protobuf",
+		".sh":         "shell",
+		".bash":       "bash",
+		".zsh":        "shell",
+		".ps1":        "powershell",
+		".sql":        "sql",
+		".lua":        "lua",
+		".pl":         "perl",
+		".pm":         "perl",
+		".r":          "r",
+		".hs":         "haskell",
+		".ex":         "elixir",
+		".exs":        "elixir",
+		".clj":        "clojure",
+		".cljs":       "clojure",
+		".erl":        "erlang",
+		".nim":        "nim",
+		".scss":       "scss",
+		".less":       "less",
+		".htm":        "html",
+		".vue":        "vue",
+		".svelte":     "svelte",
+		".ini":        "ini",
+		".cfg":        "ini",
+		".conf":       "ini",
+		".tf":         "hcl",
+		".hcl":        "hcl",
+		".graphql":    "graphql",
+		".gql":        "graphql",
+		".dockerfile": "dockerfile",
+		".mk":         "makefile",
+		".cmake":      "cmake",
 	}
 
 	if lang, exists := langMap[ext]; exists {
 		return lang
 	}
+
+	// Build files are recognised by name
+	switch name := strings.ToLower(filepath.Base(path)); {
+	case name == "dockerfile" || strings.HasPrefix(name, "dockerfile."):
+		return "dockerfile"
+	case name == "makefile" || name == "gnumakefile":
+		return "makefile"
+	case name == "cmakelists.txt":
+		return "cmake"
+	case name == "gemfile" || name == "rakefile":
+		return "ruby"
+	case name == "jenkinsfile":
+		return "groovy"
+	}
 	return ""
 }
 
@@ -0,0 +1,137 @@
+package scanner
+
+import (
+	"io/fs"
+	"runtime"
+	"sync"
+)
+
+// DefaultMaxInFlightBytes bounds the file bytes a parallel scan holds
+// between reading a file and handing it to the file handler
+const DefaultMaxInFlightBytes int64 = 256 << 20
+
+// fileJob is one file moving through the pipeline. Jobs reach the
+// consumer in walk order no matter which worker finishes first.
+type fileJob struct {
+	path string
+	info fs.FileInfo
+	size int64 // Bytes reserved against the in-flight limit
+
+	// Filled by a worker before done is closed
+	file     *FileInfo // nil when the file is left out of the pack
+	errors   []ScanError
+	decision *PathDecision // Set when the scan explains its decisions
+
+	done chan struct{}
+}
+
+// filePipeline reads and processes files on a pool of workers while the
+// walk continues, and returns them in the order they were submitted
+type filePipeline struct {
+	work    chan *fileJob
+	ordered chan *fileJob
+	limiter *byteLimiter
+	workers sync.WaitGroup
+}
+
+// newFilePipeline starts jobs workers that run load on each submitted
+// file. jobs <= 0 uses one worker per CPU.
+func newFilePipeline(jobs int, maxInFlight int64, load func(*fileJob)) *filePipeline {
+	if jobs <= 0 {
+		jobs = runtime.GOMAXPROCS(0)
+	}
+	if maxInFlight <= 0 {
+		maxInFlight = DefaultMaxInFlightBytes
+	}
+
+	p := &filePipeline{
+		work:    make(chan *fileJob),
+		ordered: make(chan *fileJob, jobs*4),
+		limiter: newByteLimiter(maxInFlight),
+	}
+	for i := 0; i < jobs; i++ {
+		p.workers.Add(1)
+		go func() {
+			defer p.workers.Done()
+			for job := range p.work {
+				load(job)
+				close(job.done)
+			}
+		}()
+	}
+	return p
+}
+
+// submit queues a file, blocking while too many bytes are in flight
+func (p *filePipeline) submit(path string, info fs.FileInfo) {
+	job := &fileJob{path: path, info: info, done: make(chan struct{})}
+	job.size = p.limiter.acquire(info.Size())
+	p.ordered <- job
+	p.work <- job
+}
+
+// fail queues an error found by the walk, keeping it in walk order
+func (p *filePipeline) fail(err ScanError) {
+	job := &fileJob{path: err.Path, errors: []ScanError{err}, done: make(chan struct{})}
+	close(job.done)
+	p.ordered <- job
+}
+
+// skip queues the decision for a path the walk left out
+func (p *filePipeline) skip(decision *PathDecision) {
+	job := &fileJob{path: decision.Path, decision: decision, done: make(chan struct{})}
+	close(job.done)
+	p.ordered <- job
+}
+
+// close is called by the walk once every file was submitted
+func (p *filePipeline) close() {
+	close(p.work)
+	p.workers.Wait()
+	close(p.ordered)
+}
+
+// drain hands each finished job to emit in submission order. The
+// caller must consume every job, or the walk blocks.
+func (p *filePipeline) drain(emit func(*fileJob)) {
+	for job := range p.ordered {
+		<-job.done
+		emit(job)
+		p.limiter.release(job.size)
+	}
+}
+
+// byteLimiter is a counting semaphore over bytes
+type byteLimiter struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int64
+	used  int64
+}
+
+func newByteLimiter(limit int64) *byteLimiter {
+	l := &byteLimiter{limit: limit}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire reserves n bytes and returns the amount reserved. A file
+// larger than the whole limit is admitted alone rather than never.
+func (l *byteLimiter) acquire(n int64) int64 {
+	n = min(max(n, 0), l.limit)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.used > 0 && l.used+n > l.limit {
+		l.cond.Wait()
+	}
+	l.used += n
+	return n
+}
+
+func (l *byteLimiter) release(n int64) {
+	l.mu.Lock()
+	l.used -= n
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
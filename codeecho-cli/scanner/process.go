@@ -1,56 +1,64 @@
 package scanner
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"regexp"
 	"strings"
+
+	"github.com/opskraken/codeecho-cli/utils"
 )
 
-func processFileContent(content, language string, opts ScanOptions) string {
-	processed := content
+// processFileContent applies the content options to a file's raw content
+// and fills in its Content and what is derived from it
+func processFileContent(file *FileInfo, content string, opts ScanOptions) {
+	language := file.Language
+	file.Hash = ContentHash(content)
+
+	// Secrets go first so findings point at lines of the original file
+	processed, secrets := opts.Secrets.Redact(content)
+	for i := range secrets {
+		secrets[i].Path = file.RelativePath
+	}
+	file.Secrets = secrets
 
+	// Before comment removal, so doc comments can be kept with the signatures
+	if opts.Compress == CompressSignatures {
+		if compressed, ok := compressSignatures(processed, language); ok {
+			processed = compressed
+			file.Compression = string(CompressSignatures)
+		}
+	}
 	if opts.RemoveComments {
-		processed = stripComments(processed, language)
+		processed = stripComments(processed, language, opts.KeepDocComments)
 	}
 	if opts.RemoveEmptyLines {
 		processed = stripEmptyLines(processed)
 	}
-	if opts.CompressCode {
+	if opts.Compress == CompressWhitespace {
 		processed = compressWhitespace(processed, language)
 	}
 
-	return processed
+	file.Content = processed
+	file.LineCount = utils.CountLines(processed)
+	file.TokenCount = countTokens(processed, opts)
 }
 
-// stripComments removes comments based on file language
-func stripComments(content, language string) string {
-	switch language {
-	case "go", "javascript", "typescript", "java", "cpp", "c", "rust", "php":
-		// Remove single-line comments //
-		re1 := regexp.MustCompile(`//.*$`)
-		content = re1.ReplaceAllString(content, "")
-
-		// Remove multi-line comments /* */
-		re2 := regexp.MustCompile(`/\*[\s\S]*?\*/`)
-		content = re2.ReplaceAllString(content, "")
-
-	case "python", "ruby":
-		// Remove # comments
-		re := regexp.MustCompile(`#.*$`)
-		content = re.ReplaceAllString(content, "")
-
-	case "html", "xml":
-		// Remove HTML/XML comments <!-- -->
-		re := regexp.MustCompile(`<!--[\s\S]*?-->`)
-		content = re.ReplaceAllString(content, "")
+// ContentHash identifies a file's content: the first 16 hex digits of its
+// SHA-256. Packs record it so edits can be checked against the file they
+// were made for.
+func ContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:8])
+}
 
-	case "css":
-		// Remove CSS comments /* */
-		re := regexp.MustCompile(`/\*[\s\S]*?\*/`)
-		content = re.ReplaceAllString(content, "")
+// countTokens measures content with the configured tokenizer (0 if none)
+func countTokens(content string, opts ScanOptions) int {
+	if opts.Tokenizer == nil {
+		return 0
 	}
-
-	return content
+	return opts.Tokenizer.Count(content)
 }
 
 // stripEmptyLines removes empty lines from content
@@ -0,0 +1,44 @@
+package scanner
+
+import (
+	"time"
+
+	"github.com/opskraken/codeecho-cli/utils"
+)
+
+// NewScanReport summarizes a finished scan from its statistics, which
+// carry the errors the scanner recorded. scanErr is the error Scan
+// returned, if any. Phases and durations are left for the caller.
+func NewScanReport(stats *StreamingStats, scanErr error) *ScanReport {
+	report := &ScanReport{
+		Stats:   stats,
+		Errors:  []ScanError{},
+		Phases:  []PhaseTiming{},
+		Success: scanErr == nil,
+	}
+	if stats == nil {
+		return report
+	}
+
+	skipped := make(map[string]bool)
+	for _, e := range stats.Errors {
+		report.Errors = append(report.Errors, e)
+		if !e.Skipped {
+			report.Success = false
+			continue
+		}
+		report.WarningCount++
+		skipped[e.Path] = true
+	}
+	report.SkippedFiles = len(skipped)
+	return report
+}
+
+// NewPhaseTiming records how long a phase took
+func NewPhaseTiming(phase string, d time.Duration) PhaseTiming {
+	return PhaseTiming{
+		Phase:      phase,
+		Duration:   utils.FormatDuration(d),
+		DurationMs: d.Milliseconds(),
+	}
+}
@@ -0,0 +1,327 @@
+package scanner
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/opskraken/codeecho-cli/gitrepo"
+	"github.com/opskraken/codeecho-cli/utils"
+)
+
+// RevisionScanner streams the files of a git commit instead of the
+// working tree. Blobs are read straight from the object store, so the
+// checkout is never touched.
+type RevisionScanner struct {
+	repo        *gitrepo.Repository
+	commit      *gitrepo.Commit
+	prefix      string // Slash-separated scan root relative to the work tree
+	opts        ScanOptions
+	filter      *pathFilter // Ignore files are read from the commit, not the work tree
+	fileHandler func(*FileInfo) error
+	treeWriter  func([]string) error
+
+	progressCallback ProgressCallback
+	errors           []ScanError
+
+	stats  *StreamingStats
+	budget *BudgetPlan
+
+	decisionHandler DecisionHandler
+}
+
+// revisionEntry is a file found while walking a tree
+type revisionEntry struct {
+	relPath string // Slash-separated, relative to the scan root
+	hash    gitrepo.Hash
+
+	// Set instead of hash for a path the filters left out, when the
+	// scan explains its decisions
+	excluded *PathDecision
+}
+
+// NewRevisionScanner scans commit, limited to rootPath when it is a
+// subdirectory of the repository's work tree
+func NewRevisionScanner(repo *gitrepo.Repository, commit *gitrepo.Commit, rootPath string, opts ScanOptions, fileHandler func(*FileInfo) error) (*RevisionScanner, error) {
+	rel, err := filepath.Rel(repo.WorkTree, rootPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("%s is outside the repository at %s", rootPath, repo.WorkTree)
+	}
+	if rel == "." {
+		rel = ""
+	}
+
+	// Paths are matched as if the commit were checked out
+	workTree, gitDir := findGitRepository(repo.WorkTree)
+	filter := &pathFilter{
+		rootPath: rootPath,
+		opts:     opts,
+		ignore:   newRepositoryIgnoreMatcher(workTree, gitDir, opts.UseGitignore),
+	}
+
+	return &RevisionScanner{
+		repo:        repo,
+		commit:      commit,
+		prefix:      filepath.ToSlash(rel),
+		opts:        opts,
+		filter:      filter,
+		fileHandler: fileHandler,
+		errors:      []ScanError{},
+		stats:       newStreamingStats(opts),
+	}, nil
+}
+
+func (r *RevisionScanner) SetProgressCallback(callback ProgressCallback) {
+	r.progressCallback = callback
+}
+
+func (r *RevisionScanner) SetTreeWriter(treeWriter func([]string) error) {
+	r.treeWriter = treeWriter
+}
+
+// SetBudgetPlan trims files according to a plan made in an earlier pass
+func (r *RevisionScanner) SetBudgetPlan(plan *BudgetPlan) {
+	r.budget = plan
+	r.stats.Budget = plan.Report
+}
+
+// SetDecisionHandler reports every path in the tree the scan considers,
+// included or not, with the rule that decided it
+func (r *RevisionScanner) SetDecisionHandler(handler DecisionHandler) {
+	r.decisionHandler = handler
+}
+
+func (r *RevisionScanner) GetErrors() []ScanError {
+	return r.errors
+}
+
+func (r *RevisionScanner) reportProgress(phase string, currentFile string, processed, total int) {
+	if r.progressCallback == nil {
+		return
+	}
+
+	progress := ScanProgress{
+		Phase:          phase,
+		CurrentFile:    currentFile,
+		ProcessedFiles: processed,
+		TotalFiles:     total,
+		BytesProcessed: r.stats.TotalSize,
+	}
+	if total > 0 {
+		progress.Percentage = float64(processed) / float64(total) * 100
+	}
+
+	r.progressCallback(progress)
+}
+
+func (r *RevisionScanner) recordError(path string, phase string, err error, skipped bool) {
+	r.errors = append(r.errors, ScanError{
+		Path:    path,
+		Phase:   phase,
+		Error:   err,
+		Skipped: skipped,
+	})
+}
+
+// Scan walks the commit's tree and calls fileHandler for each file
+func (r *RevisionScanner) Scan() (*StreamingStats, error) {
+	defer func() { r.stats.Errors = r.errors }()
+	r.reportProgress("collecting", "reading tree...", 0, 0)
+
+	root, err := r.repo.SubTree(r.commit.Tree, r.prefix)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.loadAncestorIgnores(); err != nil {
+		return nil, fmt.Errorf("failed to read tree: %w", err)
+	}
+
+	var entries []revisionEntry
+	if err := r.collect(root, "", &entries); err != nil {
+		return nil, fmt.Errorf("failed to read tree: %w", err)
+	}
+
+	if r.opts.IncludeDirectoryTree && r.treeWriter != nil {
+		paths := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			relativePath := filepath.FromSlash(entry.relPath)
+			if entry.excluded == nil && !r.budget.omits(relativePath) {
+				paths = append(paths, relativePath)
+			}
+		}
+
+		r.reportProgress("tree", "writing directory structure...", 0, len(entries))
+		if err := r.treeWriter(paths); err != nil {
+			return nil, fmt.Errorf("failed to write tree: %w", err)
+		}
+	}
+
+	for i, entry := range entries {
+		if entry.excluded != nil {
+			r.decisionHandler(*entry.excluded)
+			continue
+		}
+		r.reportProgress("scanning", entry.relPath, i, len(entries))
+		if err := r.processEntry(entry); err != nil {
+			return r.stats, err
+		}
+	}
+
+	return r.stats, nil
+}
+
+// collect gathers the files below tree in git's (sorted) order,
+// applying the same directory, file and ignore rules as a filesystem scan
+func (r *RevisionScanner) collect(tree gitrepo.Hash, dir string, entries *[]revisionEntry) error {
+	children, err := r.repo.ReadTree(tree)
+	if err != nil {
+		return err
+	}
+	r.loadIgnores(r.fullPath(dir), children)
+
+	for _, child := range children {
+		relPath := path.Join(dir, child.Name)
+
+		switch {
+		case child.IsDir():
+			if e := r.filter.explainDirRules(r.fullPath(relPath), child.Name); e.excluded() {
+				r.exclude(entries, relPath, true, e)
+				continue
+			}
+			if err := r.collect(child.Hash, relPath, entries); err != nil {
+				return err
+			}
+		case child.IsFile():
+			if e := r.filter.explainFile(r.fullPath(relPath)); e.excluded() {
+				r.exclude(entries, relPath, false, e)
+				continue
+			}
+			*entries = append(*entries, revisionEntry{relPath: relPath, hash: child.Hash})
+		}
+	}
+	return nil
+}
+
+// fullPath is where a path relative to the scan root would be if the
+// commit were checked out
+func (r *RevisionScanner) fullPath(relPath string) string {
+	return filepath.Join(r.filter.rootPath, filepath.FromSlash(relPath))
+}
+
+// loadIgnores reads the ignore files among the entries of dir from the
+// object store
+func (r *RevisionScanner) loadIgnores(dir string, children []gitrepo.TreeEntry) {
+	r.filter.ignore.loadDirFrom(dir, func(file string) ([]byte, error) {
+		name := filepath.Base(file)
+		for _, child := range children {
+			if child.Name == name && child.IsFile() {
+				return r.repo.ReadBlob(child.Hash)
+			}
+		}
+		return nil, fs.ErrNotExist
+	})
+}
+
+// loadAncestorIgnores reads the ignore files of the directories between
+// the top of the repository and the scan root, outermost first
+func (r *RevisionScanner) loadAncestorIgnores() error {
+	if r.prefix == "" {
+		return nil
+	}
+
+	parts := strings.Split(r.prefix, "/")
+	for i := range parts {
+		tree, err := r.repo.SubTree(r.commit.Tree, strings.Join(parts[:i], "/"))
+		if err != nil {
+			return err
+		}
+		children, err := r.repo.ReadTree(tree)
+		if err != nil {
+			return err
+		}
+		r.loadIgnores(filepath.Join(r.repo.WorkTree, filepath.FromSlash(strings.Join(parts[:i], "/"))), children)
+	}
+	return nil
+}
+
+// exclude keeps the decision for a path the filters left out, so it is
+// reported in tree order alongside the files that are packed
+func (r *RevisionScanner) exclude(entries *[]revisionEntry, relPath string, dir bool, e exclusion) {
+	if r.decisionHandler == nil {
+		return
+	}
+	decision := excludedDecision(filepath.FromSlash(relPath), dir, 0, e)
+	*entries = append(*entries, revisionEntry{relPath: relPath, excluded: decision})
+}
+
+func (r *RevisionScanner) processEntry(entry revisionEntry) error {
+	relativePath := filepath.FromSlash(entry.relPath)
+	fullPath := filepath.Join(r.repo.WorkTree, filepath.FromSlash(r.prefix), relativePath)
+
+	content, err := r.repo.ReadBlob(entry.hash)
+	if err != nil {
+		r.recordError(relativePath, "read", err, true)
+		return nil
+	}
+
+	// Every file carries the commit date; blobs have no mod time of their own
+	commitTime := r.commit.CommitterDate
+	size := int64(len(content))
+	extension := filepath.Ext(relativePath)
+
+	fileInfo := FileInfo{
+		Path:             fullPath,
+		RelativePath:     relativePath,
+		Size:             size,
+		SizeFormatted:    utils.FormatBytes(size),
+		ModTime:          commitTime.Format(time.RFC3339),
+		ModTimeFormatted: commitTime.Format("2006-01-02 15:04:05"),
+		Language:         detectLanguage(relativePath),
+		Extension:        extension,
+		IsText:           isTextFile(relativePath, extension),
+	}
+
+	if fileInfo.Language == "" {
+		fileInfo.Language = detectLanguageFromContent(relativePath, content)
+	}
+	if !fileInfo.IsText && isTextContent(content) {
+		fileInfo.IsText = true
+	}
+
+	if r.opts.IncludeContent && fileInfo.IsText {
+		processFileContent(&fileInfo, string(content), r.opts)
+	}
+
+	kept := r.budget.apply(&fileInfo, r.opts)
+	if r.decisionHandler != nil {
+		r.decisionHandler(*fileDecision(&fileInfo, kept, r.budget))
+	}
+	if !kept {
+		return nil
+	}
+	if err := r.budget.settle(&fileInfo); err != nil {
+		return fmt.Errorf("error measuring file %s: %w", relativePath, err)
+	}
+
+	r.stats.TotalFiles++
+	r.stats.TotalSize += size
+	r.stats.TotalTokens += fileInfo.TokenCount
+	r.stats.Secrets = append(r.stats.Secrets, fileInfo.Secrets...)
+	if fileInfo.IsText {
+		r.stats.TextFiles++
+	} else {
+		r.stats.BinaryFiles++
+	}
+	if fileInfo.Language != "" {
+		r.stats.LanguageCounts[fileInfo.Language]++
+	}
+
+	if err := r.fileHandler(&fileInfo); err != nil {
+		r.recordError(relativePath, "write", err, false)
+		return fmt.Errorf("error writing file %s: %w", relativePath, err)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package scanner
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SecretRule finds one kind of credential. When the pattern has a
+// capture group only the group is redacted, so "password=" stays
+// readable and just the value is replaced.
+type SecretRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+
+	// check filters candidate values the pattern alone can't rule out
+	check func(value string) bool
+}
+
+// SecretFinding records a redacted secret. The value itself is never kept.
+type SecretFinding struct {
+	Path string `json:"path"`
+	Line int    `json:"line"`
+	Rule string `json:"rule"`
+}
+
+// CustomSecretRule names the rules added with --redact-regex
+const CustomSecretRule = "custom"
+
+// secretKeyName matches setting names that hold credentials
+// (API_TOKEN, db_password, clientSecret, AWS_SECRET_ACCESS_KEY, ...)
+const secretKeyName = `[A-Za-z0-9_.-]*(?i:secret|token|passw(?:or)?d|pwd|api[_-]?key|access[_-]?key|private[_-]?key|credentials?)(?i:[_-]?(?:key|id))?`
+
+// builtinSecretRules are applied in order; earlier rules win overlaps
+var builtinSecretRules = []SecretRule{
+	{Name: "private-key", Pattern: regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |PGP |ENCRYPTED )?PRIVATE KEY(?: BLOCK)?-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY(?: BLOCK)?-----`)},
+	{Name: "aws-access-key-id", Pattern: regexp.MustCompile(`\b((?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[0-9A-Z]{16})\b`)},
+	{Name: "aws-secret-access-key", Pattern: regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]+\s*["']?([A-Za-z0-9/+=]{40})\b`)},
+	{Name: "gcp-api-key", Pattern: regexp.MustCompile(`\b(AIza[0-9A-Za-z_\-]{35})`)},
+	{Name: "azure-storage-key", Pattern: regexp.MustCompile(`AccountKey=([A-Za-z0-9+/=]{86,88})`)},
+	{Name: "github-token", Pattern: regexp.MustCompile(`\b((?:ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{80,})\b`)},
+	{Name: "gitlab-token", Pattern: regexp.MustCompile(`\b(glpat-[A-Za-z0-9_\-]{20,})\b`)},
+	{Name: "slack-token", Pattern: regexp.MustCompile(`\b(xox[abprs]-[A-Za-z0-9-]{10,})\b`)},
+	{Name: "stripe-key", Pattern: regexp.MustCompile(`\b((?:sk|rk)_(?:live|test)_[0-9A-Za-z]{24,})\b`)},
+	{Name: "jwt", Pattern: regexp.MustCompile(`\b(eyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,})`)},
+	{Name: "database-url-password", Pattern: regexp.MustCompile(`\b(?:postgres(?:ql)?|mysql|mariadb|mongodb(?:\+srv)?|rediss?|amqps?|mssql|sqlserver|jdbc:[a-z]+)://[^\s:/@'"]+:([^\s@/'"]+)@`),
+		check: func(v string) bool { return !isPlaceholderValue(v) }},
+	{Name: "generic-secret", Pattern: regexp.MustCompile(secretKeyName + `["']?\s*(?::=|=>|=|:)\s*["']([^"'\n]{8,})["']`),
+		check: func(v string) bool { return !isPlaceholderValue(v) && shannonEntropy(v) >= 3 }},
+	{Name: "generic-secret", Pattern: regexp.MustCompile(`(?m)^\s*(?:export\s+)?` + secretKeyName + `\s*[:=]\s*([^\s"'` + "`" + `#]{8,})\s*$`),
+		check: func(v string) bool { return !isPlaceholderValue(v) && !isIdentifierPath(v) && shannonEntropy(v) >= 3 }},
+	{Name: "high-entropy-string", Pattern: regexp.MustCompile(`["'` + "`" + `]([A-Za-z0-9+/=_\-]{32,})["'` + "`" + `]`),
+		check: isHighEntropy},
+}
+
+// SecretScanner redacts credentials from file content before it is packed
+type SecretScanner struct {
+	rules []SecretRule
+}
+
+// NewSecretScanner returns a scanner with the built-in rules plus one
+// rule per custom regular expression
+func NewSecretScanner(customPatterns []string) (*SecretScanner, error) {
+	s := &SecretScanner{rules: append([]SecretRule(nil), builtinSecretRules...)}
+	for _, pattern := range customPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --redact-regex %q: %w", pattern, err)
+		}
+		s.rules = append(s.rules, SecretRule{Name: CustomSecretRule, Pattern: re})
+	}
+	return s, nil
+}
+
+// RedactedPattern matches the placeholders Redact writes
+var RedactedPattern = regexp.MustCompile(`\[REDACTED:[\w-]+\]`)
+
+// secretMatch is a span of content to redact
+type secretMatch struct {
+	start, end int
+	rule       string
+}
+
+// Redact replaces every secret in content with a typed placeholder such
+// as [REDACTED:aws-access-key-id]. Findings carry 1-based line numbers
+// of the original content; their Path is left for the caller to fill.
+func (s *SecretScanner) Redact(content string) (string, []SecretFinding) {
+	if s == nil {
+		return content, nil
+	}
+
+	var matches []secretMatch
+	for _, rule := range s.rules {
+		for _, loc := range rule.Pattern.FindAllStringSubmatchIndex(content, -1) {
+			start, end := loc[0], loc[1]
+			if len(loc) >= 4 && loc[2] >= 0 {
+				start, end = loc[2], loc[3]
+			}
+			if start == end || (rule.check != nil && !rule.check(content[start:end])) {
+				continue
+			}
+			matches = append(matches, secretMatch{start: start, end: end, rule: rule.Name})
+		}
+	}
+	if len(matches) == 0 {
+		return content, nil
+	}
+
+	// Keep the first rule's match where matches overlap
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].start < matches[j].start })
+	var out strings.Builder
+	var findings []SecretFinding
+	pos, line, counted := 0, 1, 0
+	for _, m := range matches {
+		if m.start < pos {
+			continue
+		}
+		line += strings.Count(content[counted:m.start], "\n")
+		counted = m.start
+
+		out.WriteString(content[pos:m.start])
+		out.WriteString("[REDACTED:" + m.rule + "]")
+		findings = append(findings, SecretFinding{Line: line, Rule: m.rule})
+		pos = m.end
+	}
+	out.WriteString(content[pos:])
+	return out.String(), findings
+}
+
+// isPlaceholderValue recognizes values that stand in for a secret
+// rather than being one: variables, templates and obvious examples
+func isPlaceholderValue(v string) bool {
+	lower := strings.ToLower(v)
+	for _, marker := range []string{"${", "{{", "<", "%s", "%(", "process.env", "os.getenv", "changeme", "example", "placeholder", "your_", "your-", "xxxx", "****", "redacted"} {
+		if strings.Contains(lower, marker) {
+			return true
+		}
+	}
+	return strings.HasPrefix(v, "$")
+}
+
+// isIdentifierPath reports whether an unquoted value reads like code
+// (config.Token, getPassword()) rather than a literal secret
+func isIdentifierPath(v string) bool {
+	if strings.ContainsAny(v, "()[]") {
+		return true
+	}
+	for _, c := range v {
+		if c >= '0' && c <= '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// isHighEntropy flags long random-looking tokens: mixed case and digits,
+// and more than 4.3 bits of entropy per character. Hex digests (no upper
+// case) and subresource integrity hashes are left alone.
+func isHighEntropy(v string) bool {
+	if strings.HasPrefix(v, "sha1-") || strings.HasPrefix(v, "sha256-") || strings.HasPrefix(v, "sha384-") || strings.HasPrefix(v, "sha512-") {
+		return false
+	}
+	var upper, lower, digit bool
+	for _, c := range v {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= '0' && c <= '9':
+			digit = true
+		}
+	}
+	return upper && lower && digit && shannonEntropy(v) > 4.3
+}
+
+// shannonEntropy returns the bits of entropy per character of s
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	n := 0
+	for _, c := range s {
+		counts[c]++
+		n++
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(n)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
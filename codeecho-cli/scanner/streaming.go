@@ -2,11 +2,14 @@ package scanner
 
 import (
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
 
+	"github.com/opskraken/codeecho-cli/gitrepo"
 	"github.com/opskraken/codeecho-cli/utils"
 )
 
@@ -19,21 +22,53 @@ type StreamingScanner struct {
 	// NEW: Progress and error tracking
 	progressCallback ProgressCallback
 	errors           []ScanError
+	warnings         io.Writer // Skipped files are reported here too
 
 	stats     *StreamingStats
 	filePaths []string
 
+	// Restricts the scan to these paths when set (keyed by relative path)
+	changes map[string]gitrepo.Change
+
+	budget *BudgetPlan
+
+	// Told why each walked path is in or out, when set
+	decisionHandler DecisionHandler
+
 	// NEW: Timing
 	startTime time.Time
 }
 
 // StreamingStats tracks lightweight counters (not full file data)
 type StreamingStats struct {
-	TotalFiles     int
-	TotalSize      int64
-	TextFiles      int
-	BinaryFiles    int
-	LanguageCounts map[string]int
+	TotalFiles     int            `json:"total_files"`
+	TotalSize      int64          `json:"total_size"`
+	TotalTokens    int            `json:"total_tokens"`
+	Tokenizer      string         `json:"tokenizer,omitempty"` // Name of the tokenizer behind TotalTokens
+	TextFiles      int            `json:"text_files"`
+	BinaryFiles    int            `json:"binary_files"`
+	DeletedFiles   int            `json:"deleted_files"`
+	LanguageCounts map[string]int `json:"language_counts"`
+
+	// What --max-tokens left out or trimmed (nil without a budget)
+	Budget *BudgetReport `json:"token_budget,omitempty"`
+
+	// Secrets redacted from the packed files, without their values
+	Secrets []SecretFinding `json:"redacted_secrets,omitempty"`
+
+	// Errors recorded during the scan, including files it skipped
+	Errors []ScanError `json:"-"`
+}
+
+// newStreamingStats returns empty counters labelled with the tokenizer in use
+func newStreamingStats(opts ScanOptions) *StreamingStats {
+	stats := &StreamingStats{
+		LanguageCounts: make(map[string]int),
+	}
+	if opts.Tokenizer != nil {
+		stats.Tokenizer = opts.Tokenizer.Name()
+	}
+	return stats
 }
 
 // NewStreamingScanner creates a scanner that calls fileHandler for each file
@@ -42,11 +77,10 @@ func NewStreamingScanner(rootPath string, opts ScanOptions, fileHandler func(*Fi
 		rootPath:    rootPath,
 		opts:        opts,
 		fileHandler: fileHandler,
-		stats: &StreamingStats{
-			LanguageCounts: make(map[string]int),
-		},
-		filePaths: []string{},
-		errors:    []ScanError{}, // Initialize error slice
+		stats:       newStreamingStats(opts),
+		filePaths:   []string{},
+		errors:      []ScanError{}, // Initialize error slice
+		warnings:    os.Stderr,
 	}
 }
 
@@ -60,6 +94,42 @@ func (s *StreamingScanner) SetTreeWriter(treeWriter func([]string) error) {
 	s.treeWriter = treeWriter
 }
 
+// SetChanges limits the scan to the given changed paths.
+// Deleted files are emitted as entries without content after the walk.
+func (s *StreamingScanner) SetChanges(changes []gitrepo.Change) {
+	s.changes = make(map[string]gitrepo.Change, len(changes))
+	for _, change := range changes {
+		s.changes[filepath.FromSlash(change.Path)] = change
+	}
+}
+
+// SetWarningWriter sets where skipped files are reported as they happen;
+// stderr by default. They are recorded in the stats' errors either way.
+func (s *StreamingScanner) SetWarningWriter(w io.Writer) {
+	s.warnings = w
+}
+
+// SetBudgetPlan trims files according to a plan made in an earlier pass
+func (s *StreamingScanner) SetBudgetPlan(plan *BudgetPlan) {
+	s.budget = plan
+	s.stats.Budget = plan.Report
+}
+
+// SetDecisionHandler reports every path the walk considers, included or
+// not, with the rule that decided it. Calls arrive in walk order.
+func (s *StreamingScanner) SetDecisionHandler(handler DecisionHandler) {
+	s.decisionHandler = handler
+}
+
+// inChangeSet reports whether a path should be scanned given the change set
+func (s *StreamingScanner) inChangeSet(path string) bool {
+	if s.changes == nil {
+		return true
+	}
+	change, ok := s.changes[utils.GetRelativePath(s.rootPath, path)]
+	return ok && change.Status != gitrepo.StatusDeleted
+}
+
 func (s *StreamingScanner) GetFilePaths() []string {
 	return s.filePaths
 }
@@ -87,7 +157,7 @@ func (s *StreamingScanner) reportProgress(phase string, currentFile string) {
 
 	// calculate percentage
 	if len(s.filePaths) > 0 {
-		progress.Percentage = float64(s.stats.TextFiles) / float64(len(s.filePaths)) * 100
+		progress.Percentage = float64(progress.ProcessedFiles) / float64(len(s.filePaths)) * 100
 	}
 
 	s.progressCallback(progress)
@@ -96,6 +166,7 @@ func (s *StreamingScanner) reportProgress(phase string, currentFile string) {
 // NEW: Record error
 // Why: Collect errors instead of just logging
 func (s *StreamingScanner) recordError(path string, phase string, err error, skipped bool) {
+	path = utils.GetRelativePath(s.rootPath, path)
 	s.errors = append(s.errors, ScanError{
 		Path:    path,
 		Phase:   phase,
@@ -105,9 +176,9 @@ func (s *StreamingScanner) recordError(path string, phase string, err error, ski
 
 	// Still log for debugging
 	if skipped {
-		fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", path, err)
+		fmt.Fprintf(s.warnings, "Warning: skipping %s: %v\n", path, err)
 	} else {
-		fmt.Fprintf(os.Stderr, "Error processing %s: %v\n", path, err)
+		fmt.Fprintf(s.warnings, "Error processing %s: %v\n", path, err)
 	}
 }
 
@@ -115,21 +186,25 @@ func (s *StreamingScanner) recordError(path string, phase string, err error, ski
 func (s *StreamingScanner) collectPaths() error {
 	s.reportProgress("collecting", "scanning directories...")
 
+	filter := newPathFilter(s.rootPath, s.opts)
+
 	return filepath.WalkDir(s.rootPath, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", path, err)
+			fmt.Fprintf(s.warnings, "Warning: skipping %s: %v\n", path, err)
 			return nil // Continue scanning
 		}
 
-		// Skip excluded directories
-		if d.IsDir() && shouldExcludeDir(d.Name(), s.opts.ExcludeDirs) {
+		// Skip excluded and ignored directories
+		if d.IsDir() && filter.skipDir(path, d) {
 			return filepath.SkipDir
 		}
 
 		// Collect file paths only
-		if !d.IsDir() && shouldIncludeFile(path, s.opts.IncludeExts) {
+		if !d.IsDir() && filter.includeFile(path) && s.inChangeSet(path) {
 			relativePath := utils.GetRelativePath(s.rootPath, path)
-			s.filePaths = append(s.filePaths, relativePath)
+			if !s.budget.omits(relativePath) {
+				s.filePaths = append(s.filePaths, relativePath)
+			}
 		}
 
 		return nil
@@ -141,15 +216,17 @@ func (s *StreamingScanner) collectPaths() error {
 // Scan - Enhanced with progress and error tracking
 func (s *StreamingScanner) Scan() (*StreamingStats, error) {
 	s.startTime = time.Now()
+	defer func() { s.stats.Errors = s.errors }()
 
-	// Phase 1: Collect paths if tree is needed
-	if s.opts.IncludeDirectoryTree {
+	// Phase 1: Collect paths if the tree needs them, or to know the total
+	// for progress percentages and ETAs
+	if s.opts.IncludeDirectoryTree || s.progressCallback != nil {
 		if err := s.collectPaths(); err != nil {
 			return nil, fmt.Errorf("failed to collect paths: %w", err)
 		}
 
 		// Write tree immediately after collecting paths
-		if s.treeWriter != nil {
+		if s.opts.IncludeDirectoryTree && s.treeWriter != nil {
 			s.reportProgress("tree", "writing directory structure...")
 			if err := s.treeWriter(s.filePaths); err != nil {
 				return nil, fmt.Errorf("failed to write tree: %w", err)
@@ -157,45 +234,118 @@ func (s *StreamingScanner) Scan() (*StreamingStats, error) {
 		}
 	}
 
-	// Phase 2: Process files and stream content
+	// Phase 2: Process files and stream content. Workers read and process
+	// files while the walk goes on; results are emitted in walk order.
 	s.reportProgress("scanning", "processing files...")
 
-	err := filepath.WalkDir(s.rootPath, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			s.recordError(path, "scan", err, true)
-			return nil // Continue
-		}
+	filter := newPathFilter(s.rootPath, s.opts)
+	pipeline := newFilePipeline(s.opts.Jobs, s.opts.MaxInFlightBytes, s.loadFile)
 
-		// Skip excluded directories
-		if d.IsDir() && shouldExcludeDir(d.Name(), s.opts.ExcludeDirs) {
-			return filepath.SkipDir
-		}
+	var walkErr error
+	go func() {
+		defer pipeline.close()
+		walkErr = filepath.WalkDir(s.rootPath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				pipeline.fail(ScanError{Path: path, Phase: "scan", Error: err, Skipped: true})
+				return nil // Continue
+			}
 
-		// Process files only
-		if !d.IsDir() && shouldIncludeFile(path, s.opts.IncludeExts) {
-			if err := s.processFile(path, d); err != nil {
-				// Error recorded in processFile
-				return nil // Continue scanning
+			if d.IsDir() {
+				// Skip excluded and ignored directories
+				if e := filter.explainDir(path, d); e.excluded() {
+					if s.decisionHandler != nil {
+						pipeline.skip(excludedDecision(utils.GetRelativePath(s.rootPath, path), true, 0, e))
+					}
+					return filepath.SkipDir
+				}
+				return nil
 			}
-		}
 
-		return nil
-	})
+			e := filter.explainFile(path)
+			if !e.excluded() && !s.inChangeSet(path) {
+				e = exclusion{ReasonUnchanged, "not in the change set"}
+			}
+			if e.excluded() {
+				if s.decisionHandler != nil {
+					var size int64
+					if info, err := d.Info(); err == nil {
+						size = info.Size()
+					}
+					pipeline.skip(excludedDecision(utils.GetRelativePath(s.rootPath, path), false, size, e))
+				}
+				return nil
+			}
+
+			// Workers read and process the file
+			info, err := d.Info()
+			if err != nil {
+				pipeline.fail(ScanError{Path: path, Phase: "stat", Error: err, Skipped: true})
+				return nil
+			}
+			pipeline.submit(path, info)
+			return nil
+		})
+	}()
+
+	// Errors from the handler are recorded in emitFile; keep scanning
+	pipeline.drain(func(job *fileJob) { s.emitFile(job) })
+	if walkErr != nil {
+		return s.stats, walkErr
+	}
+
+	// Phase 3: Files that no longer exist can't be found by the walk
+	if err := s.emitDeleted(filter); err != nil {
+		return s.stats, err
+	}
 
-	return s.stats, err
+	return s.stats, nil
 }
 
-// Update: Separated file processing
-// Why: Makes error handling cleaner and more testable
-func (s *StreamingScanner) processFile(path string, d fs.DirEntry) error {
-	info, err := d.Info()
-	if err != nil {
-		s.recordError(path, "stat", err, true)
-		return err
+// emitDeleted writes an entry for every deleted path in the change set,
+// so readers know the file went away
+func (s *StreamingScanner) emitDeleted(filter *pathFilter) error {
+	var deleted []gitrepo.Change
+	for _, change := range s.changes {
+		if change.Status == gitrepo.StatusDeleted {
+			deleted = append(deleted, change)
+		}
+	}
+	sort.Slice(deleted, func(i, j int) bool {
+		return deleted[i].Path < deleted[j].Path
+	})
+
+	for _, change := range deleted {
+		path := filepath.Join(s.rootPath, filepath.FromSlash(change.Path))
+		if e := filter.explainMissing(path); e.excluded() {
+			s.decide(excludedDecision(filepath.FromSlash(change.Path), false, 0, e))
+			continue
+		}
+
+		fileInfo := FileInfo{
+			Path:          path,
+			RelativePath:  filepath.FromSlash(change.Path),
+			SizeFormatted: utils.FormatBytes(0),
+			Language:      detectLanguage(path),
+			Extension:     filepath.Ext(path),
+			ChangeStatus:  string(change.Status),
+		}
+
+		s.stats.DeletedFiles++
+		s.decide(&PathDecision{Path: fileInfo.RelativePath, Included: true, Reason: ReasonDeleted})
+		if err := s.fileHandler(&fileInfo); err != nil {
+			s.recordError(path, "write", err, false)
+			return fmt.Errorf("error writing file %s: %w", path, err)
+		}
 	}
 
+	return nil
+}
+
+// loadFile reads and processes one file on a pipeline worker. It only
+// fills in job, so it is safe to run concurrently with other files.
+func (s *StreamingScanner) loadFile(job *fileJob) {
+	path, info := job.path, job.info
 	relativePath := utils.GetRelativePath(s.rootPath, path)
-	s.reportProgress("scanning", relativePath)
 
 	language := detectLanguage(path)
 	extension := filepath.Ext(path)
@@ -212,11 +362,18 @@ func (s *StreamingScanner) processFile(path string, d fs.DirEntry) error {
 		IsText:           isTextFile(path, extension),
 	}
 
+	if change, ok := s.changes[relativePath]; ok {
+		fileInfo.ChangeStatus = string(change.Status)
+		if change.OldPath != "" {
+			fileInfo.PreviousPath = filepath.FromSlash(change.OldPath)
+		}
+	}
+
 	// Read and process content if requested
 	if s.opts.IncludeContent && fileInfo.IsText {
 		content, err := os.ReadFile(path)
 		if err != nil {
-			s.recordError(path, "read", err, true)
+			job.errors = append(job.errors, ScanError{Path: path, Phase: "read", Error: err, Skipped: true})
 			// Continue with empty content
 		} else {
 			// ENHANCED: Try content-based detection if language unknown
@@ -229,15 +386,43 @@ func (s *StreamingScanner) processFile(path string, d fs.DirEntry) error {
 				fileInfo.IsText = true
 			}
 
-			processedContent := processFileContent(string(content), fileInfo.Language, s.opts)
-			fileInfo.Content = processedContent
-			fileInfo.LineCount = utils.CountLines(processedContent)
+			processFileContent(&fileInfo, string(content), s.opts)
 		}
 	}
 
+	kept := s.budget.apply(&fileInfo, s.opts)
+	if kept {
+		job.file = &fileInfo
+	}
+	if s.decisionHandler != nil {
+		job.decision = fileDecision(&fileInfo, kept, s.budget)
+	}
+}
+
+// emitFile records a loaded file's errors and statistics and passes it
+// to the file handler. Jobs are emitted one at a time, in walk order.
+func (s *StreamingScanner) emitFile(job *fileJob) error {
+	for _, e := range job.errors {
+		s.recordError(e.Path, e.Phase, e.Error, e.Skipped)
+	}
+	if job.decision != nil {
+		s.decide(job.decision)
+	}
+	fileInfo := job.file
+	if fileInfo == nil {
+		return nil
+	}
+	path := job.path
+	s.reportProgress("scanning", fileInfo.RelativePath)
+	if err := s.budget.settle(fileInfo); err != nil {
+		return fmt.Errorf("error measuring file %s: %w", path, err)
+	}
+
 	// Update statistics
 	s.stats.TotalFiles++
-	s.stats.TotalSize += info.Size()
+	s.stats.TotalSize += fileInfo.Size
+	s.stats.TotalTokens += fileInfo.TokenCount
+	s.stats.Secrets = append(s.stats.Secrets, fileInfo.Secrets...)
 
 	if fileInfo.IsText {
 		s.stats.TextFiles++
@@ -250,10 +435,17 @@ func (s *StreamingScanner) processFile(path string, d fs.DirEntry) error {
 	}
 
 	// Call handler immediately, then discard from memory
-	if err := s.fileHandler(&fileInfo); err != nil {
+	if err := s.fileHandler(fileInfo); err != nil {
 		s.recordError(path, "write", err, false)
 		return fmt.Errorf("error writing file %s: %w", path, err)
 	}
 
 	return nil
 }
+
+// decide passes a decision to the decision handler, if there is one
+func (s *StreamingScanner) decide(decision *PathDecision) {
+	if s.decisionHandler != nil {
+		s.decisionHandler(*decision)
+	}
+}
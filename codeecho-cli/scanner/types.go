@@ -1,5 +1,11 @@
 package scanner
 
+import (
+	"encoding/json"
+
+	"github.com/opskraken/codeecho-cli/tokens"
+)
+
 type FileInfo struct {
 	Path             string `json:"path"`
 	RelativePath     string `json:"relative_path"`
@@ -10,8 +16,29 @@ type FileInfo struct {
 	Content          string `json:"content,omitempty"`
 	Language         string `json:"language,omitempty"`
 	LineCount        int    `json:"line_count,omitempty"`
+	TokenCount       int    `json:"token_count,omitempty"`
 	Extension        string `json:"extension,omitempty"`
 	IsText           bool   `json:"is_text"`
+
+	// Set when scanning a change set (--since, --staged, --working-tree)
+	ChangeStatus string `json:"change_status,omitempty"`
+	PreviousPath string `json:"previous_path,omitempty"`
+
+	// ContentHash of the file as read, before any processing
+	Hash string `json:"hash,omitempty"`
+
+	// Set when --compress signatures elided the file's function bodies
+	Compression string `json:"compression,omitempty"`
+
+	// Secrets redacted from Content; listed in the footer, not per file
+	Secrets []SecretFinding `json:"-"`
+
+	// Set when --max-tokens truncated the file or dropped its content
+	BudgetAction string `json:"budget_action,omitempty"`
+
+	// Set when a file alone exceeds the split limit and spans several parts
+	Chunk  int `json:"chunk,omitempty"`
+	Chunks int `json:"chunks,omitempty"`
 }
 
 type ScanResult struct {
@@ -19,6 +46,7 @@ type ScanResult struct {
 	ScanTime       string         `json:"scan_time"`
 	TotalFiles     int            `json:"total_files"`
 	TotalSize      int64          `json:"total_size"`
+	TotalTokens    int            `json:"total_tokens"`
 	Files          []FileInfo     `json:"files,omitempty"`
 	ProcessedBy    string         `json:"processed_by"`
 	TextFiles      int            `json:"text_files"`
@@ -32,23 +60,47 @@ type ScanOptions struct {
 	ShowLineNumbers      bool
 	OutputParsableFormat bool
 
-	CompressCode     bool
+	Compress         CompressMode
 	RemoveComments   bool
 	RemoveEmptyLines bool
+	KeepDocComments  bool // With RemoveComments, keep godoc/JSDoc/docstrings
 
 	ExcludeDirs    []string
 	IncludeExts    []string
 	IncludeContent bool
+
+	// Doublestar globs relative to the scan root. When IncludePatterns is
+	// set a file must match one of them as well as IncludeExts;
+	// IgnorePatterns always win.
+	IncludePatterns []string
+	IgnorePatterns  []string
+
+	// Honor .gitignore, .git/info/exclude and the global excludes file.
+	// .codeechoignore files are applied regardless.
+	UseGitignore bool
+
+	// Counts tokens of the processed content; nil disables counting
+	Tokenizer tokens.Counter
+
+	// Redacts credentials before any other processing; nil disables redaction
+	Secrets *SecretScanner
+
+	// Files read and processed concurrently by working-tree scans
+	// (0 = one per CPU). Output order doesn't depend on it.
+	Jobs int
+	// Bound on the bytes of files read but not yet handed to the file
+	// handler (0 = DefaultMaxInFlightBytes)
+	MaxInFlightBytes int64
 }
 
 // Progress tracking
 type ScanProgress struct {
-	Phase          string  // "collecting", "scanning", "writing"
-	CurrentFile    string  // File currently being processed
-	ProcessedFiles int     // Files completed
-	TotalFiles     int     // Total files to process (0 if unknown)
-	BytesProcessed int64   // Total bytes processed
-	Percentage     float64 // 0-100
+	Phase          string  `json:"phase"`           // "collecting", "tree", "scanning"
+	CurrentFile    string  `json:"current_file"`    // File currently being processed
+	ProcessedFiles int     `json:"processed_files"` // Files completed
+	TotalFiles     int     `json:"total_files"`     // Total files to process (0 if unknown)
+	BytesProcessed int64   `json:"bytes_processed"` // Total bytes processed
+	Percentage     float64 `json:"percentage"`      // 0-100 (0 if the total is unknown)
 }
 
 // NEW: Error tracking
@@ -59,14 +111,36 @@ type ScanError struct {
 	Skipped bool   // Was the file skipped or did scan fail?
 }
 
+// MarshalJSON writes the error as its message
+func (e ScanError) MarshalJSON() ([]byte, error) {
+	message := ""
+	if e.Error != nil {
+		message = e.Error.Error()
+	}
+	return json.Marshal(struct {
+		Path    string `json:"path"`
+		Phase   string `json:"phase"`
+		Error   string `json:"error"`
+		Skipped bool   `json:"skipped"`
+	}{e.Path, e.Phase, message, e.Skipped})
+}
+
 // NEW: Complete scan report
 type ScanReport struct {
-	Stats        *StreamingStats
-	Errors       []ScanError
-	SkippedFiles int
-	WarningCount int
-	Duration     string
-	Success      bool
+	Stats        *StreamingStats `json:"statistics"`
+	Errors       []ScanError     `json:"errors"`
+	SkippedFiles int             `json:"skipped_files"` // Files with errors the scan carried on past
+	WarningCount int             `json:"warning_count"` // Errors the scan carried on past
+	Duration     string          `json:"duration"`
+	Phases       []PhaseTiming   `json:"phases"` // One per pass over the files, in run order
+	Success      bool            `json:"success"`
+}
+
+// PhaseTiming is how long one phase of a run took
+type PhaseTiming struct {
+	Phase      string `json:"phase"`
+	Duration   string `json:"duration"`
+	DurationMs int64  `json:"duration_ms"`
 }
 
 // NEW: Progress callback
@@ -0,0 +1,96 @@
+package tokens
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tiktoken-go/tokenizer"
+)
+
+// DefaultTokenizer is used when --tokenizer isn't given
+const DefaultTokenizer = "cl100k"
+
+// Counter counts the tokens a model would see for a piece of text
+type Counter interface {
+	Name() string
+	Count(text string) int
+}
+
+// bpeEncodings maps tokenizer names to the embedded BPE vocabularies.
+// The vocabularies are compiled into the binary, so counting works offline.
+var bpeEncodings = map[string]tokenizer.Encoding{
+	"cl100k": tokenizer.Cl100kBase, // GPT-4, GPT-3.5; a close proxy for Claude and Gemini
+	"o200k":  tokenizer.O200kBase,  // GPT-4o and newer
+	"p50k":   tokenizer.P50kBase,
+	"r50k":   tokenizer.R50kBase,
+}
+
+// Names lists every supported tokenizer
+func Names() []string {
+	names := []string{"estimate"}
+	for name := range bpeEncodings {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// New returns the tokenizer with the given name
+func New(name string) (Counter, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = DefaultTokenizer
+	}
+
+	if name == "estimate" || name == "chars4" {
+		return estimator{}, nil
+	}
+
+	encoding, ok := bpeEncodings[strings.TrimSuffix(name, "_base")]
+	if !ok {
+		return nil, fmt.Errorf("unknown tokenizer %q (supported: %s)", name, strings.Join(Names(), ", "))
+	}
+
+	codec, err := tokenizer.Get(encoding)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tokenizer %s: %w", name, err)
+	}
+	return &bpeCounter{name: strings.TrimSuffix(name, "_base"), codec: codec}, nil
+}
+
+// bpeCounter counts tokens with an embedded BPE vocabulary
+type bpeCounter struct {
+	name  string
+	codec tokenizer.Codec
+}
+
+func (b *bpeCounter) Name() string {
+	return b.name
+}
+
+func (b *bpeCounter) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	n, err := b.codec.Count(text)
+	if err != nil {
+		// Fall back rather than failing the whole scan on odd input
+		return estimator{}.Count(text)
+	}
+	return n
+}
+
+// estimator approximates tokens as one per four characters.
+// It is much faster than BPE and usually within 10-20% for source code.
+type estimator struct{}
+
+func (estimator) Name() string {
+	return "estimate"
+}
+
+func (estimator) Count(text string) int {
+	chars := utf8.RuneCountInString(text)
+	return (chars + 3) / 4
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -19,6 +20,27 @@ func FormatBytes(bytes int64) string {
 	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
 
+// ParseBytes reads a size such as "400KB", "1.5MB" or "2048".
+// Units are binary (1KB = 1024 bytes), matching FormatBytes.
+func ParseBytes(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+
+	multiplier := int64(1)
+	if value != "" {
+		if exp := strings.IndexByte("KMGT", value[len(value)-1]); exp >= 0 {
+			multiplier = int64(1) << (10 * (exp + 1))
+			value = value[:len(value)-1]
+		}
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q (expected e.g. 400KB, 1.5MB or 2048)", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
 func CountLines(content string) int {
 	if content == "" {
 		return 0
@@ -50,7 +72,7 @@ func FormatDuration(d time.Duration) string {
 	if d < time.Hour {
 		minutes := int(d.Minutes())
 		seconds := int(d.Seconds()) % 60
-		return fmt.Sprintf("%dh %dm", minutes, seconds)
+		return fmt.Sprintf("%dm %ds", minutes, seconds)
 	}
 	hours := int(d.Hours())
 	minutes := int(d.Minutes()) % 60
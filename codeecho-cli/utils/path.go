@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"fmt"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -31,8 +33,18 @@ func GenerateAutoFilename(repoPath, format string, opts config.OutputOptions) st
 	switch format {
 	case "json":
 		ext = ".json"
+	case "jsonl":
+		ext = ".jsonl"
 	case "markdown", "md":
 		ext = ".md"
+	case "plain", "txt":
+		ext = ".txt"
+	case "html":
+		ext = ".html"
+	case "sqlite":
+		ext = ".sqlite"
+	case "template":
+		ext = templateExt(opts.Template.Name())
 	default:
 		ext = ".xml"
 	}
@@ -45,14 +57,20 @@ func GenerateAutoFilename(repoPath, format string, opts config.OutputOptions) st
 	if opts.RemoveEmptyLines {
 		suffix = append(suffix, "no-empty-lines")
 	}
-	if opts.CompressCode {
+	switch opts.Compress {
+	case "whitespace":
 		suffix = append(suffix, "compressed")
+	case "signatures":
+		suffix = append(suffix, "signatures")
 	}
 	if !opts.IncludeContent {
 		suffix = append(suffix, "structure-only")
 	}
 
 	filename := projectName
+	if opts.CommitSHA != "" && len(opts.CommitSHA) >= 7 {
+		filename += "-" + opts.CommitSHA[:7]
+	}
 	if len(suffix) > 0 {
 		filename += "-" + strings.Join(suffix, "-")
 	}
@@ -60,3 +78,50 @@ func GenerateAutoFilename(repoPath, format string, opts config.OutputOptions) st
 
 	return filename
 }
+
+// templateExt picks the extension of packs rendered with a template from
+// its file name: "team.md.tmpl" gives ".md"; ".txt" when it doesn't tell
+func templateExt(name string) string {
+	for _, suffix := range []string{".tmpl", ".tpl", ".gotmpl"} {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	if ext := filepath.Ext(name); ext != "" {
+		return ext
+	}
+	return ".txt"
+}
+
+// PartFilename derives the name of one part of a split pack by inserting
+// label before the extension ("repo-20250101.xml" -> "repo-20250101-part-001.xml")
+func PartFilename(path, label string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + label + ext
+}
+
+// SafeRelativePath cleans a path read from a pack or a model response,
+// refusing absolute paths and ".." components. Backslashes count as
+// separators, so a path written on Windows can't escape on Unix either.
+func SafeRelativePath(p string) (string, error) {
+	slashed := strings.ReplaceAll(p, `\`, "/")
+	switch {
+	case p == "":
+		return "", fmt.Errorf("empty file path")
+	case strings.ContainsRune(p, 0):
+		return "", fmt.Errorf("path %q contains a NUL byte", p)
+	case path.IsAbs(slashed), filepath.IsAbs(p), filepath.VolumeName(p) != "",
+		len(slashed) >= 2 && slashed[1] == ':':
+		return "", fmt.Errorf("refusing absolute path %q", p)
+	}
+
+	for _, part := range strings.Split(slashed, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("refusing path %q: it leaves the target directory", p)
+		}
+	}
+
+	clean := path.Clean(slashed)
+	if clean == "." {
+		return "", fmt.Errorf("path %q names no file", p)
+	}
+	return clean, nil
+}